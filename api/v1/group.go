@@ -21,6 +21,8 @@
 package v1
 
 import (
+	"sync/atomic"
+
 	"github.com/loadimpact/k6/lib"
 	"github.com/manyminds/api2go/jsonapi"
 	"github.com/pkg/errors"
@@ -39,8 +41,8 @@ func NewCheck(c *lib.Check) Check {
 		ID:     c.ID,
 		Path:   c.Path,
 		Name:   c.Name,
-		Passes: c.Passes,
-		Fails:  c.Fails,
+		Passes: atomic.LoadInt64(&c.Passes),
+		Fails:  atomic.LoadInt64(&c.Fails),
 	}
 }
 
@@ -21,12 +21,14 @@
 package v1
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats"
 	"github.com/manyminds/api2go/jsonapi"
 	"github.com/stretchr/testify/assert"
 )
@@ -37,6 +39,10 @@ type groupDummyRunner struct {
 
 func (r groupDummyRunner) NewVU() (lib.VU, error) { return nil, nil }
 
+func (r groupDummyRunner) Setup(ctx context.Context) ([]stats.Sample, error) { return nil, nil }
+
+func (r groupDummyRunner) Teardown(ctx context.Context) ([]stats.Sample, error) { return nil, nil }
+
 func (r groupDummyRunner) GetDefaultGroup() *lib.Group { return r.Group }
 
 func (r groupDummyRunner) GetOptions() lib.Options { return lib.Options{} }
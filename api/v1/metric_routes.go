@@ -31,10 +31,13 @@ import (
 func HandleGetMetrics(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
 	engine := common.GetEngine(r.Context())
 
+	// Formatting a sink may modify it, so take a write lock rather than a read lock.
+	engine.MetricsLock.Lock()
 	metrics := make([]Metric, 0)
 	for _, m := range engine.Metrics {
 		metrics = append(metrics, NewMetric(m))
 	}
+	engine.MetricsLock.Unlock()
 
 	data, err := jsonapi.Marshal(metrics)
 	if err != nil {
@@ -50,6 +53,7 @@ func HandleGetMetric(rw http.ResponseWriter, r *http.Request, p httprouter.Param
 
 	var metric Metric
 	var found bool
+	engine.MetricsLock.Lock()
 	for _, m := range engine.Metrics {
 		if m.Name == id {
 			metric = NewMetric(m)
@@ -57,6 +61,7 @@ func HandleGetMetric(rw http.ResponseWriter, r *http.Request, p httprouter.Param
 			break
 		}
 	}
+	engine.MetricsLock.Unlock()
 
 	if !found {
 		apiError(rw, "Not Found", "No metric with that ID was found", http.StatusNotFound)
@@ -0,0 +1,111 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"os"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/loadimpact/k6/js"
+	"github.com/spf13/afero"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var commandArchive = cli.Command{
+	Name:      "archive",
+	Usage:     "Bundles a script and everything it needs into a single file",
+	ArgsUsage: "filename",
+	Flags: append([]cli.Flag{
+		cli.StringFlag{
+			Name:  "archive-out, O",
+			Usage: "write the archive to this file, - for stdout",
+			Value: "archive.tar",
+		},
+	}, optionFlags...),
+	Action: actionArchive,
+	Description: `Archive bundles a script into a tar file, which can be run with 'k6 run'.
+
+   The archive contains the script, every script it imports and every file it
+   open()s, whether local or remote, as well as its options. Options from
+   config files and flags are merged into these, the same way 'run' does.
+
+   Running an archive doesn't read anything else from disk or the network, so
+   it can be versioned, or shipped to another machine, without worrying about
+   the original filesystem layout.`,
+}
+
+func actionArchive(cc *cli.Context) error {
+	args := cc.Args()
+	if len(args) != 1 {
+		return cli.NewExitError("Wrong number of arguments!", 1)
+	}
+
+	pwd, err := os.Getwd()
+	if err != nil {
+		pwd = "/"
+	}
+
+	cliOpts, err := getOptions(cc)
+	if err != nil {
+		log.WithError(err).Error("Invalid option specified")
+		return err
+	}
+
+	fs := afero.NewOsFs()
+	src, err := getSrcData(args[0], pwd, os.Stdin, fs)
+	if err != nil {
+		log.WithError(err).Error("Failed to parse input data")
+		return err
+	}
+	// Only variables given with --env are archived; the process' own might well be secret.
+	env, err := getEnv(cc)
+	if err != nil {
+		log.WithError(err).Error("Invalid environment variable specified")
+		return err
+	}
+	r, err := js.New(src, fs, env)
+	if err != nil {
+		log.WithError(err).Error("Couldn't load the script")
+		return err
+	}
+
+	configOpts, err := readConfigFiles(fs, cc.StringSlice("config"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	r.ApplyOptions(configOpts)
+	r.ApplyOptions(cliOpts)
+
+	out := os.Stdout
+	if filename := cc.String("archive-out"); filename != "-" {
+		f, err := os.Create(filename)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		defer func() { _ = f.Close() }()
+		out = f
+	}
+	if err := r.MakeArchive().Write(out); err != nil {
+		log.WithError(err).Error("Couldn't write the archive")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/loadimpact/k6/converter/har"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var commandConvert = cli.Command{
+	Name:      "convert",
+	Usage:     "Converts a HAR file to a k6 script",
+	ArgsUsage: "filename",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "output, O",
+			Usage: "write the script to this file, instead of stdout",
+		},
+		cli.StringSliceFlag{
+			Name:  "only",
+			Usage: "only include requests to this domain, or subdomains of it; may be repeated",
+		},
+		cli.StringSliceFlag{
+			Name:  "skip",
+			Usage: "skip requests to this domain, or subdomains of it; may be repeated",
+		},
+		cli.BoolFlag{
+			Name:  "think-time",
+			Usage: "sleep between pages for as long as the recording did",
+		},
+	},
+	Action: actionConvert,
+	Description: `Convert turns a HAR file, eg. recorded with a browser's devtools, into a script.
+
+   Requests are made in the order they were recorded in, with the same
+   headers and bodies, and grouped by the page they were made from. Cookies
+   are left to the VUs' cookie jars, rather than replayed as recorded.`,
+}
+
+func actionConvert(cc *cli.Context) error {
+	args := cc.Args()
+	if len(args) != 1 {
+		return cli.NewExitError("Wrong number of arguments!", 1)
+	}
+
+	data, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	var h har.HAR
+	if err := json.Unmarshal(data, &h); err != nil {
+		log.WithError(err).Error("Couldn't parse the HAR file")
+		return err
+	}
+
+	script, err := har.Convert(h, har.Options{
+		Only:      cc.StringSlice("only"),
+		Skip:      cc.StringSlice("skip"),
+		ThinkTime: cc.Bool("think-time"),
+	})
+	if err != nil {
+		log.WithError(err).Error("Couldn't convert the HAR file")
+		return err
+	}
+
+	if filename := cc.String("output"); filename != "" {
+		return ioutil.WriteFile(filename, []byte(script), 0644)
+	}
+	_, err = os.Stdout.Write([]byte(script))
+	return err
+}
@@ -0,0 +1,232 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package har
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Options for Convert.
+type Options struct {
+	// Only include requests to these domains, or subdomains of them; all if empty.
+	Only []string
+
+	// Skip requests to these domains, or subdomains of them.
+	Skip []string
+
+	// Sleep between pages for as long as the user did in the recording.
+	ThinkTime bool
+}
+
+// A run of consecutive entries belonging to the same page, or to no page.
+type block struct {
+	page    *Page
+	entries []*Entry
+}
+
+// Convert turns a HAR recording into a k6 script. Requests are made in the order they were
+// recorded in, grouped by the page they were made from.
+func Convert(h HAR, opts Options) (string, error) {
+	if h.Log == nil {
+		return "", errors.New("HAR file has no log")
+	}
+
+	pages := make(map[string]*Page, len(h.Log.Pages))
+	for i := range h.Log.Pages {
+		pages[h.Log.Pages[i].ID] = &h.Log.Pages[i]
+	}
+
+	entries := make([]*Entry, 0, len(h.Log.Entries))
+	for _, e := range h.Log.Entries {
+		if e.Request == nil {
+			continue
+		}
+		u, err := url.Parse(e.Request.URL)
+		if err != nil {
+			return "", err
+		}
+		if (len(opts.Only) > 0 && !matchesDomain(u.Host, opts.Only)) || matchesDomain(u.Host, opts.Skip) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) == 0 {
+		return "", errors.New("no requests to convert")
+	}
+
+	// Browsers don't necessarily write entries in the order they were made in.
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].StartedDateTime.Before(entries[j].StartedDateTime)
+	})
+
+	var blocks []*block
+	for _, e := range entries {
+		if len(blocks) == 0 || blocks[len(blocks)-1].entries[0].Pageref != e.Pageref {
+			blocks = append(blocks, &block{page: pages[e.Pageref]})
+		}
+		b := blocks[len(blocks)-1]
+		b.entries = append(b.entries, e)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if c := h.Log.Creator; c != nil {
+		fmt.Fprintf(buf, "// Converted from a HAR file created by %s %s.\n", c.Name, c.Version)
+	}
+	fmt.Fprint(buf, "import { group, sleep } from \"k6\";\n")
+	fmt.Fprint(buf, "import http from \"k6/http\";\n\n")
+	fmt.Fprint(buf, "export default function() {\n")
+	fmt.Fprint(buf, "\tlet res;\n")
+
+	var lastEnd time.Time
+	for _, b := range blocks {
+		if opts.ThinkTime && !lastEnd.IsZero() {
+			if d := b.entries[0].StartedDateTime.Sub(lastEnd); d >= 100*time.Millisecond {
+				fmt.Fprintf(buf, "\tsleep(%.1f);\n", d.Seconds())
+			}
+		}
+		for _, e := range b.entries {
+			end := e.StartedDateTime.Add(time.Duration(e.Time * float64(time.Millisecond)))
+			if end.After(lastEnd) {
+				lastEnd = end
+			}
+		}
+
+		indent := "\t"
+		if b.page != nil {
+			name := b.page.Title
+			if name == "" {
+				name = b.page.ID
+			}
+			fmt.Fprintf(buf, "\n\tgroup(%s, function() {\n", jsString(name))
+			indent = "\t\t"
+		} else {
+			fmt.Fprint(buf, "\n")
+		}
+		for _, e := range b.entries {
+			writeRequest(buf, indent, e.Request)
+		}
+		if b.page != nil {
+			fmt.Fprint(buf, "\t});\n")
+		}
+	}
+
+	fmt.Fprint(buf, "}\n")
+	return buf.String(), nil
+}
+
+func writeRequest(buf *bytes.Buffer, indent string, req *Request) {
+	method := strings.ToUpper(req.Method)
+
+	body := "null"
+	hasBody := false
+	if req.PostData != nil && method != "GET" && method != "HEAD" {
+		hasBody = true
+		if req.PostData.Text != "" || len(req.PostData.Params) == 0 {
+			body = jsString(req.PostData.Text)
+		} else {
+			params := make(url.Values)
+			for _, p := range req.PostData.Params {
+				params.Add(p.Name, p.Value)
+			}
+			body = jsString(params.Encode())
+		}
+	}
+
+	var headers []Header
+	for _, h := range req.Headers {
+		// HTTP/2 pseudo-headers and Content-Length are set by the client; cookies are handled by
+		// the VU's cookie jar, so replaying the recorded ones would only get in the way.
+		name := strings.ToLower(h.Name)
+		if strings.HasPrefix(name, ":") || name == "content-length" || name == "cookie" {
+			continue
+		}
+		headers = append(headers, h)
+	}
+
+	var params string
+	if len(headers) > 0 {
+		lines := make([]string, len(headers))
+		for i, h := range headers {
+			lines[i] = fmt.Sprintf("%s\t\t%s: %s,\n", indent, jsString(h.Name), jsString(h.Value))
+		}
+		params = fmt.Sprintf("{\n%s\theaders: {\n%s%s\t}\n%s}", indent, strings.Join(lines, ""), indent, indent)
+	}
+
+	args := []string{jsString(req.URL)}
+	switch method {
+	case "GET":
+		fmt.Fprintf(buf, "%sres = http.get(", indent)
+	case "HEAD":
+		fmt.Fprintf(buf, "%sres = http.head(", indent)
+	case "POST", "PUT", "PATCH", "DELETE":
+		fn := strings.ToLower(method)
+		if method == "DELETE" {
+			fn = "del"
+		}
+		fmt.Fprintf(buf, "%sres = http.%s(", indent, fn)
+		if hasBody || params != "" {
+			args = append(args, body)
+		}
+	default:
+		fmt.Fprintf(buf, "%sres = http.request(", indent)
+		args = append([]string{jsString(method)}, args...)
+		if hasBody || params != "" {
+			args = append(args, body)
+		}
+	}
+	if params != "" {
+		args = append(args, params)
+	}
+	fmt.Fprintf(buf, "%s);\n", strings.Join(args, ", "))
+}
+
+// Returns whether a host is one of the domains, or a subdomain of one of them.
+func matchesDomain(host string, domains []string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	for _, d := range domains {
+		d = strings.ToLower(d)
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// Quotes a string as a JS string literal; JSON strings are valid JS ones.
+func jsString(s string) string {
+	buf := bytes.NewBuffer(nil)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
@@ -0,0 +1,196 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package har
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testHAR = `{
+	"log": {
+		"version": "1.2",
+		"creator": { "name": "WebInspector", "version": "537.36" },
+		"pages": [
+			{ "startedDateTime": "2017-05-01T12:00:00.000Z", "id": "page_1", "title": "https://example.com/" },
+			{ "startedDateTime": "2017-05-01T12:00:05.000Z", "id": "page_2", "title": "" }
+		],
+		"entries": [
+			{
+				"pageref": "page_1",
+				"startedDateTime": "2017-05-01T12:00:00.500Z",
+				"time": 100,
+				"request": {
+					"method": "GET",
+					"url": "https://cdn.example.com/style.css",
+					"headers": [{ "name": ":authority", "value": "cdn.example.com" }]
+				}
+			},
+			{
+				"pageref": "page_1",
+				"startedDateTime": "2017-05-01T12:00:00.000Z",
+				"time": 250,
+				"request": {
+					"method": "GET",
+					"url": "https://example.com/",
+					"headers": [
+						{ "name": "Accept", "value": "text/html" },
+						{ "name": "Cookie", "value": "session=abc" }
+					]
+				}
+			},
+			{
+				"pageref": "page_1",
+				"startedDateTime": "2017-05-01T12:00:01.000Z",
+				"time": 100,
+				"request": {
+					"method": "GET",
+					"url": "https://tracker.example.org/pixel.gif"
+				}
+			},
+			{
+				"pageref": "page_2",
+				"startedDateTime": "2017-05-01T12:00:05.000Z",
+				"time": 100,
+				"request": {
+					"method": "POST",
+					"url": "https://example.com/login",
+					"headers": [
+						{ "name": "Content-Type", "value": "application/x-www-form-urlencoded" },
+						{ "name": "Content-Length", "value": "21" }
+					],
+					"postData": {
+						"mimeType": "application/x-www-form-urlencoded",
+						"params": [{ "name": "user", "value": "admin" }, { "name": "pass", "value": "\"secret\"" }]
+					}
+				}
+			},
+			{
+				"startedDateTime": "2017-05-01T12:00:05.500Z",
+				"time": 10,
+				"request": {
+					"method": "OPTIONS",
+					"url": "https://example.com/api",
+					"postData": { "mimeType": "text/plain", "text": "ping" }
+				}
+			}
+		]
+	}
+}`
+
+func TestConvert(t *testing.T) {
+	var h HAR
+	if !assert.NoError(t, json.Unmarshal([]byte(testHAR), &h)) {
+		return
+	}
+
+	t.Run("Default", func(t *testing.T) {
+		script, err := Convert(h, Options{})
+		assert.NoError(t, err)
+		assert.Equal(t, `// Converted from a HAR file created by WebInspector 537.36.
+import { group, sleep } from "k6";
+import http from "k6/http";
+
+export default function() {
+	let res;
+
+	group("https://example.com/", function() {
+		res = http.get("https://example.com/", {
+			headers: {
+				"Accept": "text/html",
+			}
+		});
+		res = http.get("https://cdn.example.com/style.css");
+		res = http.get("https://tracker.example.org/pixel.gif");
+	});
+
+	group("page_2", function() {
+		res = http.post("https://example.com/login", "pass=%22secret%22&user=admin", {
+			headers: {
+				"Content-Type": "application/x-www-form-urlencoded",
+			}
+		});
+	});
+
+	res = http.request("OPTIONS", "https://example.com/api", "ping");
+}
+`, script)
+	})
+
+	t.Run("Filtered", func(t *testing.T) {
+		script, err := Convert(h, Options{Only: []string{"example.com"}, Skip: []string{"cdn.example.com"}, ThinkTime: true})
+		assert.NoError(t, err)
+		assert.Equal(t, `// Converted from a HAR file created by WebInspector 537.36.
+import { group, sleep } from "k6";
+import http from "k6/http";
+
+export default function() {
+	let res;
+
+	group("https://example.com/", function() {
+		res = http.get("https://example.com/", {
+			headers: {
+				"Accept": "text/html",
+			}
+		});
+	});
+	sleep(4.8);
+
+	group("page_2", function() {
+		res = http.post("https://example.com/login", "pass=%22secret%22&user=admin", {
+			headers: {
+				"Content-Type": "application/x-www-form-urlencoded",
+			}
+		});
+	});
+	sleep(0.4);
+
+	res = http.request("OPTIONS", "https://example.com/api", "ping");
+}
+`, script)
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		_, err := Convert(h, Options{Only: []string{"example.net"}})
+		assert.EqualError(t, err, "no requests to convert")
+
+		_, err = Convert(HAR{}, Options{})
+		assert.EqualError(t, err, "HAR file has no log")
+	})
+}
+
+func TestMatchesDomain(t *testing.T) {
+	testdata := map[string]bool{
+		"example.com":         true,
+		"EXAMPLE.com":         true,
+		"example.com:8080":    true,
+		"www.example.com":     true,
+		"notexample.com":      false,
+		"example.com.evil.io": false,
+	}
+	for host, matches := range testdata {
+		t.Run(host, func(t *testing.T) {
+			assert.Equal(t, matches, matchesDomain(host, []string{"example.com"}))
+		})
+	}
+}
@@ -0,0 +1,321 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/fatih/color"
+	"github.com/loadimpact/k6/distributed"
+	"github.com/loadimpact/k6/js"
+	"github.com/loadimpact/k6/lib"
+	"github.com/spf13/afero"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var commandCoordinator = cli.Command{
+	Name:      "coordinator",
+	Usage:     "Runs a test on several agents, and aggregates their results",
+	ArgsUsage: "filename",
+	Flags: append([]cli.Flag{
+		cli.StringFlag{
+			Name:  "type, t",
+			Usage: "input type, one of: auto, js, archive",
+			Value: "auto",
+		},
+		cli.StringFlag{
+			Name:  "listen",
+			Usage: "address to wait for agents on",
+			Value: ":6566",
+		},
+		cli.IntFlag{
+			Name:  "instances",
+			Usage: "number of agents to split the test between",
+			Value: 1,
+		},
+		cli.StringFlag{
+			Name:   "out, o",
+			Usage:  "output metrics to an external data store (format: type=uri)",
+			EnvVar: "K6_OUT",
+		},
+		cli.StringFlag{
+			Name:  "summary-export",
+			Usage: "write the end-of-test summary to a file, as JSON",
+		},
+	}, optionFlags...),
+	Action: actionCoordinator,
+	Description: `Coordinator runs a test on several machines at once, for more load than one
+   machine can generate.
+
+   It waits for --instances agents, started with 'k6 agent', to connect, then
+   hands each of them the test, as an archive, along with an equal segment of
+   it to run; VUs and rates are split between them. Options are merged the
+   same way 'run' does, before the test is handed out.
+
+   Agents stream their metrics back, and the coordinator evaluates thresholds
+   over all of them together, stopping every agent if one aborts the test.
+   The end-of-test summary covers the metrics of all agents, but not their
+   checks and groups; the checks metric shows how many checks passed.
+
+   setup() and teardown() run once, on the coordinator, and every agent's VUs
+   get what setup() returned. Agents see their own process' environment
+   variables, along with the ones given with --env.`,
+}
+
+var commandAgent = cli.Command{
+	Name:      "agent",
+	Usage:     "Runs a segment of a test for a coordinator",
+	ArgsUsage: "address",
+	Action:    actionAgent,
+	Description: `Agent connects to a coordinator, started with 'k6 coordinator', at the given
+   address, and waits for it to hand out a test; it then runs its segment of
+   the test, and streams its metrics back. It exits once the test is over.
+
+   If the coordinator isn't up yet, the agent keeps trying to connect to it.`,
+}
+
+func actionCoordinator(cc *cli.Context) error {
+	args := cc.Args()
+	if len(args) != 1 {
+		return cli.NewExitError("Wrong number of arguments!", 1)
+	}
+	instances := cc.Int("instances")
+	if instances < 1 {
+		return cli.NewExitError("There must be at least one instance", 1)
+	}
+
+	pwd, err := os.Getwd()
+	if err != nil {
+		pwd = "/"
+	}
+
+	cliOpts, err := getOptions(cc)
+	if err != nil {
+		log.WithError(err).Error("Invalid option specified")
+		return err
+	}
+
+	// Make an archive of the test, with all options merged in, for the agents to run.
+	fs := afero.NewOsFs()
+	src, err := getSrcData(args[0], pwd, os.Stdin, fs)
+	if err != nil {
+		log.WithError(err).Error("Failed to parse input data")
+		return err
+	}
+	runnerType := cc.String("type")
+	if runnerType == TypeAuto {
+		runnerType = guessType(src.Data)
+	}
+	env, err := getEnv(cc)
+	if err != nil {
+		log.WithError(err).Error("Invalid environment variable specified")
+		return err
+	}
+
+	// As with 'archive', only variables given with --env go into the archive.
+	var runner *js.Runner
+	switch runnerType {
+	case TypeJS:
+		runner, err = js.New(src, fs, env)
+	case TypeArchive:
+		var arc *lib.Archive
+		if arc, err = lib.ReadArchive(bytes.NewReader(src.Data)); err == nil {
+			arc.Env = mergeEnv(arc.Env, env)
+			runner, err = js.NewFromArchive(arc)
+		}
+	default:
+		return cli.NewExitError("Only scripts and archives can be run on agents", 1)
+	}
+	if err != nil {
+		log.WithError(err).Error("Couldn't load the script")
+		return err
+	}
+
+	configOpts, err := readConfigFiles(fs, cc.StringSlice("config"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	opts := applyDefaults(runner.GetOptions().Apply(configOpts).Apply(cliOpts))
+	runner.ApplyOptions(opts)
+	arc := runner.MakeArchive()
+
+	// The archive's made; setup() and teardown(), which run here, see this process' environment.
+	runner.Bundle.Env = mergeEnv(systemEnv(), runner.Bundle.Env)
+
+	// The engine has no VUs of its own; it takes in the agents' samples.
+	engine, err := lib.NewEngine(nil, distributed.EngineOptions(opts))
+	if err != nil {
+		log.WithError(err).Error("Couldn't create the engine")
+		return err
+	}
+	if out := cc.String("out"); out != "" {
+		collector, err := makeCollector(out, src, opts)
+		if err != nil {
+			log.WithError(err).Error("Couldn't create output")
+			return err
+		}
+		collector.Init()
+		engine.Collector = collector
+	}
+	coordinator := distributed.NewCoordinator(arc, engine, instances)
+	coordinator.Runner = runner
+
+	ln, err := net.Listen("tcp", cc.String("listen"))
+	if err != nil {
+		log.WithError(err).Error("Couldn't listen for agents")
+		return err
+	}
+
+	fmt.Fprintf(color.Output, "\n")
+	fmt.Fprintf(color.Output, "  execution: %s\n", color.CyanString("distributed (%d instances)", instances))
+	fmt.Fprintf(color.Output, "     script: %s (%s)\n", color.CyanString(src.Filename), color.CyanString(runnerType))
+	fmt.Fprintf(color.Output, "        vus: %s, max: %s\n", color.CyanString("%d", opts.VUs.Int64), color.CyanString("%d", opts.VUsMax.Int64))
+	fmt.Fprintf(color.Output, "\n")
+	fmt.Fprintf(color.Output, "  waiting for agents on %s\n", color.CyanString(ln.Addr().String()))
+	fmt.Fprintf(color.Output, "\n")
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+
+	// Cancelling ctx stops the agents; the engine keeps going until they're done, so it gets
+	// every last sample they send.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case sig := <-signals:
+			log.WithField("signal", sig).Debug("Signal received; stopping agents...")
+			cancel()
+		case <-ctx.Done():
+			return
+		}
+		sig := <-signals
+		log.WithField("signal", sig).Error("Signal received; aborting without waiting for agents")
+		os.Exit(1)
+	}()
+
+	if err := coordinator.Accept(ctx, ln); err != nil {
+		if err == context.Canceled {
+			return nil
+		}
+		log.WithError(err).Error("Couldn't accept agents")
+		return err
+	}
+
+	engineCtx, engineCancel := context.WithCancel(context.Background())
+	engineDone := make(chan struct{})
+	go func() {
+		defer close(engineDone)
+		if err := engine.Run(engineCtx); err != nil {
+			log.WithError(err).Error("Engine Error")
+		}
+
+		// Crossing a threshold that aborts the test stops the engine on its own.
+		cancel()
+	}()
+
+	runErr := coordinator.Run(ctx)
+	if err := coordinator.Teardown(); err != nil {
+		log.WithError(err).Error("Teardown failed")
+		if runErr == nil {
+			runErr = err
+		}
+	}
+	engineCancel()
+	<-engineDone
+
+	atTime := engine.AtTime()
+	fmt.Fprintf(color.Output, "[%-10s] %s\n\n", "done", roundDuration(atTime, 100*time.Millisecond))
+	printMetrics(engine.Metrics, atTime)
+
+	if err := handleSummary(engine, cc.String("summary-export")); err != nil {
+		log.WithError(err).Error("Couldn't write the summary")
+	}
+
+	if runErr != nil {
+		log.WithError(runErr).Error("Test failed")
+		return cli.NewExitError("", 1)
+	}
+	if engine.IsTainted() {
+		return cli.NewExitError("", 99)
+	}
+	return nil
+}
+
+func actionAgent(cc *cli.Context) error {
+	args := cc.Args()
+	if len(args) != 1 {
+		return cli.NewExitError("Wrong number of arguments!", 1)
+	}
+	addr := args[0]
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			log.WithField("signal", sig).Debug("Signal received; shutting down...")
+			cancel()
+		case <-ctx.Done():
+			return
+		}
+		sig := <-signals
+		log.WithField("signal", sig).Error("Signal received; aborting without waiting for iterations or teardown")
+		os.Exit(1)
+	}()
+
+	// The coordinator may well not be up yet; keep trying until it is.
+	var conn net.Conn
+	for {
+		c, err := net.DialTimeout("tcp", addr, 10*time.Second)
+		if err == nil {
+			conn = c
+			break
+		}
+		log.WithError(err).Debug("Couldn't connect to the coordinator; retrying...")
+		select {
+		case <-time.After(1 * time.Second):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	defer func() { _ = conn.Close() }()
+	log.WithField("addr", addr).Info("Connected to the coordinator")
+
+	agent := distributed.NewAgent(func(arc *lib.Archive) (lib.Runner, error) {
+		arc.Env = mergeEnv(systemEnv(), arc.Env)
+		return js.NewFromArchive(arc)
+	})
+	if err := agent.Run(ctx, conn); err != nil {
+		log.WithError(err).Error("Test failed")
+		return cli.NewExitError("", 1)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package distributed
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
+)
+
+// How often an agent streams its samples back to the coordinator.
+const SendRate = 100 * time.Millisecond
+
+// An Agent runs the segment of a test a coordinator hands it, and streams its samples back.
+type Agent struct {
+	// Makes a runner for the test the coordinator sends.
+	NewRunner func(arc *lib.Archive) (lib.Runner, error)
+
+	Logger *log.Logger
+}
+
+func NewAgent(newRunner func(arc *lib.Archive) (lib.Runner, error)) *Agent {
+	return &Agent{NewRunner: newRunner, Logger: log.StandardLogger()}
+}
+
+// Run waits for a test from the coordinator at the other end of nc, runs its segment of it, and
+// returns once it's done. Cancelling ctx ends the test early, as the coordinator can.
+func (a *Agent) Run(ctx context.Context, nc net.Conn) error {
+	c := newConn(nc)
+	if err := c.send(message{Type: msgHello}); err != nil {
+		return err
+	}
+	msg, err := c.receive()
+	if err != nil {
+		return errors.Wrap(err, "couldn't receive the test")
+	}
+	if msg.Type != msgRun {
+		return errors.Errorf("expected a test, got: %s", msg.Type)
+	}
+
+	engine, err := a.newEngine(msg)
+	if err != nil {
+		_ = c.send(message{Type: msgDone, Error: err.Error()})
+		return err
+	}
+	engine.Collector = &sampleSender{Conn: c, Logger: a.Logger}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		// Whether the coordinator says so, or goes away, the test is over.
+		for {
+			msg, err := c.receive()
+			if err != nil || msg.Type == msgStop {
+				cancel()
+				return
+			}
+		}
+	}()
+
+	a.Logger.WithField("segment", msg.Segment).Info("Running test")
+	runErr := engine.Run(ctx)
+	done := message{Type: msgDone}
+	if runErr != nil {
+		done.Error = runErr.Error()
+	}
+	if err := c.send(done); err != nil {
+		return err
+	}
+	return runErr
+}
+
+func (a *Agent) newEngine(msg message) (*lib.Engine, error) {
+	arc, err := lib.ReadArchive(bytes.NewReader(msg.Archive))
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't read the test")
+	}
+	runner, err := a.NewRunner(arc)
+	if err != nil {
+		return nil, err
+	}
+
+	// The coordinator runs setup() and teardown(), once for the whole test.
+	if h, ok := runner.(lib.SetupDataHolder); ok {
+		h.SetSetupData(msg.SetupData)
+	}
+	runner = noSetupRunner{runner}
+
+	// Thresholds are the coordinator's to evaluate, over everyone's samples; ours alone might
+	// well cross them when the whole test doesn't, or the other way around.
+	opts := arc.Options
+	opts.ExecutionSegment = msg.Segment
+	opts.Thresholds = nil
+	runner.ApplyOptions(opts)
+
+	engine, err := lib.NewEngine(runner, opts)
+	if err != nil {
+		return nil, err
+	}
+	engine.Logger = a.Logger
+	return engine, nil
+}
+
+// A runner that leaves setup() and teardown() to the coordinator.
+type noSetupRunner struct {
+	lib.Runner
+}
+
+func (noSetupRunner) Setup(ctx context.Context) ([]stats.Sample, error) {
+	return nil, nil
+}
+
+func (noSetupRunner) Teardown(ctx context.Context) ([]stats.Sample, error) {
+	return nil, nil
+}
+
+// A collector that streams samples back to the coordinator.
+type sampleSender struct {
+	Conn   *conn
+	Logger *log.Logger
+
+	buffer []stats.Sample
+	lock   sync.Mutex
+}
+
+func (s *sampleSender) Init() {}
+
+func (s *sampleSender) Run(ctx context.Context) {
+	ticker := time.NewTicker(SendRate)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.send()
+		case <-ctx.Done():
+			s.send()
+			return
+		}
+	}
+}
+
+func (s *sampleSender) Collect(samples []stats.Sample) {
+	s.lock.Lock()
+	s.buffer = append(s.buffer, samples...)
+	s.lock.Unlock()
+}
+
+func (s *sampleSender) send() {
+	s.lock.Lock()
+	buffer := s.buffer
+	s.buffer = nil
+	s.lock.Unlock()
+
+	if len(buffer) == 0 {
+		return
+	}
+	msg := message{Type: msgSamples, Samples: make([]sample, len(buffer))}
+	for i, smp := range buffer {
+		msg.Samples[i] = newSample(smp)
+	}
+	if err := s.Conn.send(msg); err != nil {
+		s.Logger.WithError(err).Error("Couldn't send samples to the coordinator")
+	}
+}
+
+func (s *sampleSender) String() string {
+	return "coordinator (" + s.Conn.RemoteAddr().String() + ")"
+}
@@ -0,0 +1,134 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package distributed
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	logtest "github.com/Sirupsen/logrus/hooks/test"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/guregu/null.v3"
+)
+
+// Runs an agent against a coordinator with only that one agent; returns both of their errors.
+func runTestAgent(ctx context.Context, c *Coordinator, ln net.Listener, newRunner func(arc *lib.Archive) (lib.Runner, error)) (agentErr, coordErr error) {
+	errch := make(chan error, 1)
+	go func() { errch <- runCoordinator(ctx, c, ln) }()
+
+	nc, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		return err, <-errch
+	}
+	defer func() { _ = nc.Close() }()
+
+	a := NewAgent(newRunner)
+	a.Logger, _ = logtest.NewNullLogger()
+	agentErr = a.Run(context.Background(), nc)
+	return agentErr, <-errch
+}
+
+func TestAgentRun(t *testing.T) {
+	thresholds, err := stats.NewThresholds([]string{"count<1"})
+	assert.NoError(t, err)
+	c, ln := newTestCoordinator(t, lib.Options{
+		VUs:        null.IntFrom(2),
+		VUsMax:     null.IntFrom(2),
+		Iterations: null.IntFrom(3),
+		Thresholds: map[string]stats.Thresholds{"test_metric": thresholds},
+	}, 1)
+
+	m := stats.New("test_metric", stats.Counter)
+	agentErr, coordErr := runTestAgent(context.Background(), c, ln, func(arc *lib.Archive) (lib.Runner, error) {
+		assert.Equal(t, int64(2), arc.Options.VUs.Int64)
+		return lib.RunnerFunc(func(ctx context.Context) ([]stats.Sample, error) {
+			return []stats.Sample{{Metric: m, Time: time.Now(), Value: 1}}, nil
+		}), nil
+	})
+	assert.NoError(t, agentErr, "the agent shouldn't evaluate thresholds itself")
+	assert.NoError(t, coordErr)
+
+	if assert.Contains(t, c.Engine.Metrics, "test_metric") {
+		assert.Equal(t, 6.0, c.Engine.Metrics["test_metric"].Sink.(*stats.CounterSink).Value)
+	}
+	assert.Contains(t, c.Engine.Metrics, "iterations")
+	_, vusMax := c.externalVUs()
+	assert.Equal(t, int64(2), vusMax)
+}
+
+func TestAgentRunStop(t *testing.T) {
+	c, ln := newTestCoordinator(t, lib.Options{
+		VUs:      null.IntFrom(1),
+		VUsMax:   null.IntFrom(1),
+		Duration: null.StringFrom("1h"),
+	}, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		cancel()
+	}()
+
+	m := stats.New("test_metric", stats.Counter)
+	agentErr, coordErr := runTestAgent(ctx, c, ln, func(arc *lib.Archive) (lib.Runner, error) {
+		return lib.RunnerFunc(func(ctx context.Context) ([]stats.Sample, error) {
+			time.Sleep(1 * time.Millisecond)
+			return []stats.Sample{{Metric: m, Time: time.Now(), Value: 1}}, nil
+		}), nil
+	})
+	assert.NoError(t, agentErr)
+	assert.NoError(t, coordErr)
+	assert.Contains(t, c.Engine.Metrics, "test_metric")
+}
+
+func TestAgentRunSetupData(t *testing.T) {
+	c, ln := newTestCoordinator(t, lib.Options{
+		VUs:        null.IntFrom(1),
+		VUsMax:     null.IntFrom(1),
+		Iterations: null.IntFrom(1),
+	}, 1)
+	c.Runner = &setupRunner{}
+
+	runner := &setupRunner{}
+	agentErr, coordErr := runTestAgent(context.Background(), c, ln, func(arc *lib.Archive) (lib.Runner, error) {
+		return runner, nil
+	})
+	assert.NoError(t, agentErr)
+	assert.NoError(t, coordErr)
+	assert.Equal(t, int64(0), runner.setups, "the coordinator runs setup()")
+	assert.Equal(t, int64(0), runner.teardowns, "the coordinator runs teardown()")
+	assert.Equal(t, `{"setups":1}`, string(runner.data))
+}
+
+func TestAgentRunError(t *testing.T) {
+	c, ln := newTestCoordinator(t, lib.Options{}, 1)
+	agentErr, coordErr := runTestAgent(context.Background(), c, ln, func(arc *lib.Archive) (lib.Runner, error) {
+		return nil, errors.New("no runner")
+	})
+	assert.EqualError(t, agentErr, "no runner")
+	if assert.Error(t, coordErr) {
+		assert.Contains(t, coordErr.Error(), "no runner")
+	}
+}
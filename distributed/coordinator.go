@@ -0,0 +1,317 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package distributed
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
+)
+
+// How long a connection gets to say hello before it's turned away.
+const HelloTimeout = 10 * time.Second
+
+// A Coordinator hands a test out to agents, splitting it into equal segments between them, and
+// feeds the samples they stream back into an engine, which evaluates thresholds over all of them.
+type Coordinator struct {
+	Archive   *lib.Archive
+	Engine    *lib.Engine
+	Instances int
+	Logger    *log.Logger
+
+	// If set, runs setup() before the test is handed out, and teardown() after; agents don't.
+	Runner lib.Runner
+
+	agents    []*remoteAgent
+	metrics   map[string]*stats.Metric
+	setupData []byte
+	setupDone bool
+	lock      sync.Mutex
+}
+
+type remoteAgent struct {
+	Conn    *conn
+	Segment *lib.ExecutionSegment
+
+	// As last reported by the agent; atomic.
+	vus, vusMax int64
+}
+
+// NewCoordinator makes a coordinator for a test; the engine should have no runner of its own,
+// and be made with EngineOptions. It will count the agents' VUs as its own.
+func NewCoordinator(arc *lib.Archive, engine *lib.Engine, instances int) *Coordinator {
+	c := &Coordinator{
+		Archive:   arc,
+		Engine:    engine,
+		Instances: instances,
+		Logger:    log.StandardLogger(),
+		metrics:   make(map[string]*stats.Metric),
+	}
+	engine.ExternalVUs = c.externalVUs
+	return c
+}
+
+// EngineOptions returns the options for a coordinator's engine: those that apply to samples, so
+// that setup() and teardown()'s are tagged like the agents' are, but none of the schedule.
+func EngineOptions(opts lib.Options) lib.Options {
+	return lib.Options{
+		Thresholds: opts.Thresholds,
+		Tags:       opts.Tags,
+		SystemTags: opts.SystemTags,
+	}
+}
+
+// Accept waits for Instances agents to connect on ln, which is closed once they have, and
+// assigns each of them its segment of the test.
+func (c *Coordinator) Accept(ctx context.Context, ln net.Listener) error {
+	agents, err := c.accept(ctx, ln)
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	c.agents = agents
+	c.lock.Unlock()
+	return nil
+}
+
+// Run runs setup(), if there's a Runner, then the test on the agents, and returns once they're
+// all done; call Teardown after. Cancelling ctx stops the test on all of them.
+func (c *Coordinator) Run(ctx context.Context) error {
+	c.lock.Lock()
+	agents := c.agents
+	c.lock.Unlock()
+	if len(agents) == 0 {
+		return errors.New("no agents to run the test on")
+	}
+
+	var buf bytes.Buffer
+	if err := c.Archive.Write(&buf); err != nil {
+		return err
+	}
+	if err := c.setup(ctx); err != nil {
+		for _, a := range agents {
+			_ = a.Conn.Close()
+		}
+		return err
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(agents))
+	for i, a := range agents {
+		wg.Add(1)
+		go func(i int, a *remoteAgent) {
+			defer wg.Done()
+			if err := c.runAgent(a, buf.Bytes()); err != nil {
+				errs[i] = errors.Wrapf(err, "agent %s", a.Conn.RemoteAddr())
+			}
+		}(i, a)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Logger.Debug("Stopping agents...")
+			for _, a := range agents {
+				_ = a.Conn.send(message{Type: msgStop})
+			}
+		case <-done:
+		}
+	}()
+	wg.Wait()
+	close(done)
+
+	for _, a := range agents {
+		_ = a.Conn.Close()
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Teardown runs teardown() once Run has returned, if setup() ran.
+func (c *Coordinator) Teardown() error {
+	if c.Runner == nil || !c.setupDone {
+		return nil
+	}
+
+	// The test context may well have expired by now; teardown gets its own.
+	ctx, cancel := context.WithTimeout(context.Background(), lib.TeardownTimeout)
+	defer cancel()
+
+	samples, err := c.Runner.Teardown(ctx)
+	c.Engine.ProcessSamples(samples...)
+	if err != nil {
+		return errors.Wrap(err, "teardown")
+	}
+	return nil
+}
+
+func (c *Coordinator) setup(ctx context.Context) error {
+	if c.Runner == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, lib.SetupTimeout)
+	defer cancel()
+
+	samples, err := c.Runner.Setup(ctx)
+	c.Engine.ProcessSamples(samples...)
+	if err != nil {
+		return errors.Wrap(err, "setup")
+	}
+	if h, ok := c.Runner.(lib.SetupDataHolder); ok {
+		c.setupData = h.GetSetupData()
+	}
+	c.setupDone = true
+	return nil
+}
+
+func (c *Coordinator) accept(ctx context.Context, ln net.Listener) ([]*remoteAgent, error) {
+	accepted := make(chan struct{})
+	defer close(accepted)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-accepted:
+		}
+		_ = ln.Close()
+	}()
+
+	segments := lib.SplitExecution(c.Instances)
+	agents := make([]*remoteAgent, 0, c.Instances)
+	for len(agents) < c.Instances {
+		nc, err := ln.Accept()
+		if err != nil {
+			for _, a := range agents {
+				_ = a.Conn.Close()
+			}
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+
+		conn := newConn(nc)
+		_ = nc.SetReadDeadline(time.Now().Add(HelloTimeout))
+		if msg, err := conn.receive(); err != nil || msg.Type != msgHello {
+			c.Logger.WithField("addr", nc.RemoteAddr()).Warn("Rejecting connection that isn't an agent")
+			_ = nc.Close()
+			continue
+		}
+		_ = nc.SetReadDeadline(time.Time{})
+		a := &remoteAgent{Conn: conn, Segment: segments[len(agents)]}
+		agents = append(agents, a)
+		c.Logger.WithFields(log.Fields{
+			"addr":    nc.RemoteAddr(),
+			"segment": a.Segment,
+		}).Infof("Agent connected (%d/%d)", len(agents), c.Instances)
+	}
+	return agents, nil
+}
+
+// Sends the test to an agent, and ingests its samples until it's done.
+func (c *Coordinator) runAgent(a *remoteAgent, arc []byte) error {
+	defer atomic.StoreInt64(&a.vus, 0)
+
+	if err := a.Conn.send(message{
+		Type:      msgRun,
+		Archive:   arc,
+		Segment:   a.Segment,
+		SetupData: c.setupData,
+	}); err != nil {
+		return err
+	}
+	for {
+		msg, err := a.Conn.receive()
+		if err != nil {
+			return errors.Wrap(err, "connection lost")
+		}
+		switch msg.Type {
+		case msgSamples:
+			c.ingest(a, msg.Samples)
+		case msgDone:
+			if msg.Error != "" {
+				return errors.New(msg.Error)
+			}
+			return nil
+		default:
+			c.Logger.WithField("type", msg.Type).Warn("Unexpected message from agent")
+		}
+	}
+}
+
+func (c *Coordinator) ingest(a *remoteAgent, in []sample) {
+	samples := make([]stats.Sample, 0, len(in))
+	for _, s := range in {
+		// The engine reports everyone's VUs together; see externalVUs().
+		switch s.Metric {
+		case metrics.VUs.Name:
+			atomic.StoreInt64(&a.vus, int64(s.Value))
+			continue
+		case metrics.VUsMax.Name:
+			atomic.StoreInt64(&a.vusMax, int64(s.Value))
+			continue
+		}
+		samples = append(samples, stats.Sample{
+			Metric: c.metric(s),
+			Time:   s.Time,
+			Tags:   s.Tags,
+			Value:  s.Value,
+		})
+	}
+	c.Engine.ProcessSamples(samples...)
+}
+
+// Returns the metric for a sample; the engine expects there to be only one with any name.
+func (c *Coordinator) metric(s sample) *stats.Metric {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	m, ok := c.metrics[s.Metric]
+	if !ok {
+		m = stats.New(s.Metric, s.Type, s.Contains)
+		c.metrics[s.Metric] = m
+	}
+	return m
+}
+
+func (c *Coordinator) externalVUs() (vus, vusMax int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, a := range c.agents {
+		vus += atomic.LoadInt64(&a.vus)
+		vusMax += atomic.LoadInt64(&a.vusMax)
+	}
+	return vus, vusMax
+}
@@ -0,0 +1,329 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package distributed
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	logtest "github.com/Sirupsen/logrus/hooks/test"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/guregu/null.v3"
+)
+
+func newTestCoordinator(t *testing.T, opts lib.Options, instances int) (*Coordinator, net.Listener) {
+	engine, err := lib.NewEngine(nil, EngineOptions(opts))
+	assert.NoError(t, err)
+	arc := &lib.Archive{Type: "js", Options: opts, Filename: "/script.js", Pwd: "/"}
+	c := NewCoordinator(arc, engine, instances)
+	c.Logger, _ = logtest.NewNullLogger()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	return c, ln
+}
+
+func runCoordinator(ctx context.Context, c *Coordinator, ln net.Listener) error {
+	if err := c.Accept(ctx, ln); err != nil {
+		return err
+	}
+	return c.Run(ctx)
+}
+
+// Speaks for an agent: waits for the test, then sends whatever samples fn makes for its segment.
+func runFakeAgent(t *testing.T, addr string, fn func(seg *lib.ExecutionSegment) []sample) {
+	nc, err := net.Dial("tcp", addr)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() { _ = nc.Close() }()
+
+	c := newConn(nc)
+	assert.NoError(t, c.send(message{Type: msgHello}))
+	msg, err := c.receive()
+	assert.NoError(t, err)
+	assert.Equal(t, msgRun, msg.Type)
+	arc, err := lib.ReadArchive(bytes.NewReader(msg.Archive))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "/script.js", arc.Filename)
+	}
+	assert.NoError(t, c.send(message{Type: msgSamples, Samples: fn(msg.Segment)}))
+	assert.NoError(t, c.send(message{Type: msgDone}))
+}
+
+func runFakeAgents(t *testing.T, addr string, n int, fn func(seg *lib.ExecutionSegment) []sample) {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runFakeAgent(t, addr, fn)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCoordinatorRun(t *testing.T) {
+	c, ln := newTestCoordinator(t, lib.Options{VUs: null.IntFrom(4)}, 3)
+
+	errch := make(chan error, 1)
+	go func() { errch <- runCoordinator(context.Background(), c, ln) }()
+
+	var segments []string
+	var lock sync.Mutex
+	runFakeAgents(t, ln.Addr().String(), 3, func(seg *lib.ExecutionSegment) []sample {
+		lock.Lock()
+		segments = append(segments, seg.String())
+		lock.Unlock()
+
+		vus := float64(seg.Scale(4))
+		return []sample{
+			{Metric: "test_metric", Type: stats.Counter, Time: time.Now(), Value: vus},
+			{Metric: "vus", Type: stats.Gauge, Time: time.Now(), Value: vus},
+			{Metric: "vus_max", Type: stats.Gauge, Time: time.Now(), Value: vus},
+		}
+	})
+	assert.NoError(t, <-errch)
+
+	sort.Strings(segments)
+	assert.Equal(t, []string{"0:1/3", "1/3:2/3", "2/3:1"}, segments)
+	if assert.Contains(t, c.Engine.Metrics, "test_metric") {
+		assert.Equal(t, 4.0, c.Engine.Metrics["test_metric"].Sink.(*stats.CounterSink).Value)
+	}
+	assert.NotContains(t, c.Engine.Metrics, "vus", "agents' VUs should be counted by the engine")
+
+	vus, vusMax := c.externalVUs()
+	assert.Equal(t, int64(0), vus, "agents that are done don't have VUs running")
+	assert.Equal(t, int64(4), vusMax)
+}
+
+// Counts how often setup() and teardown() run; setup() returns its count, and emits samples.
+type setupRunner struct {
+	lib.RunnerFunc
+	setups, teardowns int64
+	data              []byte
+	samples           []stats.Sample
+}
+
+func (r *setupRunner) Setup(ctx context.Context) ([]stats.Sample, error) {
+	n := atomic.AddInt64(&r.setups, 1)
+	r.data = []byte(`{"setups":` + strconv.FormatInt(n, 10) + `}`)
+	return r.samples, nil
+}
+
+func (r *setupRunner) Teardown(ctx context.Context) ([]stats.Sample, error) {
+	atomic.AddInt64(&r.teardowns, 1)
+	return nil, nil
+}
+
+func (r *setupRunner) GetSetupData() []byte     { return r.data }
+func (r *setupRunner) SetSetupData(data []byte) { r.data = data }
+
+func TestCoordinatorRunSetup(t *testing.T) {
+	c, ln := newTestCoordinator(t, lib.Options{}, 2)
+	runner := &setupRunner{}
+	c.Runner = runner
+
+	errch := make(chan error, 1)
+	go func() { errch <- runCoordinator(context.Background(), c, ln) }()
+
+	var wg sync.WaitGroup
+	setupData := make([]string, 2)
+	for i := range setupData {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			nc, err := net.Dial("tcp", ln.Addr().String())
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer func() { _ = nc.Close() }()
+			conn := newConn(nc)
+			assert.NoError(t, conn.send(message{Type: msgHello}))
+			msg, err := conn.receive()
+			assert.NoError(t, err)
+			setupData[i] = string(msg.SetupData)
+			assert.NoError(t, conn.send(message{Type: msgDone}))
+		}(i)
+	}
+	wg.Wait()
+	assert.NoError(t, <-errch)
+	assert.Equal(t, int64(0), atomic.LoadInt64(&runner.teardowns), "teardown() should wait for Teardown()")
+	assert.NoError(t, c.Teardown())
+
+	assert.Equal(t, int64(1), atomic.LoadInt64(&runner.setups))
+	assert.Equal(t, int64(1), atomic.LoadInt64(&runner.teardowns))
+	assert.Equal(t, []string{`{"setups":1}`, `{"setups":1}`}, setupData)
+}
+
+func TestCoordinatorRunSetupTags(t *testing.T) {
+	thresholds, err := stats.NewThresholds([]string{"count<10"})
+	assert.NoError(t, err)
+	c, ln := newTestCoordinator(t, lib.Options{
+		Tags:       map[string]string{"env": "test"},
+		SystemTags: []string{"status"},
+		Thresholds: map[string]stats.Thresholds{"setup_metric{env:test}": thresholds},
+	}, 1)
+	m := stats.New("setup_metric", stats.Counter)
+	c.Runner = &setupRunner{samples: []stats.Sample{
+		{Metric: m, Time: time.Now(), Tags: map[string]string{"url": "http://example.com/"}, Value: 1},
+	}}
+
+	errch := make(chan error, 1)
+	go func() { errch <- runCoordinator(context.Background(), c, ln) }()
+	runFakeAgent(t, ln.Addr().String(), func(seg *lib.ExecutionSegment) []sample { return nil })
+	assert.NoError(t, <-errch)
+
+	// Setup's samples are tagged like the agents' are.
+	assert.Contains(t, c.Engine.Metrics, "setup_metric{env:test}")
+	assert.Equal(t, map[string]string{"env": "test"}, c.Runner.(*setupRunner).samples[0].Tags)
+}
+
+func TestCoordinatorRunThresholds(t *testing.T) {
+	thresholds, err := stats.NewThresholds([]string{"count<10"})
+	assert.NoError(t, err)
+	c, ln := newTestCoordinator(t, lib.Options{
+		Thresholds: map[string]stats.Thresholds{"test_metric": thresholds},
+	}, 2)
+
+	errch := make(chan error, 1)
+	go func() { errch <- runCoordinator(context.Background(), c, ln) }()
+
+	// Each agent's samples stay below the threshold; only all of them together cross it.
+	runFakeAgents(t, ln.Addr().String(), 2, func(seg *lib.ExecutionSegment) []sample {
+		return []sample{{Metric: "test_metric", Type: stats.Counter, Time: time.Now(), Value: 6}}
+	})
+	assert.NoError(t, <-errch)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.NoError(t, c.Engine.Run(ctx))
+	assert.True(t, c.Engine.IsTainted())
+}
+
+func TestCoordinatorRunStop(t *testing.T) {
+	c, ln := newTestCoordinator(t, lib.Options{}, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errch := make(chan error, 1)
+	go func() { errch <- runCoordinator(ctx, c, ln) }()
+
+	nc, err := net.Dial("tcp", ln.Addr().String())
+	assert.NoError(t, err)
+	defer func() { _ = nc.Close() }()
+	conn := newConn(nc)
+	assert.NoError(t, conn.send(message{Type: msgHello}))
+	msg, err := conn.receive()
+	assert.NoError(t, err)
+	assert.Equal(t, msgRun, msg.Type)
+
+	cancel()
+	msg, err = conn.receive()
+	assert.NoError(t, err)
+	assert.Equal(t, msgStop, msg.Type)
+
+	// The coordinator keeps listening until the agent's done, so it gets all of its samples.
+	assert.NoError(t, conn.send(message{Type: msgSamples, Samples: []sample{
+		{Metric: "test_metric", Type: stats.Counter, Time: time.Now(), Value: 1},
+	}}))
+	assert.NoError(t, conn.send(message{Type: msgDone}))
+	assert.NoError(t, <-errch)
+	assert.Contains(t, c.Engine.Metrics, "test_metric")
+}
+
+func TestCoordinatorRunAgentError(t *testing.T) {
+	t.Run("failed", func(t *testing.T) {
+		c, ln := newTestCoordinator(t, lib.Options{}, 1)
+		errch := make(chan error, 1)
+		go func() { errch <- runCoordinator(context.Background(), c, ln) }()
+
+		nc, err := net.Dial("tcp", ln.Addr().String())
+		assert.NoError(t, err)
+		defer func() { _ = nc.Close() }()
+		conn := newConn(nc)
+		assert.NoError(t, conn.send(message{Type: msgHello}))
+		_, err = conn.receive()
+		assert.NoError(t, err)
+		assert.NoError(t, conn.send(message{Type: msgDone, Error: "setup: oops"}))
+
+		err = <-errch
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "setup: oops")
+		}
+	})
+	t.Run("disconnected", func(t *testing.T) {
+		c, ln := newTestCoordinator(t, lib.Options{}, 1)
+		errch := make(chan error, 1)
+		go func() { errch <- runCoordinator(context.Background(), c, ln) }()
+
+		nc, err := net.Dial("tcp", ln.Addr().String())
+		assert.NoError(t, err)
+		conn := newConn(nc)
+		assert.NoError(t, conn.send(message{Type: msgHello}))
+		_, err = conn.receive()
+		assert.NoError(t, err)
+		_ = nc.Close()
+
+		err = <-errch
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "connection lost")
+		}
+	})
+}
+
+func TestCoordinatorAccept(t *testing.T) {
+	t.Run("not an agent", func(t *testing.T) {
+		c, ln := newTestCoordinator(t, lib.Options{}, 1)
+		errch := make(chan error, 1)
+		go func() { errch <- runCoordinator(context.Background(), c, ln) }()
+
+		nc, err := net.Dial("tcp", ln.Addr().String())
+		assert.NoError(t, err)
+		_, err = nc.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+		assert.NoError(t, err)
+
+		runFakeAgent(t, ln.Addr().String(), func(seg *lib.ExecutionSegment) []sample {
+			assert.Equal(t, "0:1", seg.String())
+			return nil
+		})
+		assert.NoError(t, <-errch)
+	})
+	t.Run("canceled", func(t *testing.T) {
+		c, ln := newTestCoordinator(t, lib.Options{}, 2)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.Equal(t, context.Canceled, c.Accept(ctx, ln))
+	})
+}
+
+func TestCoordinatorRunNoAgents(t *testing.T) {
+	c, ln := newTestCoordinator(t, lib.Options{}, 1)
+	_ = ln.Close()
+	assert.EqualError(t, c.Run(context.Background()), "no agents to run the test on")
+}
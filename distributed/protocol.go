@@ -0,0 +1,117 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+// Package distributed runs a test across several machines: a coordinator hands the test out to
+// agents, each of which runs a segment of it, and evaluates thresholds over the samples they
+// stream back.
+//
+// Agents and the coordinator talk over a plain TCP connection, exchanging JSON messages, one per
+// line. An agent says hello once it connects, and the coordinator answers with the test to run;
+// the agent then streams its samples back, and says it's done once its segment of the test is
+// over. The coordinator can tell it to stop before that.
+package distributed
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats"
+)
+
+// Message types.
+const (
+	msgHello   = "hello"   // Agent->coordinator, on connecting.
+	msgRun     = "run"     // Coordinator->agent; carries the test.
+	msgSamples = "samples" // Agent->coordinator.
+	msgDone    = "done"    // Agent->coordinator, once its segment of the test is over.
+	msgStop    = "stop"    // Coordinator->agent, to end the test early.
+)
+
+type message struct {
+	Type string `json:"type"`
+
+	// For msgRun: the test, as written by lib.Archive.Write, the segment of it to run, and what
+	// setup() returned on the coordinator, JSON-encoded.
+	Archive   []byte                `json:"archive,omitempty"`
+	Segment   *lib.ExecutionSegment `json:"segment,omitempty"`
+	SetupData json.RawMessage       `json:"setupData,omitempty"`
+
+	// For msgSamples.
+	Samples []sample `json:"samples,omitempty"`
+
+	// For msgDone: why the test failed, if it did.
+	Error string `json:"error,omitempty"`
+}
+
+// A sample, with its metric flattened into it; the receiving end keeps one Metric per name.
+type sample struct {
+	Metric   string            `json:"metric"`
+	Type     stats.MetricType  `json:"type"`
+	Contains stats.ValueType   `json:"contains"`
+	Time     time.Time         `json:"time"`
+	Tags     map[string]string `json:"tags,omitempty"`
+	Value    float64           `json:"value"`
+}
+
+func newSample(s stats.Sample) sample {
+	return sample{
+		Metric:   s.Metric.Name,
+		Type:     s.Metric.Type,
+		Contains: s.Metric.Contains,
+		Time:     s.Time,
+		Tags:     s.Tags,
+		Value:    s.Value,
+	}
+}
+
+// A connection to the other end; messages may be sent from several goroutines at once, but
+// only one may receive them.
+type conn struct {
+	net.Conn
+
+	dec  *json.Decoder
+	enc  *json.Encoder
+	w    *bufio.Writer
+	lock sync.Mutex
+}
+
+func newConn(nc net.Conn) *conn {
+	w := bufio.NewWriter(nc)
+	return &conn{Conn: nc, dec: json.NewDecoder(bufio.NewReader(nc)), enc: json.NewEncoder(w), w: w}
+}
+
+func (c *conn) send(msg message) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := c.enc.Encode(msg); err != nil {
+		return err
+	}
+	return c.w.Flush()
+}
+
+func (c *conn) receive() (message, error) {
+	var msg message
+	err := c.dec.Decode(&msg)
+	return msg, err
+}
@@ -38,9 +38,13 @@ import (
 // You can use this to produce identical BundleInstance objects.
 type Bundle struct {
 	Filename string
+	Source   []byte
 	Program  *goja.Program
 	Options  lib.Options
 
+	// Environment variables, exposed to the script as __ENV.
+	Env map[string]string
+
 	BaseInitContext *InitContext
 }
 
@@ -49,10 +53,47 @@ type BundleInstance struct {
 	Runtime *goja.Runtime
 	Context *context.Context
 	Default goja.Callable
+
+	// All exported functions, for scenarios that specify one to run.
+	Exports map[string]goja.Callable
+}
+
+// Creates a new bundle from a source file, a filesystem and environment variables.
+func NewBundle(src *lib.SourceData, fs afero.Fs, env map[string]string) (*Bundle, error) {
+	rt := goja.New()
+	return newBundle(src, rt, NewInitContext(rt, new(context.Context), fs, loader.Dir(src.Filename)), env)
+}
+
+// Creates a new bundle from an archive. Everything the script loads is read from the archive,
+// rather than from disk or the network, and its options are the ones it was archived with.
+func NewBundleFromArchive(arc *lib.Archive) (*Bundle, error) {
+	if arc.Type != "js" {
+		return nil, errors.Errorf("expected a js archive, got: %s", arc.Type)
+	}
+
+	rt := goja.New()
+	init := NewInitContext(rt, new(context.Context), afero.NewMemMapFs(), arc.Pwd)
+	for name, data := range arc.Scripts {
+		pgm, err := compileScript(name, data)
+		if err != nil {
+			return nil, err
+		}
+		init.programs[name] = pgm
+		init.scripts[name] = data
+	}
+	for name, data := range arc.Files {
+		init.files[name] = data
+	}
+
+	bundle, err := newBundle(&lib.SourceData{Filename: arc.Filename, Data: arc.Data}, rt, init, arc.Env)
+	if err != nil {
+		return nil, err
+	}
+	bundle.Options = arc.Options
+	return bundle, nil
 }
 
-// Creates a new bundle from a source file and a filesystem.
-func NewBundle(src *lib.SourceData, fs afero.Fs) (*Bundle, error) {
+func newBundle(src *lib.SourceData, rt *goja.Runtime, init *InitContext, env map[string]string) (*Bundle, error) {
 	// Compile the main program.
 	code, _, err := compiler.Transform(string(src.Data), src.Filename)
 	if err != nil {
@@ -71,11 +112,12 @@ func NewBundle(src *lib.SourceData, fs afero.Fs) (*Bundle, error) {
 	// cachedFS := afero.NewCacheOnReadFs(fs, mirrorFS, 0)
 
 	// Make a bundle, instantiate it into a throwaway VM to populate caches.
-	rt := goja.New()
 	bundle := Bundle{
 		Filename:        src.Filename,
+		Source:          src.Data,
 		Program:         pgm,
-		BaseInitContext: NewInitContext(rt, new(context.Context), fs, loader.Dir(src.Filename)),
+		Env:             env,
+		BaseInitContext: init,
 	}
 	if err := bundle.instantiate(rt, bundle.BaseInitContext); err != nil {
 		return nil, err
@@ -88,15 +130,6 @@ func NewBundle(src *lib.SourceData, fs afero.Fs) (*Bundle, error) {
 	}
 	exports := exportsV.ToObject(rt)
 
-	// Validate the default function.
-	def := exports.Get("default")
-	if def == nil || goja.IsNull(def) || goja.IsUndefined(def) {
-		return nil, errors.New("script must export a default function")
-	}
-	if def.ExportType().Kind() != reflect.Func {
-		return nil, errors.New("default export must be a function")
-	}
-
 	// Extract exported options.
 	optV := exports.Get("options")
 	if optV != nil && !goja.IsNull(optV) && !goja.IsUndefined(optV) {
@@ -109,12 +142,66 @@ func NewBundle(src *lib.SourceData, fs afero.Fs) (*Bundle, error) {
 		}
 	}
 
+	// Validate the functions scenarios want to run; the default function is only required if
+	// something is going to run it.
+	needsDefault := len(bundle.Options.Scenarios) == 0
+	for name, sc := range bundle.Options.Scenarios {
+		if !sc.Exec.Valid || sc.Exec.String == "" || sc.Exec.String == "default" {
+			needsDefault = true
+			continue
+		}
+		if _, ok := goja.AssertFunction(exports.Get(sc.Exec.String)); !ok {
+			return nil, errors.Errorf("scenario %s: exec function %s is not exported", name, sc.Exec.String)
+		}
+	}
+
+	// Validate the default function.
+	def := exports.Get("default")
+	if needsDefault && (def == nil || goja.IsNull(def) || goja.IsUndefined(def)) {
+		return nil, errors.New("script must export a default function")
+	}
+	if def != nil && !goja.IsNull(def) && !goja.IsUndefined(def) && def.ExportType().Kind() != reflect.Func {
+		return nil, errors.New("default export must be a function")
+	}
+
+	// Validate setup(), teardown() and handleSummary(), which are optional.
+	for _, name := range []string{"setup", "teardown", "handleSummary"} {
+		fn := exports.Get(name)
+		if fn == nil || goja.IsNull(fn) || goja.IsUndefined(fn) {
+			continue
+		}
+		if _, ok := goja.AssertFunction(fn); !ok {
+			return nil, errors.Errorf("exported %s must be a function", name)
+		}
+	}
+
 	// Swap out the init context's filesystem for the in-memory cache.
 	// bundle.InitContext.fs = mirrorFS
 
 	return &bundle, nil
 }
 
+// Makes an archive of the bundle, containing everything that was loaded while instantiating it.
+func (b *Bundle) MakeArchive() *lib.Archive {
+	arc := &lib.Archive{
+		Type:     "js",
+		Options:  b.Options,
+		Env:      b.Env,
+		Filename: b.Filename,
+		Pwd:      b.BaseInitContext.pwd,
+		Data:     b.Source,
+		Scripts:  make(map[string][]byte, len(b.BaseInitContext.scripts)),
+		Files:    make(map[string][]byte, len(b.BaseInitContext.files)),
+	}
+	for name, data := range b.BaseInitContext.scripts {
+		arc.Scripts[name] = data
+	}
+	for name, data := range b.BaseInitContext.files {
+		arc.Files[name] = data
+	}
+	return arc
+}
+
 // Instantiates a new runtime from this bundle.
 func (b *Bundle) Instantiate() (*BundleInstance, error) {
 	// Placeholder for a real context.
@@ -132,10 +219,18 @@ func (b *Bundle) Instantiate() (*BundleInstance, error) {
 	exports := rt.Get("exports").ToObject(rt)
 	def, _ := goja.AssertFunction(exports.Get("default"))
 
+	fns := make(map[string]goja.Callable)
+	for _, k := range exports.Keys() {
+		if fn, ok := goja.AssertFunction(exports.Get(k)); ok {
+			fns[k] = fn
+		}
+	}
+
 	return &BundleInstance{
 		Runtime: rt,
 		Context: ctxPtr,
 		Default: def,
+		Exports: fns,
 	}, nil
 }
 
@@ -151,7 +246,14 @@ func (b *Bundle) instantiate(rt *goja.Runtime, init *InitContext) error {
 	_ = module.Set("exports", exports)
 	rt.Set("module", module)
 
-	*init.ctxPtr = common.WithRuntime(context.Background(), rt)
+	// Every instance gets its own copy, so VUs can't see each other's changes to it.
+	env := rt.NewObject()
+	for k, v := range b.Env {
+		_ = env.Set(k, v)
+	}
+	rt.Set("__ENV", env)
+
+	*init.ctxPtr = common.WithFileReader(common.WithRuntime(context.Background(), rt), init.readLocalFile)
 	unbindInit := common.BindToGlobal(rt, common.Bind(rt, init, init.ctxPtr))
 	if _, err := rt.RunProgram(b.Program); err != nil {
 		return err
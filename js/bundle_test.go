@@ -37,28 +37,28 @@ func TestNewBundle(t *testing.T) {
 		_, err := NewBundle(&lib.SourceData{
 			Filename: "/script.js",
 			Data:     []byte(``),
-		}, afero.NewMemMapFs())
+		}, afero.NewMemMapFs(), nil)
 		assert.EqualError(t, err, "script must export a default function")
 	})
 	t.Run("Invalid", func(t *testing.T) {
 		_, err := NewBundle(&lib.SourceData{
 			Filename: "/script.js",
 			Data:     []byte{0x00},
-		}, afero.NewMemMapFs())
+		}, afero.NewMemMapFs(), nil)
 		assert.EqualError(t, err, "Transform: SyntaxError: /script.js: Unexpected character '\x00' (1:0)\n> 1 | \x00\n    | ^ at <eval>:2:26853(114)")
 	})
 	t.Run("Error", func(t *testing.T) {
 		_, err := NewBundle(&lib.SourceData{
 			Filename: "/script.js",
 			Data:     []byte(`throw new Error("aaaa");`),
-		}, afero.NewMemMapFs())
+		}, afero.NewMemMapFs(), nil)
 		assert.EqualError(t, err, "Error: aaaa at /script.js:1:20(3)")
 	})
 	t.Run("InvalidExports", func(t *testing.T) {
 		_, err := NewBundle(&lib.SourceData{
 			Filename: "/script.js",
 			Data:     []byte(`exports = null`),
-		}, afero.NewMemMapFs())
+		}, afero.NewMemMapFs(), nil)
 		assert.EqualError(t, err, "exports must be an object")
 	})
 	t.Run("DefaultUndefined", func(t *testing.T) {
@@ -67,7 +67,7 @@ func TestNewBundle(t *testing.T) {
 			Data: []byte(`
 				export default undefined;
 			`),
-		}, afero.NewMemMapFs())
+		}, afero.NewMemMapFs(), nil)
 		assert.EqualError(t, err, "script must export a default function")
 	})
 	t.Run("DefaultNull", func(t *testing.T) {
@@ -76,7 +76,7 @@ func TestNewBundle(t *testing.T) {
 			Data: []byte(`
 				export default null;
 			`),
-		}, afero.NewMemMapFs())
+		}, afero.NewMemMapFs(), nil)
 		assert.EqualError(t, err, "script must export a default function")
 	})
 	t.Run("DefaultWrongType", func(t *testing.T) {
@@ -85,21 +85,21 @@ func TestNewBundle(t *testing.T) {
 			Data: []byte(`
 				export default 12345;
 			`),
-		}, afero.NewMemMapFs())
+		}, afero.NewMemMapFs(), nil)
 		assert.EqualError(t, err, "default export must be a function")
 	})
 	t.Run("Minimal", func(t *testing.T) {
 		_, err := NewBundle(&lib.SourceData{
 			Filename: "/script.js",
 			Data:     []byte(`export default function() {};`),
-		}, afero.NewMemMapFs())
+		}, afero.NewMemMapFs(), nil)
 		assert.NoError(t, err)
 	})
 	t.Run("stdin", func(t *testing.T) {
 		b, err := NewBundle(&lib.SourceData{
 			Filename: "-",
 			Data:     []byte(`export default function() {};`),
-		}, afero.NewMemMapFs())
+		}, afero.NewMemMapFs(), nil)
 		if assert.NoError(t, err) {
 			assert.Equal(t, "-", b.Filename)
 			assert.Equal(t, "/", b.BaseInitContext.pwd)
@@ -113,7 +113,7 @@ func TestNewBundle(t *testing.T) {
 					export let options = {};
 					export default function() {};
 				`),
-			}, afero.NewMemMapFs())
+			}, afero.NewMemMapFs(), nil)
 			assert.NoError(t, err)
 		})
 		t.Run("Invalid", func(t *testing.T) {
@@ -131,7 +131,7 @@ func TestNewBundle(t *testing.T) {
 							export let options = %s;
 							export default function() {};
 						`, data.Expr)),
-					}, afero.NewMemMapFs())
+					}, afero.NewMemMapFs(), nil)
 					assert.EqualError(t, err, data.Error)
 				})
 			}
@@ -146,7 +146,7 @@ func TestNewBundle(t *testing.T) {
 					};
 					export default function() {};
 				`),
-			}, afero.NewMemMapFs())
+			}, afero.NewMemMapFs(), nil)
 			if assert.NoError(t, err) {
 				assert.Equal(t, null.BoolFrom(true), b.Options.Paused)
 			}
@@ -160,7 +160,7 @@ func TestNewBundle(t *testing.T) {
 					};
 					export default function() {};
 				`),
-			}, afero.NewMemMapFs())
+			}, afero.NewMemMapFs(), nil)
 			if assert.NoError(t, err) {
 				assert.Equal(t, null.IntFrom(100), b.Options.VUs)
 			}
@@ -174,7 +174,7 @@ func TestNewBundle(t *testing.T) {
 					};
 					export default function() {};
 				`),
-			}, afero.NewMemMapFs())
+			}, afero.NewMemMapFs(), nil)
 			if assert.NoError(t, err) {
 				assert.Equal(t, null.IntFrom(100), b.Options.VUsMax)
 			}
@@ -188,7 +188,7 @@ func TestNewBundle(t *testing.T) {
 					};
 					export default function() {};
 				`),
-			}, afero.NewMemMapFs())
+			}, afero.NewMemMapFs(), nil)
 			if assert.NoError(t, err) {
 				assert.Equal(t, null.StringFrom("10s"), b.Options.Duration)
 			}
@@ -202,7 +202,7 @@ func TestNewBundle(t *testing.T) {
 					};
 					export default function() {};
 				`),
-			}, afero.NewMemMapFs())
+			}, afero.NewMemMapFs(), nil)
 			if assert.NoError(t, err) {
 				assert.Equal(t, null.IntFrom(100), b.Options.Iterations)
 			}
@@ -216,7 +216,7 @@ func TestNewBundle(t *testing.T) {
 					};
 					export default function() {};
 				`),
-			}, afero.NewMemMapFs())
+			}, afero.NewMemMapFs(), nil)
 			if assert.NoError(t, err) {
 				assert.Len(t, b.Options.Stages, 0)
 			}
@@ -232,7 +232,7 @@ func TestNewBundle(t *testing.T) {
 						};
 						export default function() {};
 					`),
-				}, afero.NewMemMapFs())
+				}, afero.NewMemMapFs(), nil)
 				if assert.NoError(t, err) {
 					if assert.Len(t, b.Options.Stages, 1) {
 						assert.Equal(t, lib.Stage{}, b.Options.Stages[0])
@@ -250,7 +250,7 @@ func TestNewBundle(t *testing.T) {
 						};
 						export default function() {};
 					`),
-				}, afero.NewMemMapFs())
+				}, afero.NewMemMapFs(), nil)
 				if assert.NoError(t, err) {
 					if assert.Len(t, b.Options.Stages, 1) {
 						assert.Equal(t, lib.Stage{Target: null.IntFrom(10)}, b.Options.Stages[0])
@@ -268,7 +268,7 @@ func TestNewBundle(t *testing.T) {
 						};
 						export default function() {};
 					`),
-				}, afero.NewMemMapFs())
+				}, afero.NewMemMapFs(), nil)
 				if assert.NoError(t, err) {
 					if assert.Len(t, b.Options.Stages, 1) {
 						assert.Equal(t, lib.Stage{Duration: 10 * time.Second}, b.Options.Stages[0])
@@ -286,7 +286,7 @@ func TestNewBundle(t *testing.T) {
 						};
 						export default function() {};
 					`),
-				}, afero.NewMemMapFs())
+				}, afero.NewMemMapFs(), nil)
 				if assert.NoError(t, err) {
 					if assert.Len(t, b.Options.Stages, 1) {
 						assert.Equal(t, lib.Stage{Duration: 10 * time.Second, Target: null.IntFrom(10)}, b.Options.Stages[0])
@@ -305,7 +305,7 @@ func TestNewBundle(t *testing.T) {
 						};
 						export default function() {};
 					`),
-				}, afero.NewMemMapFs())
+				}, afero.NewMemMapFs(), nil)
 				if assert.NoError(t, err) {
 					if assert.Len(t, b.Options.Stages, 2) {
 						assert.Equal(t, lib.Stage{Duration: 10 * time.Second, Target: null.IntFrom(10)}, b.Options.Stages[0])
@@ -323,7 +323,7 @@ func TestNewBundle(t *testing.T) {
 					};
 					export default function() {};
 				`),
-			}, afero.NewMemMapFs())
+			}, afero.NewMemMapFs(), nil)
 			if assert.NoError(t, err) {
 				assert.Equal(t, null.BoolFrom(true), b.Options.Linger)
 			}
@@ -337,7 +337,7 @@ func TestNewBundle(t *testing.T) {
 					};
 					export default function() {};
 				`),
-			}, afero.NewMemMapFs())
+			}, afero.NewMemMapFs(), nil)
 			if assert.NoError(t, err) {
 				assert.Equal(t, null.BoolFrom(true), b.Options.NoUsageReport)
 			}
@@ -351,7 +351,7 @@ func TestNewBundle(t *testing.T) {
 					};
 					export default function() {};
 				`),
-			}, afero.NewMemMapFs())
+			}, afero.NewMemMapFs(), nil)
 			if assert.NoError(t, err) {
 				assert.Equal(t, null.IntFrom(10), b.Options.MaxRedirects)
 			}
@@ -365,7 +365,7 @@ func TestNewBundle(t *testing.T) {
 					};
 					export default function() {};
 				`),
-			}, afero.NewMemMapFs())
+			}, afero.NewMemMapFs(), nil)
 			if assert.NoError(t, err) {
 				assert.Equal(t, null.BoolFrom(true), b.Options.InsecureSkipTLSVerify)
 			}
@@ -381,13 +381,68 @@ func TestNewBundle(t *testing.T) {
 					};
 					export default function() {};
 				`),
-			}, afero.NewMemMapFs())
+			}, afero.NewMemMapFs(), nil)
 			if assert.NoError(t, err) {
 				if assert.Len(t, b.Options.Thresholds["http_req_duration"].Thresholds, 1) {
 					assert.Equal(t, "avg<100", b.Options.Thresholds["http_req_duration"].Thresholds[0].Source)
 				}
 			}
 		})
+		t.Run("Scenarios", func(t *testing.T) {
+			b, err := NewBundle(&lib.SourceData{
+				Filename: "/script.js",
+				Data: []byte(`
+					export let options = {
+						scenarios: {
+							browse: { vus: 50, duration: "1m" },
+							api: { vus: 10, rate: 200, startTime: "30s", duration: "1m", exec: "api", tags: { kind: "api" } },
+						},
+					};
+					export function api() {};
+					export default function() {};
+				`),
+			}, afero.NewMemMapFs(), nil)
+			if assert.NoError(t, err) && assert.Len(t, b.Options.Scenarios, 2) {
+				assert.Equal(t, lib.Scenario{
+					VUs:       null.IntFrom(10),
+					Rate:      null.IntFrom(200),
+					StartTime: 30 * time.Second,
+					Duration:  1 * time.Minute,
+					Exec:      null.StringFrom("api"),
+					Tags:      map[string]string{"kind": "api"},
+				}, b.Options.Scenarios["api"])
+			}
+
+			t.Run("NoDefault", func(t *testing.T) {
+				_, err := NewBundle(&lib.SourceData{
+					Filename: "/script.js",
+					Data: []byte(`
+						export let options = { scenarios: { api: { vus: 1, duration: "1m", exec: "api" } } };
+						export function api() {};
+					`),
+				}, afero.NewMemMapFs(), nil)
+				assert.NoError(t, err)
+			})
+			t.Run("NoDefaultNoExec", func(t *testing.T) {
+				_, err := NewBundle(&lib.SourceData{
+					Filename: "/script.js",
+					Data: []byte(`
+						export let options = { scenarios: { api: { vus: 1, duration: "1m" } } };
+					`),
+				}, afero.NewMemMapFs(), nil)
+				assert.EqualError(t, err, "script must export a default function")
+			})
+			t.Run("ExecMissing", func(t *testing.T) {
+				_, err := NewBundle(&lib.SourceData{
+					Filename: "/script.js",
+					Data: []byte(`
+						export let options = { scenarios: { api: { vus: 1, duration: "1m", exec: "nope" } } };
+						export default function() {};
+					`),
+				}, afero.NewMemMapFs(), nil)
+				assert.EqualError(t, err, "scenario api: exec function nope is not exported")
+			})
+		})
 	})
 }
 
@@ -398,7 +453,7 @@ func TestBundleInstantiate(t *testing.T) {
 		let val = true;
 		export default function() { return val; }
 		`),
-	}, afero.NewMemMapFs())
+	}, afero.NewMemMapFs(), nil)
 	if !assert.NoError(t, err) {
 		return
 	}
@@ -422,4 +477,141 @@ func TestBundleInstantiate(t *testing.T) {
 			assert.Equal(t, false, v.Export())
 		}
 	})
+
+	t.Run("Exports", func(t *testing.T) {
+		assert.Contains(t, bi.Exports, "default")
+	})
+}
+
+func TestBundleEnv(t *testing.T) {
+	b, err := NewBundle(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+		export let options = { vus: parseInt(__ENV.VUS) };
+		export default function() {
+			let v = __ENV.TEST_VAR;
+			__ENV.TEST_VAR = "changed";
+			return v;
+		}
+		`),
+	}, afero.NewMemMapFs(), map[string]string{"VUS": "3", "TEST_VAR": "hi"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, null.IntFrom(3), b.Options.VUs)
+	assert.Equal(t, map[string]string{"VUS": "3", "TEST_VAR": "hi"}, b.MakeArchive().Env)
+
+	// Each instance has its own __ENV, so changes don't leak between them.
+	for i := 0; i < 2; i++ {
+		bi, err := b.Instantiate()
+		if !assert.NoError(t, err) {
+			return
+		}
+		v, err := bi.Default(goja.Undefined())
+		if assert.NoError(t, err) {
+			assert.Equal(t, "hi", v.Export())
+		}
+	}
+}
+
+func TestBundleArchive(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	assert.NoError(t, fs.MkdirAll("/path/to", 0755))
+	assert.NoError(t, afero.WriteFile(fs, "/path/to/lib.js", []byte(`exports.msg = "hi";`), 0644))
+	assert.NoError(t, afero.WriteFile(fs, "/path/to/file.txt", []byte(`file contents`), 0644))
+
+	b, err := NewBundle(&lib.SourceData{
+		Filename: "/path/to/script.js",
+		Data: []byte(`
+			import { msg } from "./lib.js";
+			let file = open("./file.txt");
+			export let options = { vus: 5 };
+			export default function() { return msg + ": " + file; }
+		`),
+	}, fs, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	b.Options = b.Options.Apply(lib.Options{Iterations: null.IntFrom(10)})
+
+	arc := b.MakeArchive()
+	assert.Equal(t, "js", arc.Type)
+	assert.Equal(t, "/path/to/script.js", arc.Filename)
+	assert.Equal(t, "/path/to", arc.Pwd)
+	assert.Equal(t, map[string][]byte{"/path/to/lib.js": []byte(`exports.msg = "hi";`)}, arc.Scripts)
+	assert.Equal(t, map[string][]byte{"/path/to/file.txt": []byte(`file contents`)}, arc.Files)
+	assert.Equal(t, null.IntFrom(5), arc.Options.VUs)
+	assert.Equal(t, null.IntFrom(10), arc.Options.Iterations)
+
+	b2, err := NewBundleFromArchive(arc)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, arc.Options, b2.Options)
+	assert.Equal(t, arc, b2.MakeArchive())
+
+	bi, err := b2.Instantiate()
+	if !assert.NoError(t, err) {
+		return
+	}
+	v, err := bi.Default(goja.Undefined())
+	if assert.NoError(t, err) {
+		assert.Equal(t, "hi: file contents", v.Export())
+	}
+
+	t.Run("ProtoFiles", func(t *testing.T) {
+		proto := []byte(`
+			syntax = "proto3";
+			package test;
+			message Ping { string msg = 1; }
+			service Pinger { rpc Ping(test.Ping) returns (test.Ping); }
+		`)
+		fs := afero.NewMemMapFs()
+		assert.NoError(t, fs.MkdirAll("/path/to/protos", 0755))
+		assert.NoError(t, afero.WriteFile(fs, "/path/to/protos/test.proto", proto, 0644))
+
+		b, err := NewBundle(&lib.SourceData{
+			Filename: "/path/to/script.js",
+			Data: []byte(`
+				import grpc from "k6/grpc";
+				let client = new grpc.Client();
+				let methods = client.load(["protos"], "test.proto");
+				export default function() { return methods.join(","); }
+			`),
+		}, fs, nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		arc := b.MakeArchive()
+		assert.Equal(t, map[string][]byte{"/path/to/protos/test.proto": proto}, arc.Files)
+
+		// The archive's bundle reads the file from the archive, not the filesystem.
+		b2, err := NewBundleFromArchive(arc)
+		if !assert.NoError(t, err) {
+			return
+		}
+		bi, err := b2.Instantiate()
+		if !assert.NoError(t, err) {
+			return
+		}
+		v, err := bi.Default(goja.Undefined())
+		if assert.NoError(t, err) {
+			assert.Equal(t, "/test.Pinger/Ping", v.Export())
+		}
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		_, err := NewBundleFromArchive(&lib.Archive{
+			Type:     "js",
+			Filename: "/path/to/script.js",
+			Pwd:      "/path/to",
+			Data:     []byte(`open("./other.txt"); export default function() {}`),
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("WrongType", func(t *testing.T) {
+		_, err := NewBundleFromArchive(&lib.Archive{Type: "url"})
+		assert.EqualError(t, err, "expected a js archive, got: url")
+	})
 }
@@ -31,8 +31,12 @@ type ctxKey int
 const (
 	ctxKeyState ctxKey = iota
 	ctxKeyRuntime
+	ctxKeyFileReader
 )
 
+// A FileReader reads local files in the init context, for modules that load files of their own.
+type FileReader func(filename string) ([]byte, error)
+
 func WithState(ctx context.Context, state *State) context.Context {
 	return context.WithValue(ctx, ctxKeyState, state)
 }
@@ -56,3 +60,17 @@ func GetRuntime(ctx context.Context) *goja.Runtime {
 	}
 	return v.(*goja.Runtime)
 }
+
+// WithFileReader attaches the init context's file reader; files read through it are resolved
+// against the script's directory, and included in archives, like open()ed ones.
+func WithFileReader(ctx context.Context, fn FileReader) context.Context {
+	return context.WithValue(ctx, ctxKeyFileReader, fn)
+}
+
+func GetFileReader(ctx context.Context) FileReader {
+	v := ctx.Value(ctxKeyFileReader)
+	if v == nil {
+		return nil
+	}
+	return v.(FileReader)
+}
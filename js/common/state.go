@@ -22,6 +22,7 @@ package common
 
 import (
 	"net/http"
+	"net/http/cookiejar"
 
 	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/stats"
@@ -38,6 +39,9 @@ type State struct {
 	// Networking equipment.
 	HTTPTransport http.RoundTripper
 
+	// The VU's cookie jar; outlives the iteration, but not the VU.
+	CookieJar *cookiejar.Jar
+
 	// Sample buffer, emitted at the end of the iteration.
 	Samples []stats.Sample
 }
@@ -59,7 +59,7 @@ func TestConsole(t *testing.T) {
 							`export default function() { console.%s(%s); }`,
 							name, args,
 						)),
-					}, afero.NewMemMapFs())
+					}, afero.NewMemMapFs(), nil)
 					assert.NoError(t, err)
 
 					vu, err := r.newVU()
@@ -24,6 +24,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/dop251/goja"
@@ -46,8 +48,10 @@ type InitContext struct {
 	fs  afero.Fs
 	pwd string
 
-	// Cache of loaded programs and files.
+	// Cache of loaded programs and files. The sources of the programs are kept in scripts, so
+	// the whole thing can be archived.
 	programs map[string]*goja.Program
+	scripts  map[string][]byte
 	files    map[string][]byte
 
 	// Console object.
@@ -62,6 +66,7 @@ func NewInitContext(rt *goja.Runtime, ctxPtr *context.Context, fs afero.Fs, pwd
 		pwd:     pwd,
 
 		programs: make(map[string]*goja.Program),
+		scripts:  make(map[string][]byte),
 		files:    make(map[string][]byte),
 
 		Console: NewConsole(),
@@ -77,6 +82,7 @@ func newBoundInitContext(base *InitContext, ctxPtr *context.Context, rt *goja.Ru
 		pwd: base.pwd,
 
 		programs: base.programs,
+		scripts:  base.scripts,
 		files:    base.files,
 
 		Console: base.Console,
@@ -137,15 +143,12 @@ func (i *InitContext) requireFile(name string) (goja.Value, error) {
 		if err != nil {
 			return goja.Undefined(), err
 		}
-		src, _, err := compiler.Transform(string(data.Data), data.Filename)
-		if err != nil {
-			return goja.Undefined(), err
-		}
-		pgm_, err := goja.Compile(data.Filename, src, true)
+		pgm_, err := compileScript(data.Filename, data.Data)
 		if err != nil {
 			return goja.Undefined(), err
 		}
 		i.programs[filename] = pgm_
+		i.scripts[filename] = data.Data
 		pgm = pgm_
 	}
 
@@ -159,16 +162,71 @@ func (i *InitContext) requireFile(name string) (goja.Value, error) {
 	return module.Get("exports"), nil
 }
 
-func (i *InitContext) Open(name string) (string, error) {
+// Transforms a script into ES5 and compiles it.
+func compileScript(filename string, data []byte) (*goja.Program, error) {
+	src, _, err := compiler.Transform(string(data), filename)
+	if err != nil {
+		return nil, err
+	}
+	return goja.Compile(filename, src, true)
+}
+
+// Opens a file, returning its contents as a string. Pass "b" as the mode to get them as an array
+// of bytes instead, eg. for uploading binary files.
+func (i *InitContext) Open(name string, args ...string) (goja.Value, error) {
+	binary := false
+	if len(args) > 0 {
+		switch args[0] {
+		case "b":
+			binary = true
+		case "":
+		default:
+			return nil, errors.New(fmt.Sprintf("unknown open() mode: %s", args[0]))
+		}
+	}
+
 	filename := loader.Resolve(i.pwd, name)
 	data, ok := i.files[filename]
 	if !ok {
 		data_, err := loader.Load(i.fs, i.pwd, name)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 		i.files[filename] = data_.Data
 		data = data_.Data
 	}
-	return string(data), nil
+
+	if binary {
+		// Copy it, so scripts can't modify the cached contents.
+		b := make([]byte, len(data))
+		copy(b, data)
+		return i.runtime.ToValue(b), nil
+	}
+	return i.runtime.ToValue(string(data)), nil
+}
+
+// Reads a local file for a module, eg. a .proto file; relative names are resolved against the
+// current script's directory, not the working directory. Files are cached the way open()ed ones
+// are, so they're archived, and VUs, which have no filesystem, can read them again.
+func (i *InitContext) readLocalFile(name string) ([]byte, error) {
+	filename := name
+	if !filepath.IsAbs(filename) {
+		if i.pwd == "" || i.pwd[0] != '/' {
+			return nil, errors.New(fmt.Sprintf("origin (%s) not allowed to load local file: %s", i.pwd, name))
+		}
+		filename = filepath.Join(i.pwd, filename)
+	}
+
+	if data, ok := i.files[filename]; ok {
+		return data, nil
+	}
+	if i.fs == nil {
+		return nil, &os.PathError{Op: "open", Path: filename, Err: os.ErrNotExist}
+	}
+	data, err := afero.ReadFile(i.fs, filename)
+	if err != nil {
+		return nil, err
+	}
+	i.files[filename] = data
+	return data, nil
 }
@@ -37,7 +37,7 @@ func TestInitContextRequire(t *testing.T) {
 			_, err := NewBundle(&lib.SourceData{
 				Filename: "/script.js",
 				Data:     []byte(`import "k6/NONEXISTENT";`),
-			}, afero.NewMemMapFs())
+			}, afero.NewMemMapFs(), nil)
 			assert.EqualError(t, err, "GoError: unknown builtin module: k6/NONEXISTENT")
 		})
 
@@ -50,7 +50,7 @@ func TestInitContextRequire(t *testing.T) {
 					export let dummy = "abc123";
 					export default function() {}
 				`),
-			}, afero.NewMemMapFs())
+			}, afero.NewMemMapFs(), nil)
 			if !assert.NoError(t, err, "bundle error") {
 				return
 			}
@@ -82,7 +82,7 @@ func TestInitContextRequire(t *testing.T) {
 						export let dummy = "abc123";
 						export default function() {}
 					`),
-				}, afero.NewMemMapFs())
+				}, afero.NewMemMapFs(), nil)
 				if !assert.NoError(t, err) {
 					return
 				}
@@ -110,7 +110,7 @@ func TestInitContextRequire(t *testing.T) {
 			_, err := NewBundle(&lib.SourceData{
 				Filename: "/script.js",
 				Data:     []byte(`import "/nonexistent.js"; export default function() {}`),
-			}, afero.NewMemMapFs())
+			}, afero.NewMemMapFs(), nil)
 			assert.EqualError(t, err, "GoError: open /nonexistent.js: file does not exist")
 		})
 		t.Run("Invalid", func(t *testing.T) {
@@ -119,7 +119,7 @@ func TestInitContextRequire(t *testing.T) {
 			_, err := NewBundle(&lib.SourceData{
 				Filename: "/script.js",
 				Data:     []byte(`import "/file.js"; export default function() {}`),
-			}, fs)
+			}, fs, nil)
 			assert.EqualError(t, err, "SyntaxError: /file.js: Unexpected character '\x00' (1:0)\n> 1 | \x00\n    | ^ at <eval>:2:26853(114)")
 		})
 		t.Run("Error", func(t *testing.T) {
@@ -128,7 +128,7 @@ func TestInitContextRequire(t *testing.T) {
 			_, err := NewBundle(&lib.SourceData{
 				Filename: "/script.js",
 				Data:     []byte(`import "/file.js"; export default function() {}`),
-			}, fs)
+			}, fs, nil)
 			assert.EqualError(t, err, "Error: aaaa at /file.js:1:20(3)")
 		})
 
@@ -195,7 +195,7 @@ func TestInitContextRequire(t *testing.T) {
 						assert.NoError(t, fs.MkdirAll(filepath.Dir(data.LibPath), 0755))
 						assert.NoError(t, afero.WriteFile(fs, data.LibPath, []byte(lib), 0644))
 
-						b, err := NewBundle(src, fs)
+						b, err := NewBundle(src, fs, nil)
 						if !assert.NoError(t, err) {
 							return
 						}
@@ -231,7 +231,7 @@ func TestInitContextOpen(t *testing.T) {
 				export let data = open("%s");
 				export default function() {}
 				`, loadPath)),
-			}, fs)
+			}, fs, nil)
 			if !assert.NoError(t, err) {
 				return
 			}
@@ -245,11 +245,39 @@ func TestInitContextOpen(t *testing.T) {
 		})
 	}
 
+	t.Run("Binary", func(t *testing.T) {
+		b, err := NewBundle(&lib.SourceData{
+			Filename: "/path/to/script.js",
+			Data: []byte(`
+			export let data = open("/path/to/file.txt", "b");
+			export default function() {}
+			`),
+		}, fs, nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		bi, err := b.Instantiate()
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		assert.Equal(t, []byte("hi!"), bi.Runtime.Get("data").Export())
+	})
+
+	t.Run("InvalidMode", func(t *testing.T) {
+		_, err := NewBundle(&lib.SourceData{
+			Filename: "/path/to/script.js",
+			Data:     []byte(`open("/path/to/file.txt", "x"); export default function() {}`),
+		}, fs, nil)
+		assert.EqualError(t, err, "GoError: unknown open() mode: x")
+	})
+
 	t.Run("Nonexistent", func(t *testing.T) {
 		_, err := NewBundle(&lib.SourceData{
 			Filename: "/script.js",
 			Data:     []byte(`open("/nonexistent.txt"); export default function() {}`),
-		}, fs)
+		}, fs, nil)
 		assert.EqualError(t, err, "GoError: open /nonexistent.txt: file does not exist")
 	})
 }
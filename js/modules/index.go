@@ -23,9 +23,11 @@ package modules
 import (
 	"github.com/loadimpact/k6/js/modules/k6"
 	"github.com/loadimpact/k6/js/modules/k6/crypto"
+	"github.com/loadimpact/k6/js/modules/k6/grpc"
 	"github.com/loadimpact/k6/js/modules/k6/html"
 	"github.com/loadimpact/k6/js/modules/k6/http"
 	"github.com/loadimpact/k6/js/modules/k6/metrics"
+	"github.com/loadimpact/k6/js/modules/k6/ws"
 )
 
 // Index of module implementations.
@@ -35,4 +37,6 @@ var Index = map[string]interface{}{
 	"k6/http":    &http.HTTP{},
 	"k6/metrics": &metrics.Metrics{},
 	"k6/html":    &html.HTML{},
+	"k6/ws":      &ws.WS{},
+	"k6/grpc":    grpc.New(),
 }
@@ -0,0 +1,407 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/jhump/protoreflect/dynamic/grpcdynamic"
+	"github.com/jhump/protoreflect/grpcreflect"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/netext"
+	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+)
+
+// Used for both connecting and invoking unless overridden by the script.
+const defaultTimeout = 60 * time.Second
+
+type GRPC struct {
+	StatusOK                 codes.Code `js:"StatusOK"`
+	StatusCanceled           codes.Code `js:"StatusCanceled"`
+	StatusUnknown            codes.Code `js:"StatusUnknown"`
+	StatusInvalidArgument    codes.Code `js:"StatusInvalidArgument"`
+	StatusDeadlineExceeded   codes.Code `js:"StatusDeadlineExceeded"`
+	StatusNotFound           codes.Code `js:"StatusNotFound"`
+	StatusAlreadyExists      codes.Code `js:"StatusAlreadyExists"`
+	StatusPermissionDenied   codes.Code `js:"StatusPermissionDenied"`
+	StatusResourceExhausted  codes.Code `js:"StatusResourceExhausted"`
+	StatusFailedPrecondition codes.Code `js:"StatusFailedPrecondition"`
+	StatusAborted            codes.Code `js:"StatusAborted"`
+	StatusOutOfRange         codes.Code `js:"StatusOutOfRange"`
+	StatusUnimplemented      codes.Code `js:"StatusUnimplemented"`
+	StatusInternal           codes.Code `js:"StatusInternal"`
+	StatusUnavailable        codes.Code `js:"StatusUnavailable"`
+	StatusDataLoss           codes.Code `js:"StatusDataLoss"`
+	StatusUnauthenticated    codes.Code `js:"StatusUnauthenticated"`
+}
+
+// New returns the module, with its status code constants filled in.
+func New() *GRPC {
+	return &GRPC{
+		StatusOK:                 codes.OK,
+		StatusCanceled:           codes.Canceled,
+		StatusUnknown:            codes.Unknown,
+		StatusInvalidArgument:    codes.InvalidArgument,
+		StatusDeadlineExceeded:   codes.DeadlineExceeded,
+		StatusNotFound:           codes.NotFound,
+		StatusAlreadyExists:      codes.AlreadyExists,
+		StatusPermissionDenied:   codes.PermissionDenied,
+		StatusResourceExhausted:  codes.ResourceExhausted,
+		StatusFailedPrecondition: codes.FailedPrecondition,
+		StatusAborted:            codes.Aborted,
+		StatusOutOfRange:         codes.OutOfRange,
+		StatusUnimplemented:      codes.Unimplemented,
+		StatusInternal:           codes.Internal,
+		StatusUnavailable:        codes.Unavailable,
+		StatusDataLoss:           codes.DataLoss,
+		StatusUnauthenticated:    codes.Unauthenticated,
+	}
+}
+
+func (*GRPC) XClient(ctxPtr *context.Context) interface{} {
+	rt := common.GetRuntime(*ctxPtr)
+	return common.Bind(rt, &Client{methods: make(map[string]*desc.MethodDescriptor)}, ctxPtr)
+}
+
+// A Client holds the service definitions known to a VU, and its connection to a server.
+type Client struct {
+	methods map[string]*desc.MethodDescriptor
+	addr    string
+	conn    *grpc.ClientConn
+}
+
+type ResponseError struct {
+	Code    codes.Code
+	Message string
+}
+
+type Response struct {
+	Status   codes.Code
+	Message  interface{}
+	Headers  map[string][]string
+	Trailers map[string][]string
+	Error    *ResponseError
+}
+
+// Load parses .proto files and makes the services in them available to invoke(). Files are
+// resolved against the given import paths, or the script's directory if there are none; relative
+// import paths are resolved against the script's directory too.
+func (c *Client) Load(ctx context.Context, importPaths []string, filenames ...string) ([]string, error) {
+	readFile := common.GetFileReader(ctx)
+	if common.GetState(ctx) != nil || readFile == nil {
+		return nil, errors.New("load() can only be called in the init context")
+	}
+
+	// Read through the init context, so the files end up in archives.
+	parser := protoparse.Parser{
+		ImportPaths:      importPaths,
+		InferImportPaths: len(importPaths) == 0,
+		Accessor: func(filename string) (io.ReadCloser, error) {
+			data, err := readFile(filename)
+			if err != nil {
+				return nil, err
+			}
+			return ioutil.NopCloser(bytes.NewReader(data)), nil
+		},
+	}
+	fds, err := parser.ParseFiles(filenames...)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, fd := range fds {
+		for _, sd := range fd.GetServices() {
+			names = append(names, c.addService(sd)...)
+		}
+	}
+	return names, nil
+}
+
+// Connect dials a server. Recognized params are "plaintext" (don't use TLS), "reflect" (fetch
+// service definitions using server reflection) and "timeout" (as "5s" or milliseconds).
+func (c *Client) Connect(ctx context.Context, addr string, args ...goja.Value) (bool, error) {
+	rt := common.GetRuntime(ctx)
+	state := common.GetState(ctx)
+	if state == nil {
+		return false, errors.New("connecting to a gRPC server in the init context is not supported")
+	}
+
+	plaintext, useReflection, timeout := false, false, defaultTimeout
+	if len(args) > 0 && !goja.IsUndefined(args[0]) && !goja.IsNull(args[0]) {
+		params := args[0].ToObject(rt)
+		for _, k := range params.Keys() {
+			v := params.Get(k)
+			switch k {
+			case "plaintext":
+				plaintext = v.ToBoolean()
+			case "reflect":
+				useReflection = v.ToBoolean()
+			case "timeout":
+				t, err := parseTimeout(v)
+				if err != nil {
+					return false, err
+				}
+				timeout = t
+			default:
+				return false, errors.Errorf("unknown connect param: %s", k)
+			}
+		}
+	}
+
+	// Dial through the VU's own transport, so we get the same DNS cache and TLS settings.
+	var netDial func(ctx context.Context, network, addr string) (net.Conn, error)
+	tlsConfig := &tls.Config{}
+	if t, ok := netext.TransportFor(state.HTTPTransport, addr); ok {
+		netDial = t.DialContext
+		if t.TLSClientConfig != nil {
+			tlsConfig = t.TLSClientConfig
+		}
+	}
+	if netDial == nil {
+		netDial = (&net.Dialer{}).DialContext
+	}
+
+	opts := []grpc.DialOption{
+		grpc.WithBlock(),
+		grpc.WithDialer(func(addr string, timeout time.Duration) (net.Conn, error) {
+			// The connection may outlive this iteration and have to redial in a later one, so
+			// this isn't tied to ctx; calls only get their own contexts.
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			return netDial(ctx, "tcp", addr)
+		}),
+	}
+	if plaintext {
+		opts = append(opts, grpc.WithInsecure())
+	} else {
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	conn, err := grpc.DialContext(dialCtx, addr, opts...)
+	if err != nil {
+		return false, err
+	}
+	c.conn = conn
+	c.addr = addr
+
+	if useReflection {
+		if err := c.reflect(dialCtx); err != nil {
+			c.Close()
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Invoke makes a unary call, eg. client.invoke("pkg.Service/Method", { ... }). Recognized params
+// are "metadata", "timeout" and "tags". Calls that fail with a gRPC status return a response
+// with that status; anything else (unknown method, not connected, etc.) is thrown.
+func (c *Client) Invoke(ctx context.Context, method string, req goja.Value, args ...goja.Value) (*Response, error) {
+	rt := common.GetRuntime(ctx)
+	state := common.GetState(ctx)
+	if state == nil {
+		return nil, errors.New("invoking RPCs in the init context is not supported")
+	}
+	if c.conn == nil {
+		return nil, errors.New("no gRPC connection, you must call connect() first")
+	}
+
+	if !strings.HasPrefix(method, "/") {
+		method = "/" + method
+	}
+	md, ok := c.methods[method]
+	if !ok {
+		return nil, errors.Errorf("method %s not found in any loaded service", method)
+	}
+	if md.IsClientStreaming() || md.IsServerStreaming() {
+		return nil, errors.Errorf("method %s is a streaming method, only unary calls are supported", method)
+	}
+
+	tags := map[string]string{
+		"status": "0",
+		"method": method,
+		"url":    c.addr + method,
+		"group":  state.Group.Path,
+	}
+	timeout := defaultTimeout
+	outgoing := metadata.MD{}
+
+	if len(args) > 0 && !goja.IsUndefined(args[0]) && !goja.IsNull(args[0]) {
+		params := args[0].ToObject(rt)
+		for _, k := range params.Keys() {
+			v := params.Get(k)
+			if goja.IsUndefined(v) || goja.IsNull(v) {
+				continue
+			}
+			switch k {
+			case "metadata":
+				mdObj := v.ToObject(rt)
+				for _, key := range mdObj.Keys() {
+					outgoing[strings.ToLower(key)] = append(outgoing[strings.ToLower(key)], mdObj.Get(key).String())
+				}
+			case "tags":
+				tagObj := v.ToObject(rt)
+				for _, key := range tagObj.Keys() {
+					tags[key] = tagObj.Get(key).String()
+				}
+			case "timeout":
+				t, err := parseTimeout(v)
+				if err != nil {
+					return nil, err
+				}
+				timeout = t
+			default:
+				return nil, errors.Errorf("unknown invoke param: %s", k)
+			}
+		}
+	}
+
+	// Requests are given as plain JS objects, which map onto the proto3 JSON mapping.
+	reqMsg := dynamic.NewMessage(md.GetInputType())
+	if req != nil && !goja.IsUndefined(req) && !goja.IsNull(req) {
+		data, err := json.Marshal(req.Export())
+		if err != nil {
+			return nil, err
+		}
+		if err := reqMsg.UnmarshalJSON(data); err != nil {
+			return nil, errors.Wrap(err, "couldn't build request message")
+		}
+	}
+
+	callCtx, cancel := context.WithTimeout(metadata.NewOutgoingContext(ctx, outgoing), timeout)
+	defer cancel()
+
+	var header, trailer metadata.MD
+	stub := grpcdynamic.NewStub(c.conn)
+	start := time.Now()
+	resMsg, err := stub.InvokeRpc(callCtx, md, reqMsg, grpc.Header(&header), grpc.Trailer(&trailer))
+	end := time.Now()
+
+	res := &Response{
+		Status:   codes.OK,
+		Headers:  header,
+		Trailers: trailer,
+	}
+	if err != nil {
+		st, ok := status.FromError(err)
+		if !ok {
+			return nil, err
+		}
+		res.Status = st.Code()
+		res.Error = &ResponseError{Code: st.Code(), Message: st.Message()}
+	}
+
+	tags["status"] = strconv.Itoa(int(res.Status))
+	state.Samples = append(state.Samples, stats.Sample{
+		Metric: metrics.GRPCReqDuration, Time: end, Tags: tags, Value: stats.D(end.Sub(start)),
+	})
+
+	if resMsg != nil {
+		dm, err := dynamic.AsDynamicMessage(resMsg)
+		if err != nil {
+			return nil, err
+		}
+		data, err := dm.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &res.Message); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// Close closes the connection; it's safe to connect() again afterwards.
+func (c *Client) Close() {
+	if c.conn == nil {
+		return
+	}
+	_ = c.conn.Close()
+	c.conn = nil
+}
+
+// Fetches service definitions from the server via the reflection API.
+func (c *Client) reflect(ctx context.Context) error {
+	client := grpcreflect.NewClient(ctx, rpb.NewServerReflectionClient(c.conn))
+	defer client.Reset()
+
+	services, err := client.ListServices()
+	if err != nil {
+		return errors.Wrap(err, "couldn't list services using reflection")
+	}
+	for _, name := range services {
+		sd, err := client.ResolveService(name)
+		if err != nil {
+			return errors.Wrapf(err, "couldn't resolve service %s using reflection", name)
+		}
+		c.addService(sd)
+	}
+	return nil
+}
+
+// Registers a service's methods, returning their names.
+func (c *Client) addService(sd *desc.ServiceDescriptor) []string {
+	var names []string
+	for _, md := range sd.GetMethods() {
+		name := "/" + sd.GetFullyQualifiedName() + "/" + md.GetName()
+		c.methods[name] = md
+		names = append(names, name)
+	}
+	return names
+}
+
+// Timeouts are given either as duration strings ("5s"), or as numbers of milliseconds.
+func parseTimeout(v goja.Value) (time.Duration, error) {
+	switch t := v.Export().(type) {
+	case string:
+		return time.ParseDuration(t)
+	case int64:
+		return time.Duration(t) * time.Millisecond, nil
+	case float64:
+		return time.Duration(t * float64(time.Millisecond)), nil
+	default:
+		return 0, errors.Errorf("invalid timeout: %v", v)
+	}
+}
@@ -0,0 +1,177 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package grpc
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/netext"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+const testProto = `
+syntax = "proto3";
+
+package test;
+
+message Ping { string msg = 1; }
+
+service Pinger {
+	rpc Ping(test.Ping) returns (test.Ping);
+	rpc PingStream(stream test.Ping) returns (stream test.Ping);
+}
+`
+
+func TestClient(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	srv := grpc.NewServer()
+	healthSrv := health.NewServer()
+	healthSrv.SetServingStatus("k6", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(srv, healthSrv)
+	reflection.Register(srv)
+	go func() { _ = srv.Serve(l) }()
+	defer srv.Stop()
+
+	dir, err := ioutil.TempDir("", "k6-grpc")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "test.proto"), []byte(testProto), 0644))
+
+	root, err := lib.NewGroup("", nil)
+	assert.NoError(t, err)
+
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	state := &common.State{
+		Group: root,
+		HTTPTransport: &http.Transport{
+			DialContext: (netext.NewDialer(net.Dialer{
+				Timeout:   10 * time.Second,
+				KeepAlive: 60 * time.Second,
+				DualStack: true,
+			})).DialContext,
+		},
+	}
+
+	// Start out in the init context; the state is attached once we're "running".
+	ctx := context.Background()
+	ctx = common.WithRuntime(ctx, rt)
+	ctx = common.WithFileReader(ctx, ioutil.ReadFile)
+	rt.Set("grpc", common.Bind(rt, New(), &ctx))
+	rt.Set("addr", l.Addr().String())
+	rt.Set("protoDir", dir)
+
+	t.Run("Load", func(t *testing.T) {
+		_, err := common.RunString(rt, `
+		var client = new grpc.Client();
+		let methods = client.load([protoDir], "test.proto");
+		if (methods.length != 2) { throw new Error("wrong number of methods: " + methods.length); }
+		if (methods[0] != "/test.Pinger/Ping") { throw new Error("wrong method: " + methods[0]); }
+		`)
+		assert.NoError(t, err)
+
+		t.Run("Invalid", func(t *testing.T) {
+			_, err := common.RunString(rt, `client.load([protoDir], "nonexistent.proto");`)
+			assert.Error(t, err)
+		})
+	})
+	t.Run("Connect", func(t *testing.T) {
+		t.Run("InitContext", func(t *testing.T) {
+			_, err := common.RunString(rt, `client.connect(addr, { plaintext: true });`)
+			assert.EqualError(t, err, "GoError: connecting to a gRPC server in the init context is not supported")
+		})
+
+		ctx = common.WithState(ctx, state)
+		t.Run("LoadOutsideInit", func(t *testing.T) {
+			_, err := common.RunString(rt, `client.load([protoDir], "test.proto");`)
+			assert.EqualError(t, err, "GoError: load() can only be called in the init context")
+		})
+		t.Run("UnknownParam", func(t *testing.T) {
+			_, err := common.RunString(rt, `client.connect(addr, { plaintext: true, foo: 1 });`)
+			assert.EqualError(t, err, "GoError: unknown connect param: foo")
+		})
+		t.Run("Reflect", func(t *testing.T) {
+			_, err := common.RunString(rt, `client.connect(addr, { plaintext: true, reflect: true, timeout: "5s" });`)
+			assert.NoError(t, err)
+		})
+	})
+	t.Run("Invoke", func(t *testing.T) {
+		state.Samples = nil
+		_, err := common.RunString(rt, `
+		let res = client.invoke("grpc.health.v1.Health/Check", { service: "k6" }, { metadata: { "x-test": "1" }, tags: { tag: "value" } });
+		if (res.status != grpc.StatusOK) { throw new Error("wrong status: " + res.status); }
+		if (res.message.status != "SERVING") { throw new Error("wrong serving status: " + res.message.status); }
+		`)
+		assert.NoError(t, err)
+		if assert.Len(t, state.Samples, 1) {
+			sample := state.Samples[0]
+			assert.Equal(t, metrics.GRPCReqDuration, sample.Metric)
+			assert.Equal(t, "0", sample.Tags["status"])
+			assert.Equal(t, "/grpc.health.v1.Health/Check", sample.Tags["method"])
+			assert.Equal(t, "value", sample.Tags["tag"])
+		}
+
+		t.Run("ErrorStatus", func(t *testing.T) {
+			state.Samples = nil
+			_, err := common.RunString(rt, `
+			let res = client.invoke("grpc.health.v1.Health/Check", { service: "nope" });
+			if (res.status != grpc.StatusNotFound) { throw new Error("wrong status: " + res.status); }
+			if (!res.error) { throw new Error("no error"); }
+			`)
+			assert.NoError(t, err)
+			if assert.Len(t, state.Samples, 1) {
+				assert.Equal(t, "5", state.Samples[0].Tags["status"])
+			}
+		})
+		t.Run("UnknownMethod", func(t *testing.T) {
+			_, err := common.RunString(rt, `client.invoke("foo.Bar/Baz", {});`)
+			assert.EqualError(t, err, "GoError: method /foo.Bar/Baz not found in any loaded service")
+		})
+		t.Run("Streaming", func(t *testing.T) {
+			_, err := common.RunString(rt, `client.invoke("test.Pinger/PingStream", {});`)
+			assert.EqualError(t, err, "GoError: method /test.Pinger/PingStream is a streaming method, only unary calls are supported")
+		})
+		t.Run("Closed", func(t *testing.T) {
+			_, err := common.RunString(rt, `client.close(); client.invoke("test.Pinger/Ping", {});`)
+			assert.EqualError(t, err, "GoError: no gRPC connection, you must call connect() first")
+		})
+	})
+}
@@ -71,3 +71,128 @@ func (s Selection) Attr(name string, def ...goja.Value) goja.Value {
 	}
 	return s.rt.ToValue(val)
 }
+
+// Returns the inner HTML of the first element.
+func (s Selection) Html() goja.Value {
+	html, err := s.sel.Html()
+	if err != nil || s.sel.Length() == 0 {
+		return goja.Undefined()
+	}
+	return s.rt.ToValue(html)
+}
+
+// Returns the value of the first form element (input, select or textarea).
+func (s Selection) Val() goja.Value {
+	if s.sel.Length() == 0 {
+		return goja.Undefined()
+	}
+	switch goquery.NodeName(s.sel.First()) {
+	case "select":
+		opt := s.sel.First().Find("option[selected]").First()
+		if opt.Length() == 0 {
+			opt = s.sel.First().Find("option").First()
+		}
+		if val, ok := opt.Attr("value"); ok {
+			return s.rt.ToValue(val)
+		}
+		return s.rt.ToValue(opt.Text())
+	case "textarea":
+		return s.rt.ToValue(s.sel.First().Text())
+	default:
+		val, _ := s.sel.First().Attr("value")
+		return s.rt.ToValue(val)
+	}
+}
+
+func (s Selection) Size() int {
+	return s.sel.Length()
+}
+
+func (s Selection) Children(sel ...string) Selection {
+	if len(sel) > 0 {
+		return Selection{s.rt, s.sel.ChildrenFiltered(sel[0])}
+	}
+	return Selection{s.rt, s.sel.Children()}
+}
+
+func (s Selection) Parent(sel ...string) Selection {
+	if len(sel) > 0 {
+		return Selection{s.rt, s.sel.ParentFiltered(sel[0])}
+	}
+	return Selection{s.rt, s.sel.Parent()}
+}
+
+func (s Selection) Closest(sel string) Selection {
+	return Selection{s.rt, s.sel.Closest(sel)}
+}
+
+func (s Selection) Next(sel ...string) Selection {
+	if len(sel) > 0 {
+		return Selection{s.rt, s.sel.NextFiltered(sel[0])}
+	}
+	return Selection{s.rt, s.sel.Next()}
+}
+
+func (s Selection) Prev(sel ...string) Selection {
+	if len(sel) > 0 {
+		return Selection{s.rt, s.sel.PrevFiltered(sel[0])}
+	}
+	return Selection{s.rt, s.sel.Prev()}
+}
+
+func (s Selection) Siblings(sel ...string) Selection {
+	if len(sel) > 0 {
+		return Selection{s.rt, s.sel.SiblingsFiltered(sel[0])}
+	}
+	return Selection{s.rt, s.sel.Siblings()}
+}
+
+func (s Selection) First() Selection {
+	return Selection{s.rt, s.sel.First()}
+}
+
+func (s Selection) Last() Selection {
+	return Selection{s.rt, s.sel.Last()}
+}
+
+func (s Selection) Eq(i int) Selection {
+	return Selection{s.rt, s.sel.Eq(i)}
+}
+
+func (s Selection) Filter(sel string) Selection {
+	return Selection{s.rt, s.sel.Filter(sel)}
+}
+
+func (s Selection) Not(sel string) Selection {
+	return Selection{s.rt, s.sel.Not(sel)}
+}
+
+func (s Selection) Has(sel string) Selection {
+	return Selection{s.rt, s.sel.Has(sel)}
+}
+
+func (s Selection) Is(sel string) bool {
+	return s.sel.Is(sel)
+}
+
+// Calls fn(index, element) for each element, where element is a selection of just that one.
+func (s Selection) Each(fn goja.Callable) {
+	s.sel.Each(func(i int, sel *goquery.Selection) {
+		if _, err := fn(goja.Undefined(), s.rt.ToValue(i), s.rt.ToValue(Selection{s.rt, sel})); err != nil {
+			common.Throw(s.rt, err)
+		}
+	})
+}
+
+// Returns the results of calling fn(index, element) for each element, as an array.
+func (s Selection) Map(fn goja.Callable) []interface{} {
+	vals := make([]interface{}, 0, s.sel.Length())
+	s.sel.Each(func(i int, sel *goquery.Selection) {
+		v, err := fn(goja.Undefined(), s.rt.ToValue(i), s.rt.ToValue(Selection{s.rt, sel}))
+		if err != nil {
+			common.Throw(s.rt, err)
+		}
+		vals = append(vals, v)
+	})
+	return vals
+}
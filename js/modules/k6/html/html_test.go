@@ -119,3 +119,84 @@ func TestParseHTML(t *testing.T) {
 		})
 	})
 }
+
+const testFormHTML = `
+<html>
+<body>
+	<ul id="list">
+		<li class="item">One</li>
+		<li class="item selected">Two</li>
+		<li class="item">Three</li>
+	</ul>
+	<form id="form">
+		<input name="text" value="some text">
+		<select name="select">
+			<option value="a">A</option>
+			<option value="b" selected>B</option>
+		</select>
+		<select name="noselected"><option>First</option><option>Second</option></select>
+		<textarea name="textarea">Some <b>text</b></textarea>
+	</form>
+</body>
+`
+
+func TestSelection(t *testing.T) {
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	ctx := common.WithRuntime(context.Background(), rt)
+	rt.Set("src", testFormHTML)
+	rt.Set("html", common.Bind(rt, &HTML{}, &ctx))
+
+	_, err := common.RunString(rt, `let doc = html.parseHTML(src)`)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	testdata := map[string]interface{}{
+		`doc.find("li").size()`:                               int64(3),
+		`doc.find("li").first().text()`:                       "One",
+		`doc.find("li").last().text()`:                        "Three",
+		`doc.find("li").eq(1).text()`:                         "Two",
+		`doc.find("li").filter(".selected").text()`:           "Two",
+		`doc.find("li").not(".selected").size()`:              int64(2),
+		`doc.find("li.selected").is(".item")`:                 true,
+		`doc.find("li.selected").next().text()`:               "Three",
+		`doc.find("li.selected").prev().text()`:               "One",
+		`doc.find("li.selected").siblings().size()`:           int64(2),
+		`doc.find("li.selected").parent().attr("id")`:         "list",
+		`doc.find("li.selected").closest("ul").size()`:        int64(1),
+		`doc.find("ul").children(".selected").text()`:         "Two",
+		`doc.find("body").has("form").size()`:                 int64(1),
+		`doc.find("ul").html().trim().substr(0, 17)`:          `<li class="item">`,
+		`doc.find("nothing").html()`:                          nil,
+		`doc.find("[name=text]").val()`:                       "some text",
+		`doc.find("[name=select]").val()`:                     "b",
+		`doc.find("[name=noselected]").val()`:                 "First",
+		`doc.find("textarea").val()`:                          "Some <b>text</b>",
+		`doc.find("li").map((i, el) => i + el.text()).join()`: "0One,1Two,2Three",
+	}
+	for src, expected := range testdata {
+		t.Run(src, func(t *testing.T) {
+			v, err := common.RunString(rt, src)
+			if assert.NoError(t, err) {
+				assert.Equal(t, expected, v.Export())
+			}
+		})
+	}
+
+	t.Run("Each", func(t *testing.T) {
+		v, err := common.RunString(rt, `
+		let texts = [];
+		doc.find("li").each(function(i, el) { texts.push(el.text()); });
+		texts.join();
+		`)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "One,Two,Three", v.Export())
+		}
+
+		t.Run("Error", func(t *testing.T) {
+			_, err := common.RunString(rt, `doc.find("li").each(function() { throw new Error("oops"); });`)
+			assert.Error(t, err)
+		})
+	})
+}
@@ -0,0 +1,161 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/cookiejar"
+	neturl "net/url"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/pkg/errors"
+)
+
+// HTTPCookieJar exposes a VU's cookie jar to scripts.
+type HTTPCookieJar struct {
+	ctx context.Context
+	jar *cookiejar.Jar
+}
+
+func (*HTTP) CookieJar(ctx context.Context) (*HTTPCookieJar, error) {
+	state := common.GetState(ctx)
+	if state.CookieJar == nil {
+		return nil, errors.New("no cookie jar available")
+	}
+	return &HTTPCookieJar{ctx, state.CookieJar}, nil
+}
+
+// Returns the cookies that would be sent to a URL, as name -> values.
+func (j *HTTPCookieJar) CookiesForURL(url string) (map[string][]string, error) {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+
+	cookies := j.jar.Cookies(u)
+	objs := make(map[string][]string, len(cookies))
+	for _, c := range cookies {
+		objs[c.Name] = append(objs[c.Name], c.Value)
+	}
+	return objs, nil
+}
+
+// Sets a cookie for a URL. Options are domain, path, expires (an RFC1123 date), max_age, secure
+// and http_only, as in a Set-Cookie header.
+func (j *HTTPCookieJar) Set(url, name, value string, opts goja.Value) error {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return err
+	}
+
+	c := &http.Cookie{Name: name, Value: value}
+	if opts != nil && !goja.IsUndefined(opts) && !goja.IsNull(opts) {
+		params := opts.ToObject(common.GetRuntime(j.ctx))
+		for _, k := range params.Keys() {
+			switch k {
+			case "domain":
+				c.Domain = params.Get(k).String()
+			case "path":
+				c.Path = params.Get(k).String()
+			case "expires":
+				t, err := time.Parse(time.RFC1123, params.Get(k).String())
+				if err != nil {
+					return errors.Wrap(err, "expires")
+				}
+				c.Expires = t
+			case "max_age":
+				c.MaxAge = int(params.Get(k).ToInteger())
+			case "secure":
+				c.Secure = params.Get(k).ToBoolean()
+			case "http_only":
+				c.HttpOnly = params.Get(k).ToBoolean()
+			}
+		}
+	}
+	j.jar.SetCookies(u, []*http.Cookie{c})
+	return nil
+}
+
+// Deletes a cookie for a URL.
+func (j *HTTPCookieJar) Delete(url, name string) error {
+	return j.expire(url, func(c *http.Cookie) bool { return c.Name == name })
+}
+
+// Deletes all cookies for a URL.
+func (j *HTTPCookieJar) Clear(url string) error {
+	return j.expire(url, func(c *http.Cookie) bool { return true })
+}
+
+// The jar has no way to remove cookies, other than expiring them. It also doesn't tell us the
+// paths cookies were set for, so this only works for those set for the URL's own path.
+func (j *HTTPCookieJar) expire(url string, match func(c *http.Cookie) bool) error {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return err
+	}
+
+	var expired []*http.Cookie
+	for _, c := range j.jar.Cookies(u) {
+		if match(c) {
+			expired = append(expired, &http.Cookie{Name: c.Name, MaxAge: -1})
+		}
+	}
+	if len(expired) > 0 {
+		j.jar.SetCookies(u, expired)
+	}
+	return nil
+}
+
+// Wraps a cookie jar so that cookies set for a single request take precedence over the jar's own.
+type requestCookieJar struct {
+	http.CookieJar
+
+	// The request the overrides are for; redirects get the jar's cookies as usual.
+	url       *neturl.URL
+	overrides map[string]string
+}
+
+func (j requestCookieJar) Cookies(u *neturl.URL) []*http.Cookie {
+	if j.CookieJar == nil {
+		return nil
+	}
+	cookies := j.CookieJar.Cookies(u)
+	if u != j.url {
+		return cookies
+	}
+
+	filtered := cookies[:0]
+	for _, c := range cookies {
+		if _, ok := j.overrides[c.Name]; !ok {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered
+}
+
+func (j requestCookieJar) SetCookies(u *neturl.URL, cookies []*http.Cookie) {
+	if j.CookieJar != nil {
+		j.CookieJar.SetCookies(u, cookies)
+	}
+}
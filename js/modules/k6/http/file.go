@@ -0,0 +1,131 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/pkg/errors"
+)
+
+// FileData is a file to be sent as part of a multipart/form-data request body.
+type FileData struct {
+	Data        []byte
+	Filename    string
+	ContentType string
+}
+
+// Wraps a string or an array of bytes (eg. from open(path, "b")) as a file to upload.
+func (*HTTP) File(data goja.Value, args ...string) (FileData, error) {
+	b, err := toBytes(data)
+	if err != nil {
+		return FileData{}, err
+	}
+
+	f := FileData{Data: b, ContentType: "application/octet-stream"}
+	if len(args) > 0 {
+		f.Filename = args[0]
+	}
+	if len(args) > 1 && args[1] != "" {
+		f.ContentType = args[1]
+	}
+	return f, nil
+}
+
+func toBytes(v goja.Value) ([]byte, error) {
+	switch data := v.Export().(type) {
+	case []byte:
+		return data, nil
+	case string:
+		return []byte(data), nil
+	case []interface{}:
+		// Plain JS arrays of numbers, eg. built by hand or sliced from a byte array.
+		b := make([]byte, len(data))
+		for i, n := range data {
+			switch n := n.(type) {
+			case int64:
+				b[i] = byte(n)
+			case float64:
+				b[i] = byte(n)
+			default:
+				return nil, errors.Errorf("invalid byte at index %d: %v", i, n)
+			}
+		}
+		return b, nil
+	default:
+		return nil, errors.Errorf("can't use a %T as file data", data)
+	}
+}
+
+// Returns the FileData a value holds, if it holds one.
+func toFileData(v goja.Value) (FileData, bool) {
+	if v == nil {
+		return FileData{}, false
+	}
+	switch f := v.Export().(type) {
+	case FileData:
+		return f, true
+	case *FileData:
+		return *f, true
+	default:
+		return FileData{}, false
+	}
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// Encodes an object containing file parts as multipart/form-data; returns the body and its
+// content type, including the boundary.
+func encodeMultipart(obj *goja.Object) (*bytes.Buffer, string, error) {
+	buf := &bytes.Buffer{}
+	w := multipart.NewWriter(buf)
+	for _, k := range obj.Keys() {
+		v := obj.Get(k)
+		f, ok := toFileData(v)
+		if !ok {
+			if err := w.WriteField(k, v.String()); err != nil {
+				return nil, "", err
+			}
+			continue
+		}
+
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+			quoteEscaper.Replace(k), quoteEscaper.Replace(f.Filename)))
+		h.Set("Content-Type", f.ContentType)
+		part, err := w.CreatePart(h)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := part.Write(f.Data); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf, w.FormDataContentType(), nil
+}
@@ -53,6 +53,7 @@ type HTTPResponse struct {
 	RemoteIP   string
 	RemotePort int
 	URL        string
+	Proto      string
 	Status     int
 	Headers    map[string]string
 	Body       string
@@ -85,7 +86,25 @@ func (res *HTTPResponse) Html(selector ...string) html.Selection {
 
 type HTTP struct{}
 
-func (*HTTP) Request(ctx context.Context, method, url string, args ...goja.Value) (*HTTPResponse, error) {
+// A request that's been read from JS arguments, and can be made without touching the runtime.
+type parsedRequest struct {
+	req     *http.Request
+	tags    map[string]string
+	cookies map[string]string
+}
+
+func (h *HTTP) Request(ctx context.Context, method, url string, args ...goja.Value) (*HTTPResponse, error) {
+	preq, err := h.parseRequest(ctx, method, url, args...)
+	if err != nil {
+		return nil, err
+	}
+	res, samples, err := h.doRequest(ctx, preq)
+	state := common.GetState(ctx)
+	state.Samples = append(state.Samples, samples...)
+	return res, err
+}
+
+func (*HTTP) parseRequest(ctx context.Context, method, url string, args ...goja.Value) (*parsedRequest, error) {
 	rt := common.GetRuntime(ctx)
 	state := common.GetState(ctx)
 
@@ -93,13 +112,35 @@ func (*HTTP) Request(ctx context.Context, method, url string, args ...goja.Value
 	var contentType string
 	if len(args) > 0 && !goja.IsUndefined(args[0]) && !goja.IsNull(args[0]) {
 		var data map[string]goja.Value
-		if rt.ExportTo(args[0], &data) == nil {
-			bodyQuery := make(neturl.Values, len(data))
-			for k, v := range data {
-				bodyQuery.Set(k, v.String())
+		if b, ok := args[0].Export().([]byte); ok {
+			bodyReader = bytes.NewReader(b)
+		} else if f, ok := toFileData(args[0]); ok {
+			bodyReader = bytes.NewReader(f.Data)
+			contentType = f.ContentType
+		} else if rt.ExportTo(args[0], &data) == nil {
+			// Objects with files in them have to be sent as multipart; others are url-encoded.
+			hasFiles := false
+			for _, v := range data {
+				if _, ok := toFileData(v); ok {
+					hasFiles = true
+					break
+				}
+			}
+			if hasFiles {
+				buf, ct, err := encodeMultipart(args[0].ToObject(rt))
+				if err != nil {
+					return nil, err
+				}
+				bodyReader = buf
+				contentType = ct
+			} else {
+				bodyQuery := make(neturl.Values, len(data))
+				for k, v := range data {
+					bodyQuery.Set(k, v.String())
+				}
+				bodyReader = bytes.NewBufferString(bodyQuery.Encode())
+				contentType = "application/x-www-form-urlencoded"
 			}
-			bodyReader = bytes.NewBufferString(bodyQuery.Encode())
-			contentType = "application/x-www-form-urlencoded"
 		} else {
 			bodyReader = bytes.NewBufferString(args[0].String())
 		}
@@ -120,6 +161,7 @@ func (*HTTP) Request(ctx context.Context, method, url string, args ...goja.Value
 		"group":  state.Group.Path,
 	}
 
+	cookies := make(map[string]string)
 	if len(args) > 1 {
 		paramsV := args[1]
 		if !goja.IsUndefined(paramsV) && !goja.IsNull(paramsV) {
@@ -138,6 +180,18 @@ func (*HTTP) Request(ctx context.Context, method, url string, args ...goja.Value
 					for _, key := range headers.Keys() {
 						req.Header.Set(key, headers.Get(key).String())
 					}
+				case "cookies":
+					cookiesV := params.Get(k)
+					if goja.IsUndefined(cookiesV) || goja.IsNull(cookiesV) {
+						continue
+					}
+					cookiesObj := cookiesV.ToObject(rt)
+					if cookiesObj == nil {
+						continue
+					}
+					for _, key := range cookiesObj.Keys() {
+						cookies[key] = cookiesObj.Get(key).String()
+					}
 				case "tags":
 					tagsV := params.Get(k)
 					if goja.IsUndefined(tagsV) || goja.IsNull(tagsV) {
@@ -155,8 +209,33 @@ func (*HTTP) Request(ctx context.Context, method, url string, args ...goja.Value
 		}
 	}
 
+	return &parsedRequest{req: req, tags: tags, cookies: cookies}, nil
+}
+
+// Makes a parsed request; this is safe to call from any goroutine. Samples are returned rather
+// than added to the state, so the caller can add them from the VU's goroutine.
+func (*HTTP) doRequest(ctx context.Context, preq *parsedRequest) (*HTTPResponse, []stats.Sample, error) {
+	state := common.GetState(ctx)
+	req, tags, cookies := preq.req, preq.tags, preq.cookies
+
+	tracer := netext.Tracer{}
+	req = req.WithContext(netext.WithTracer(ctx, &tracer))
+
+	// Cookies given for the request replace any of the same name in the jar.
+	var jar http.CookieJar
+	if state.CookieJar != nil {
+		jar = state.CookieJar
+	}
+	if len(cookies) > 0 {
+		for name, value := range cookies {
+			req.AddCookie(&http.Cookie{Name: name, Value: value})
+		}
+		jar = requestCookieJar{CookieJar: jar, url: req.URL, overrides: cookies}
+	}
+
 	client := http.Client{
 		Transport: state.HTTPTransport,
+		Jar:       jar,
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			max := int(state.Options.MaxRedirects.Int64)
 			if len(via) >= max {
@@ -165,23 +244,21 @@ func (*HTTP) Request(ctx context.Context, method, url string, args ...goja.Value
 			return nil
 		},
 	}
-	tracer := netext.Tracer{}
-	res, err := client.Do(req.WithContext(netext.WithTracer(ctx, &tracer)))
+	res, err := client.Do(req)
 	if err != nil {
-		state.Samples = append(state.Samples, tracer.Done().Samples(tags)...)
-		return nil, err
+		return nil, tracer.Done().Samples(tags), err
 	}
 
 	body, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		state.Samples = append(state.Samples, tracer.Done().Samples(tags)...)
-		return nil, err
+		return nil, tracer.Done().Samples(tags), err
 	}
 	_ = res.Body.Close()
 	trail := tracer.Done()
 
 	tags["status"] = strconv.Itoa(res.StatusCode)
-	state.Samples = append(state.Samples, trail.Samples(tags)...)
+	tags["proto"] = res.Proto
+	samples := trail.Samples(tags)
 
 	headers := make(map[string]string, len(res.Header))
 	for k, vs := range res.Header {
@@ -195,6 +272,7 @@ func (*HTTP) Request(ctx context.Context, method, url string, args ...goja.Value
 		RemoteIP:   remoteHost,
 		RemotePort: remotePort,
 		URL:        res.Request.URL.String(),
+		Proto:      res.Proto,
 		Status:     res.StatusCode,
 		Headers:    headers,
 		Body:       string(body),
@@ -206,7 +284,7 @@ func (*HTTP) Request(ctx context.Context, method, url string, args ...goja.Value
 			Waiting:    stats.D(trail.Waiting),
 			Receiving:  stats.D(trail.Receiving),
 		},
-	}, nil
+	}, samples, nil
 }
 
 func (http *HTTP) Get(ctx context.Context, url string, args ...goja.Value) (*HTTPResponse, error) {
@@ -237,62 +315,127 @@ func (http *HTTP) Del(ctx context.Context, url string, args ...goja.Value) (*HTT
 	return http.Request(ctx, "DELETE", url, args...)
 }
 
+// Makes several requests in parallel, bounded by the batch and batchPerHost options. Requests
+// may be given as an array, in which case an array of responses is returned in the same order,
+// or as an object, which gives an object of responses with the same keys. Each request is either
+// a URL to GET, an array of [method, url, body, params], or an object with those keys.
 func (http *HTTP) Batch(ctx context.Context, reqsV goja.Value) (goja.Value, error) {
 	rt := common.GetRuntime(ctx)
+	state := common.GetState(ctx)
 
-	errs := make(chan error)
-	retval := rt.NewObject()
-	mutex := sync.Mutex{}
-
+	// Parse everything up front; the runtime can't be used from the goroutines making requests.
 	reqs := reqsV.ToObject(rt)
 	keys := reqs.Keys()
-	for _, k := range keys {
-		k := k
-		v := reqs.Get(k)
-
-		var method, url string
-		var args []goja.Value
+	preqs := make([]*parsedRequest, len(keys))
+	for i, k := range keys {
+		method, url, args := parseBatchRequest(rt, reqs.Get(k))
+		preq, err := http.parseRequest(ctx, method, url, args...)
+		if err != nil {
+			return nil, err
+		}
+		preqs[i] = preq
+	}
 
-		// Shorthand: "http://example.com/" -> ["GET", "http://example.com/"]
-		if v.ExportType().Kind() == reflect.String {
-			method = "GET"
-			url = v.String()
-		} else {
-			obj := v.ToObject(rt)
-			objkeys := obj.Keys()
-			for i, objk := range objkeys {
-				objv := obj.Get(objk)
-				switch i {
-				case 0:
-					method = strings.ToUpper(objv.String())
-					if method == "GET" || method == "HEAD" {
-						args = []goja.Value{goja.Undefined()}
-					}
-				case 1:
-					url = objv.String()
-				default:
-					args = append(args, objv)
-				}
+	var limit chan struct{}
+	if n := state.Options.Batch.Int64; n > 0 {
+		limit = make(chan struct{}, n)
+	}
+	hostLimits := make(map[string]chan struct{})
+	if n := state.Options.BatchPerHost.Int64; n > 0 {
+		for _, preq := range preqs {
+			if _, ok := hostLimits[preq.req.URL.Host]; !ok {
+				hostLimits[preq.req.URL.Host] = make(chan struct{}, n)
 			}
 		}
+	}
 
-		go func() {
-			res, err := http.Request(ctx, method, url, args...)
-			if err != nil {
-				errs <- err
+	results := make([]*HTTPResponse, len(preqs))
+	samples := make([][]stats.Sample, len(preqs))
+	errs := make([]error, len(preqs))
+	wg := sync.WaitGroup{}
+	for i, preq := range preqs {
+		wg.Add(1)
+		go func(i int, preq *parsedRequest) {
+			defer wg.Done()
+
+			// Always take the per-host slot first, so requests waiting on a busy host don't hold
+			// on to slots that requests to other hosts could use.
+			if hostLimit := hostLimits[preq.req.URL.Host]; hostLimit != nil {
+				hostLimit <- struct{}{}
+				defer func() { <-hostLimit }()
 			}
-			mutex.Lock()
-			_ = retval.Set(k, res)
-			mutex.Unlock()
-			errs <- nil
-		}()
+			if limit != nil {
+				limit <- struct{}{}
+				defer func() { <-limit }()
+			}
+			results[i], samples[i], errs[i] = http.doRequest(ctx, preq)
+		}(i, preq)
 	}
+	wg.Wait()
 
 	var err error
-	for range keys {
-		if e := <-errs; e != nil {
-			err = e
+	for i := range preqs {
+		state.Samples = append(state.Samples, samples[i]...)
+		if err == nil && errs[i] != nil {
+			err = errs[i]
 		}
 	}
+
+	if reqsV.ExportType().Kind() == reflect.Slice {
+		arr := make([]interface{}, len(results))
+		for i, res := range results {
+			arr[i] = res
+		}
+		return rt.ToValue(arr), err
+	}
+	retval := rt.NewObject()
+	for i, k := range keys {
+		_ = retval.Set(k, results[i])
+	}
 	return retval, err
 }
+
+// Reads a request given to http.batch(); see Batch() for the accepted forms.
+func parseBatchRequest(rt *goja.Runtime, v goja.Value) (method, url string, args []goja.Value) {
+	// Shorthand: "http://example.com/" -> ["GET", "http://example.com/"]
+	if v.ExportType().Kind() == reflect.String {
+		return "GET", v.String(), []goja.Value{goja.Undefined()}
+	}
+
+	obj := v.ToObject(rt)
+	var body, params goja.Value = goja.Undefined(), goja.Undefined()
+	if v.ExportType().Kind() == reflect.Slice {
+		for i, k := range obj.Keys() {
+			switch i {
+			case 0:
+				method = obj.Get(k).String()
+			case 1:
+				url = obj.Get(k).String()
+			case 2:
+				body = obj.Get(k)
+			case 3:
+				params = obj.Get(k)
+			}
+		}
+	} else {
+		method = "GET"
+		for _, k := range obj.Keys() {
+			switch k {
+			case "method":
+				method = obj.Get(k).String()
+			case "url":
+				url = obj.Get(k).String()
+			case "body":
+				body = obj.Get(k)
+			case "params":
+				params = obj.Get(k)
+			}
+		}
+	}
+
+	method = strings.ToUpper(method)
+	if method == "GET" || method == "HEAD" {
+		body = goja.Undefined()
+	}
+	return method, url, []goja.Value{body, params}
+}
@@ -22,11 +22,16 @@ package http
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -39,6 +44,7 @@ import (
 	"github.com/loadimpact/k6/lib/netext"
 	"github.com/loadimpact/k6/stats"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
 )
 
 func assertRequestMetricsEmitted(t *testing.T, samples []stats.Sample, method, url string, status int, group string) {
@@ -98,6 +104,10 @@ func TestRequest(t *testing.T) {
 		},
 	}
 
+	jar, err := cookiejar.New(nil)
+	assert.NoError(t, err)
+	state.CookieJar = jar
+
 	ctx := context.Background()
 	ctx = common.WithState(ctx, state)
 	ctx = common.WithRuntime(ctx, rt)
@@ -249,6 +259,58 @@ func TestRequest(t *testing.T) {
 		})
 	})
 
+	t.Run("Cookies", func(t *testing.T) {
+		t.Run("redirect", func(t *testing.T) {
+			_, err := common.RunString(rt, `
+			let res = http.get("https://httpbin.org/cookies/set?key=value");
+			if (res.status != 200) { throw new Error("wrong status: " + res.status); }
+			if (res.json().cookies.key != "value") { throw new Error("wrong cookies: " + res.body); }
+			`)
+			assert.NoError(t, err)
+
+			t.Run("persists", func(t *testing.T) {
+				_, err := common.RunString(rt, `
+				let res = http.get("https://httpbin.org/cookies");
+				if (res.json().cookies.key != "value") { throw new Error("wrong cookies: " + res.body); }
+				`)
+				assert.NoError(t, err)
+			})
+		})
+		t.Run("override", func(t *testing.T) {
+			_, err := common.RunString(rt, `
+			let res = http.get("https://httpbin.org/cookies", { cookies: { key: "override", other: "1" } });
+			if (res.json().cookies.key != "override") { throw new Error("wrong cookies: " + res.body); }
+			if (res.json().cookies.other != "1") { throw new Error("wrong cookies: " + res.body); }
+			`)
+			assert.NoError(t, err)
+		})
+		t.Run("jar", func(t *testing.T) {
+			_, err := common.RunString(rt, `
+			let jar = http.cookieJar();
+			jar.set("https://httpbin.org/cookies", "set", "by jar");
+			let cookies = jar.cookiesForURL("https://httpbin.org/cookies");
+			if (cookies.set[0] != "by jar") { throw new Error("wrong cookies: " + JSON.stringify(cookies)); }
+			let res = http.get("https://httpbin.org/cookies");
+			if (res.json().cookies.set != "by jar") { throw new Error("wrong cookies: " + res.body); }
+
+			jar.delete("https://httpbin.org/cookies", "set");
+			cookies = jar.cookiesForURL("https://httpbin.org/cookies");
+			if (cookies.set !== undefined) { throw new Error("cookie not deleted: " + JSON.stringify(cookies)); }
+			`)
+			assert.NoError(t, err)
+
+			t.Run("clear", func(t *testing.T) {
+				_, err := common.RunString(rt, `
+				let jar = http.cookieJar();
+				jar.clear("https://httpbin.org/");
+				let res = http.get("https://httpbin.org/cookies");
+				if (Object.keys(res.json().cookies).length != 0) { throw new Error("cookies not cleared: " + res.body); }
+				`)
+				assert.NoError(t, err)
+			})
+		})
+	})
+
 	t.Run("GET", func(t *testing.T) {
 		state.Samples = nil
 		_, err := common.RunString(rt, `
@@ -317,6 +379,38 @@ func TestRequest(t *testing.T) {
 		})
 	}
 
+	t.Run("Multipart", func(t *testing.T) {
+		state.Samples = nil
+		_, err := common.RunString(rt, `
+		let res = http.post("https://httpbin.org/post", {
+			field: "value",
+			file: http.file("file contents", "test.txt", "text/plain"),
+			bin: http.file([255, 0, 1], "test.bin"),
+		});
+		if (res.status != 200) { throw new Error("wrong status: " + res.status); }
+		if (res.json().form.field != "value") { throw new Error("wrong form: " + JSON.stringify(res.json().form)); }
+		if (res.json().files.file != "file contents") { throw new Error("wrong files: " + JSON.stringify(res.json().files)); }
+		if (res.json().files.bin.indexOf("base64,/wAB") == -1) { throw new Error("wrong files: " + JSON.stringify(res.json().files)); }
+		if (res.json().headers["Content-Type"].indexOf("multipart/form-data; boundary=") != 0) { throw new Error("wrong content type: " + res.json().headers["Content-Type"]); }
+		`)
+		assert.NoError(t, err)
+		assertRequestMetricsEmitted(t, state.Samples, "POST", "https://httpbin.org/post", 200, "")
+
+		t.Run("File", func(t *testing.T) {
+			_, err := common.RunString(rt, `
+			let f = http.file("data");
+			if (f.filename != "") { throw new Error("wrong filename: " + f.filename); }
+			if (f.content_type != "application/octet-stream") { throw new Error("wrong content type: " + f.content_type); }
+			`)
+			assert.NoError(t, err)
+
+			t.Run("Invalid", func(t *testing.T) {
+				_, err := common.RunString(rt, `http.file({});`)
+				assert.EqualError(t, err, "GoError: can't use a map[string]interface {} as file data")
+			})
+		})
+	})
+
 	t.Run("Batch", func(t *testing.T) {
 		t.Run("GET", func(t *testing.T) {
 			_, err := common.RunString(rt, `
@@ -363,5 +457,185 @@ func TestRequest(t *testing.T) {
 			}`)
 			assert.NoError(t, err)
 		})
+		t.Run("Object", func(t *testing.T) {
+			_, err := common.RunString(rt, `
+			let res = http.batch({
+				"home": "https://httpbin.org/",
+				"post": { method: "POST", url: "https://httpbin.org/post", body: { key: "value" } },
+			});
+			if (res.home.status != 200) { throw new Error("wrong status: " + res.home.status); }
+			if (res.post.json().form.key != "value") { throw new Error("wrong form: " + JSON.stringify(res.post.json().form)); }
+			`)
+			assert.NoError(t, err)
+		})
+
+		// Serve requests slowly, keeping track of how many are being served at once.
+		var current, max int64
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt64(&current, 1)
+			for {
+				m := atomic.LoadInt64(&max)
+				if n <= m || atomic.CompareAndSwapInt64(&max, m, n) {
+					break
+				}
+			}
+			time.Sleep(50 * time.Millisecond)
+			atomic.AddInt64(&current, -1)
+			_, _ = w.Write([]byte(r.URL.Path))
+		}))
+		defer srv.Close()
+		rt.Set("srvURL", srv.URL)
+
+		t.Run("Order", func(t *testing.T) {
+			_, err := common.RunString(rt, `
+			let reqs = [];
+			for (let i = 0; i < 5; i++) { reqs.push(srvURL + "/" + i); }
+			let res = http.batch(reqs);
+			if (res.length != 5) { throw new Error("wrong length: " + res.length); }
+			for (let i = 0; i < 5; i++) {
+				if (res[i].body != "/" + i) { throw new Error("wrong body for " + i + ": " + res[i].body); }
+			}
+			`)
+			assert.NoError(t, err)
+		})
+
+		testdata := map[string]struct {
+			opts lib.Options
+			max  int64
+		}{
+			"Limit":        {lib.Options{Batch: null.IntFrom(2)}, 2},
+			"LimitPerHost": {lib.Options{Batch: null.IntFrom(4), BatchPerHost: null.IntFrom(1)}, 1},
+		}
+		for name, data := range testdata {
+			t.Run(name, func(t *testing.T) {
+				oldOpts := state.Options
+				defer func() { state.Options = oldOpts }()
+				state.Options = state.Options.Apply(data.opts)
+
+				atomic.StoreInt64(&max, 0)
+				_, err := common.RunString(rt, `
+				let reqs = [];
+				for (let i = 0; i < 5; i++) { reqs.push(srvURL + "/" + i); }
+				http.batch(reqs);
+				`)
+				assert.NoError(t, err)
+				assert.Equal(t, data.max, atomic.LoadInt64(&max))
+			})
+		}
+	})
+
+	t.Run("Forms", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`<html><body>
+			<a href="/links/1">First</a>
+			<a id="second" href="links/2">Second</a>
+			<form action="/submit" method="post">
+				<input name="text" value="hi">
+				<input type="checkbox" name="check" checked>
+				<input type="checkbox" name="unchecked" value="no">
+				<input name="disabled" value="no" disabled>
+				<select name="select"><option>a</option><option value="b" selected>B</option></select>
+				<textarea name="area">text</textarea>
+				<input type="submit" name="go" value="Go">
+			</form>
+			<form id="search" action="/search?old=1"><input name="q" value="k6"></form>
+			</body></html>`))
+		})
+		echo := func(w http.ResponseWriter, r *http.Request) {
+			_ = r.ParseForm()
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"method": r.Method,
+				"path":   r.URL.Path,
+				"form":   r.Form,
+			})
+		}
+		mux.HandleFunc("/submit", echo)
+		mux.HandleFunc("/search", echo)
+		mux.HandleFunc("/links/", echo)
+		srv := httptest.NewServer(mux)
+		defer srv.Close()
+		rt.Set("formURL", srv.URL+"/")
+
+		t.Run("SubmitForm", func(t *testing.T) {
+			_, err := common.RunString(rt, `
+			let data = http.get(formURL).submitForm().json();
+			if (data.method != "POST") { throw new Error("wrong method: " + data.method); }
+			let expected = { text: "hi", check: "on", select: "b", area: "text", go: "Go" };
+			if (Object.keys(data.form).length != Object.keys(expected).length) {
+				throw new Error("wrong fields: " + JSON.stringify(data.form));
+			}
+			for (let k in expected) {
+				if (data.form[k][0] != expected[k]) { throw new Error("wrong " + k + ": " + data.form[k]); }
+			}
+			`)
+			assert.NoError(t, err)
+		})
+		t.Run("SubmitForm/Fields", func(t *testing.T) {
+			_, err := common.RunString(rt, `
+			let data = http.get(formURL).submitForm({ formSelector: "#search", fields: { q: "load" } }).json();
+			if (data.method != "GET") { throw new Error("wrong method: " + data.method); }
+			if (data.form.q[0] != "load") { throw new Error("wrong q: " + data.form.q); }
+			if (data.form.old) { throw new Error("action query wasn't replaced"); }
+			`)
+			assert.NoError(t, err)
+		})
+		t.Run("SubmitForm/Missing", func(t *testing.T) {
+			_, err := common.RunString(rt, `http.get(formURL).submitForm({ formSelector: "#nope" })`)
+			assert.Contains(t, err.Error(), "no form found for selector '#nope'")
+		})
+		t.Run("ClickLink", func(t *testing.T) {
+			_, err := common.RunString(rt, `
+			let res = http.get(formURL);
+			let first = res.clickLink().json();
+			if (first.path != "/links/1") { throw new Error("wrong path: " + first.path); }
+			let second = res.clickLink({ selector: "#second" }).json();
+			if (second.path != "/links/2") { throw new Error("wrong path: " + second.path); }
+			`)
+			assert.NoError(t, err)
+		})
 	})
 }
+
+func TestRequestHTTP2(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Proto))
+	}))
+	srv.TLS = &tls.Config{NextProtos: []string{"h2", "http/1.1"}}
+	assert.NoError(t, http2.ConfigureServer(srv.Config, nil))
+	srv.StartTLS()
+	defer srv.Close()
+
+	root, err := lib.NewGroup("", nil)
+	assert.NoError(t, err)
+
+	transport := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	assert.NoError(t, http2.ConfigureTransport(transport))
+
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	state := &common.State{
+		Options:       lib.Options{MaxRedirects: null.IntFrom(10)},
+		Group:         root,
+		HTTPTransport: transport,
+	}
+
+	ctx := context.Background()
+	ctx = common.WithState(ctx, state)
+	ctx = common.WithRuntime(ctx, rt)
+	rt.Set("http", common.Bind(rt, &HTTP{}, &ctx))
+	rt.Set("url", srv.URL)
+
+	_, err = common.RunString(rt, `
+	let res = http.get(url);
+	if (res.status != 200) { throw new Error("wrong status: " + res.status); }
+	if (res.proto != "HTTP/2.0") { throw new Error("wrong proto: " + res.proto); }
+	if (res.body != "HTTP/2.0") { throw new Error("wrong body: " + res.body); }
+	`)
+	assert.NoError(t, err)
+	assertRequestMetricsEmitted(t, state.Samples, "GET", srv.URL, 200, "")
+	for _, sample := range state.Samples {
+		assert.Equal(t, "HTTP/2.0", sample.Tags["proto"])
+	}
+}
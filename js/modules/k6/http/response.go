@@ -0,0 +1,216 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package http
+
+import (
+	neturl "net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/pkg/errors"
+)
+
+// Submits a form on the page, with the values of its fields, and returns the response. Takes an
+// optional object of:
+//
+//	formSelector:   selects the form; defaults to "form", ie. the first one on the page
+//	submitSelector: selects the button it's submitted with; defaults to `[type="submit"]`
+//	fields:         values for fields, which override the ones on the page
+//	params:         params for the request, same as for http.request()
+func (res *HTTPResponse) SubmitForm(args ...goja.Value) *HTTPResponse {
+	rt := common.GetRuntime(res.ctx)
+
+	formSelector := "form"
+	submitSelector := `[type="submit"]`
+	var fields *goja.Object
+	params := goja.Undefined()
+	if len(args) > 0 && !goja.IsUndefined(args[0]) && !goja.IsNull(args[0]) {
+		opts := args[0].ToObject(rt)
+		for _, k := range opts.Keys() {
+			v := opts.Get(k)
+			switch k {
+			case "formSelector":
+				formSelector = v.String()
+			case "submitSelector":
+				submitSelector = v.String()
+			case "fields":
+				if !goja.IsUndefined(v) && !goja.IsNull(v) {
+					fields = v.ToObject(rt)
+				}
+			case "params":
+				params = v
+			}
+		}
+	}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(res.Body))
+	if err != nil {
+		common.Throw(rt, err)
+	}
+	form := doc.Find(formSelector).First()
+	if form.Length() == 0 {
+		common.Throw(rt, errors.Errorf("no form found for selector '%s' in response '%s'", formSelector, res.URL))
+	}
+
+	method := strings.ToUpper(form.AttrOr("method", "GET"))
+	action, err := res.resolveURL(form.AttrOr("action", ""))
+	if err != nil {
+		common.Throw(rt, err)
+	}
+
+	values := formValues(form)
+	if button := form.Find(submitSelector).First(); button.Length() > 0 {
+		if name := button.AttrOr("name", ""); name != "" {
+			values.Set(name, button.AttrOr("value", ""))
+		}
+	}
+	if fields != nil {
+		for _, k := range fields.Keys() {
+			values.Set(k, fields.Get(k).String())
+		}
+	}
+
+	// Like browsers do, GET forms replace the action's query string with the form's values.
+	body := goja.Undefined()
+	if method == "GET" || method == "HEAD" {
+		action.RawQuery = values.Encode()
+	} else {
+		body = rt.ToValue(values.Encode())
+	}
+
+	preq, err := (&HTTP{}).parseRequest(res.ctx, method, action.String(), body, params)
+	if err != nil {
+		common.Throw(rt, err)
+	}
+	if body != goja.Undefined() && preq.req.Header.Get("Content-Type") == "" {
+		preq.req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	return res.follow(preq)
+}
+
+// Follows a link on the page, and returns the response. Takes an optional object of:
+//
+//	selector: selects the link; defaults to "a[href]", ie. the first link on the page
+//	params:   params for the request, same as for http.request()
+func (res *HTTPResponse) ClickLink(args ...goja.Value) *HTTPResponse {
+	rt := common.GetRuntime(res.ctx)
+
+	selector := "a[href]"
+	params := goja.Undefined()
+	if len(args) > 0 && !goja.IsUndefined(args[0]) && !goja.IsNull(args[0]) {
+		opts := args[0].ToObject(rt)
+		for _, k := range opts.Keys() {
+			switch k {
+			case "selector":
+				selector = opts.Get(k).String()
+			case "params":
+				params = opts.Get(k)
+			}
+		}
+	}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(res.Body))
+	if err != nil {
+		common.Throw(rt, err)
+	}
+	link := doc.Find(selector).First()
+	if link.Length() == 0 {
+		common.Throw(rt, errors.Errorf("no element found for selector '%s' in response '%s'", selector, res.URL))
+	}
+	href, ok := link.Attr("href")
+	if !ok {
+		common.Throw(rt, errors.Errorf("element found for selector '%s' has no href attribute", selector))
+	}
+	u, err := res.resolveURL(href)
+	if err != nil {
+		common.Throw(rt, err)
+	}
+
+	preq, err := (&HTTP{}).parseRequest(res.ctx, "GET", u.String(), goja.Undefined(), params)
+	if err != nil {
+		common.Throw(rt, err)
+	}
+	return res.follow(preq)
+}
+
+// Makes a follow-up request, eg. for a form or a link, from the VU that made this one.
+func (res *HTTPResponse) follow(preq *parsedRequest) *HTTPResponse {
+	next, samples, err := (&HTTP{}).doRequest(res.ctx, preq)
+	state := common.GetState(res.ctx)
+	state.Samples = append(state.Samples, samples...)
+	if err != nil {
+		common.Throw(common.GetRuntime(res.ctx), err)
+	}
+	return next
+}
+
+// Resolves a URL found on the page, which may be relative to the page's own.
+func (res *HTTPResponse) resolveURL(ref string) (*neturl.URL, error) {
+	base, err := neturl.Parse(res.URL)
+	if err != nil {
+		return nil, err
+	}
+	u, err := neturl.Parse(ref)
+	if err != nil {
+		return nil, err
+	}
+	return base.ResolveReference(u), nil
+}
+
+// Returns the values a browser would submit for a form's fields, not counting buttons.
+func formValues(form *goquery.Selection) neturl.Values {
+	values := make(neturl.Values)
+	form.Find("input, select, textarea").Each(func(_ int, el *goquery.Selection) {
+		name := el.AttrOr("name", "")
+		if name == "" {
+			return
+		}
+		if _, disabled := el.Attr("disabled"); disabled {
+			return
+		}
+
+		switch goquery.NodeName(el) {
+		case "select":
+			opts := el.Find("option[selected]")
+			if _, multiple := el.Attr("multiple"); !multiple && opts.Length() == 0 {
+				opts = el.Find("option").First()
+			}
+			opts.Each(func(_ int, opt *goquery.Selection) {
+				values.Add(name, opt.AttrOr("value", opt.Text()))
+			})
+		case "textarea":
+			values.Add(name, el.Text())
+		default:
+			switch strings.ToLower(el.AttrOr("type", "text")) {
+			case "submit", "button", "image", "reset", "file":
+			case "checkbox", "radio":
+				if _, checked := el.Attr("checked"); checked {
+					values.Add(name, el.AttrOr("value", "on"))
+				}
+			default:
+				values.Add(name, el.AttrOr("value", ""))
+			}
+		}
+	})
+	return values
+}
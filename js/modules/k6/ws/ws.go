@@ -0,0 +1,408 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ws
+
+import (
+	"context"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/gorilla/websocket"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/netext"
+	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
+)
+
+// How long to wait for a control frame (close, ping) to be written before giving up.
+const writeWait = 10 * time.Second
+
+type WS struct{}
+
+type WSHTTPResponse struct {
+	URL     string
+	Status  int
+	Headers map[string]string
+}
+
+// Socket is the object passed to the setup function given to ws.connect().
+// All of its methods, as well as all event handlers, run on the VU's own goroutine; the
+// runtime is not threadsafe, so anything happening elsewhere is funneled through channels.
+type Socket struct {
+	ctx           context.Context
+	conn          *websocket.Conn
+	eventHandlers map[string][]goja.Callable
+	scheduled     chan goja.Callable
+	done          chan struct{}
+	shutdownOnce  sync.Once
+
+	tags    map[string]string
+	samples []stats.Sample
+
+	pingSendTimestamps map[string]time.Time
+	pingSendCounter    int
+
+	msgsSent, msgsReceived int
+}
+
+// Passed to "error" handlers.
+type SocketError struct {
+	err error
+}
+
+func (e *SocketError) Error() string {
+	return e.err.Error()
+}
+
+func (*WS) Connect(ctx context.Context, url string, args ...goja.Value) (*WSHTTPResponse, error) {
+	rt := common.GetRuntime(ctx)
+	state := common.GetState(ctx)
+
+	// The params argument is optional: ws.connect(url, [params], fn).
+	var paramsV, setupV goja.Value
+	switch len(args) {
+	case 1:
+		setupV = args[0]
+	case 2:
+		paramsV = args[0]
+		setupV = args[1]
+	default:
+		return nil, errors.New("ws.connect() takes a URL, optional params and a setup function")
+	}
+	setupFn, ok := goja.AssertFunction(setupV)
+	if !ok {
+		return nil, errors.New("last argument to ws.connect() must be a function")
+	}
+
+	header := make(http.Header)
+	tags := map[string]string{
+		"status": "0",
+		"url":    url,
+		"group":  state.Group.Path,
+	}
+
+	if paramsV != nil && !goja.IsUndefined(paramsV) && !goja.IsNull(paramsV) {
+		params := paramsV.ToObject(rt)
+		for _, k := range params.Keys() {
+			switch k {
+			case "headers":
+				headersV := params.Get(k)
+				if goja.IsUndefined(headersV) || goja.IsNull(headersV) {
+					continue
+				}
+				headers := headersV.ToObject(rt)
+				if headers == nil {
+					continue
+				}
+				for _, key := range headers.Keys() {
+					header.Set(key, headers.Get(key).String())
+				}
+			case "tags":
+				tagsV := params.Get(k)
+				if goja.IsUndefined(tagsV) || goja.IsNull(tagsV) {
+					continue
+				}
+				tagObj := tagsV.ToObject(rt)
+				if tagObj == nil {
+					continue
+				}
+				for _, key := range tagObj.Keys() {
+					tags[key] = tagObj.Get(key).String()
+				}
+			}
+		}
+	}
+
+	// Dial through the VU's own transport, so we get the same DNS cache and byte counting.
+	var netDial func(ctx context.Context, network, addr string) (net.Conn, error)
+	dialer := websocket.Dialer{}
+	host := ""
+	if u, err := neturl.Parse(url); err == nil {
+		host = u.Host
+	}
+	if t, ok := netext.TransportFor(state.HTTPTransport, host); ok {
+		netDial = t.DialContext
+		if t.TLSClientConfig != nil {
+			// WebSockets need HTTP/1.1; don't offer h2 over ALPN, as the HTTP transport does.
+			dialer.TLSClientConfig = t.TLSClientConfig.Clone()
+			dialer.TLSClientConfig.NextProtos = nil
+		}
+	}
+	if netDial == nil {
+		netDial = (&net.Dialer{}).DialContext
+	}
+	if state.CookieJar != nil {
+		dialer.Jar = state.CookieJar
+	}
+	tracer := netext.Tracer{}
+	traceCtx := netext.WithTracer(ctx, &tracer)
+	dialer.NetDial = func(network, addr string) (net.Conn, error) {
+		return netDial(traceCtx, network, addr)
+	}
+
+	start := time.Now()
+	conn, res, err := dialer.Dial(url, header)
+	connectionDuration := stats.D(time.Since(start))
+	if err != nil {
+		state.Samples = append(state.Samples, stats.Sample{
+			Metric: metrics.WSConnecting, Time: start, Tags: tags, Value: connectionDuration,
+		})
+		return nil, err
+	}
+	tags["status"] = strconv.Itoa(res.StatusCode)
+	if proto := res.Header.Get("Sec-WebSocket-Protocol"); proto != "" {
+		tags["subproto"] = proto
+	}
+
+	socket := &Socket{
+		ctx:                ctx,
+		conn:               conn,
+		eventHandlers:      make(map[string][]goja.Callable),
+		scheduled:          make(chan goja.Callable),
+		done:               make(chan struct{}),
+		tags:               tags,
+		pingSendTimestamps: make(map[string]time.Time),
+	}
+
+	// Run the user's setup function, which registers handlers, then fire "open".
+	if _, err := setupFn(goja.Undefined(), rt.ToValue(socket)); err != nil {
+		_ = socket.closeConnection(websocket.CloseGoingAway)
+		return nil, err
+	}
+	err = socket.handleEvent("open")
+
+	pongChan := make(chan string)
+	readDataChan := make(chan []byte)
+	readErrChan := make(chan error)
+	readerDone := make(chan struct{})
+	conn.SetPongHandler(func(appData string) error {
+		select {
+		case pongChan <- appData:
+		case <-socket.done:
+		}
+		return nil
+	})
+	go socket.readPump(readDataChan, readErrChan, readerDone)
+
+	for err == nil && !socket.isClosed() {
+		select {
+		case msg := <-readDataChan:
+			socket.msgsReceived++
+			err = socket.handleEvent("message", rt.ToValue(string(msg)))
+		case pingID := <-pongChan:
+			if sent, ok := socket.pingSendTimestamps[pingID]; ok {
+				delete(socket.pingSendTimestamps, pingID)
+				socket.samples = append(socket.samples, stats.Sample{
+					Metric: metrics.WSPing, Time: time.Now(), Tags: tags, Value: stats.D(time.Since(sent)),
+				})
+			}
+			err = socket.handleEvent("pong")
+		case readErr := <-readErrChan:
+			if closeErr, ok := readErr.(*websocket.CloseError); ok {
+				err = socket.closeConnection(closeErr.Code)
+				break
+			}
+			if err = socket.handleEvent("error", rt.ToValue(&SocketError{readErr})); err == nil {
+				err = socket.closeConnection(websocket.CloseGoingAway)
+			}
+		case fn := <-socket.scheduled:
+			_, err = fn(goja.Undefined())
+		case <-ctx.Done():
+			err = socket.closeConnection(websocket.CloseGoingAway)
+		}
+	}
+
+	// A handler may have thrown; make sure the connection is closed either way.
+	if closeErr := socket.closeConnection(websocket.CloseGoingAway); err == nil {
+		err = closeErr
+	}
+	<-readerDone
+
+	end := time.Now()
+	trail := tracer.Done()
+	state.Samples = append(state.Samples, socket.samples...)
+	state.Samples = append(state.Samples,
+		stats.Sample{Metric: metrics.WSSessions, Time: start, Tags: tags, Value: 1},
+		stats.Sample{Metric: metrics.WSConnecting, Time: start, Tags: tags, Value: connectionDuration},
+		stats.Sample{Metric: metrics.WSSessionDuration, Time: end, Tags: tags, Value: stats.D(end.Sub(start))},
+		stats.Sample{Metric: metrics.WSMessagesSent, Time: end, Tags: tags, Value: float64(socket.msgsSent)},
+		stats.Sample{Metric: metrics.WSMessagesReceived, Time: end, Tags: tags, Value: float64(socket.msgsReceived)},
+		stats.Sample{Metric: metrics.DataSent, Time: end, Tags: tags, Value: float64(trail.BytesWritten)},
+		stats.Sample{Metric: metrics.DataReceived, Time: end, Tags: tags, Value: float64(trail.BytesRead)},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := make(map[string]string, len(res.Header))
+	for k, vs := range res.Header {
+		headers[k] = strings.Join(vs, ", ")
+	}
+	return &WSHTTPResponse{
+		URL:     url,
+		Status:  res.StatusCode,
+		Headers: headers,
+	}, nil
+}
+
+// Registers a handler for an event; one of "open", "message", "pong", "error" or "close".
+func (s *Socket) On(event string, handler goja.Value) {
+	fn, ok := goja.AssertFunction(handler)
+	if !ok {
+		common.Throw(common.GetRuntime(s.ctx), errors.Errorf("handler for '%s' is not a function", event))
+	}
+	s.eventHandlers[event] = append(s.eventHandlers[event], fn)
+}
+
+func (s *Socket) Send(message string) {
+	rt := common.GetRuntime(s.ctx)
+	if err := s.conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+		if herr := s.handleEvent("error", rt.ToValue(&SocketError{err})); herr != nil {
+			common.Throw(rt, herr)
+		}
+		return
+	}
+	s.msgsSent++
+}
+
+// Sends a ping; the round trip time is recorded in ws_ping when the pong arrives.
+func (s *Socket) Ping() {
+	rt := common.GetRuntime(s.ctx)
+	pingID := strconv.Itoa(s.pingSendCounter)
+	deadline := time.Now().Add(writeWait)
+	if err := s.conn.WriteControl(websocket.PingMessage, []byte(pingID), deadline); err != nil {
+		if herr := s.handleEvent("error", rt.ToValue(&SocketError{err})); herr != nil {
+			common.Throw(rt, herr)
+		}
+		return
+	}
+	s.pingSendTimestamps[pingID] = time.Now()
+	s.pingSendCounter++
+}
+
+func (s *Socket) SetTimeout(fn goja.Callable, ms float64) {
+	go func() {
+		select {
+		case <-time.After(time.Duration(ms * float64(time.Millisecond))):
+			select {
+			case s.scheduled <- fn:
+			case <-s.done:
+			}
+		case <-s.done:
+		}
+	}()
+}
+
+func (s *Socket) SetInterval(fn goja.Callable, ms float64) {
+	rt := common.GetRuntime(s.ctx)
+	if ms <= 0 {
+		common.Throw(rt, errors.New("setInterval requires a positive interval"))
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(ms * float64(time.Millisecond)))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				select {
+				case s.scheduled <- fn:
+				case <-s.done:
+					return
+				}
+			case <-s.done:
+				return
+			}
+		}
+	}()
+}
+
+// Closes the connection, with an optional close code (default 1000).
+func (s *Socket) Close(args ...goja.Value) {
+	code := websocket.CloseNormalClosure
+	if len(args) > 0 && !goja.IsUndefined(args[0]) && !goja.IsNull(args[0]) {
+		code = int(args[0].ToInteger())
+	}
+	if err := s.closeConnection(code); err != nil {
+		common.Throw(common.GetRuntime(s.ctx), err)
+	}
+}
+
+// Calls all handlers registered for an event, stopping at the first one that throws.
+func (s *Socket) handleEvent(event string, args ...goja.Value) error {
+	for _, fn := range s.eventHandlers[event] {
+		if _, err := fn(goja.Undefined(), args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sends a close frame, fires "close" and tears down the connection. Safe to call repeatedly;
+// only the first call has any effect.
+func (s *Socket) closeConnection(code int) error {
+	var err error
+	s.shutdownOnce.Do(func() {
+		// The peer may already be gone, so a failure to say goodbye isn't interesting.
+		deadline := time.Now().Add(writeWait)
+		_ = s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""), deadline)
+		_ = s.conn.Close()
+		close(s.done)
+
+		err = s.handleEvent("close", common.GetRuntime(s.ctx).ToValue(code))
+	})
+	return err
+}
+
+func (s *Socket) isClosed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Reads messages off the connection until it's closed, handing them over to the event loop.
+func (s *Socket) readPump(dataChan chan<- []byte, errChan chan<- error, done chan<- struct{}) {
+	defer close(done)
+	for {
+		_, msg, err := s.conn.ReadMessage()
+		if err != nil {
+			select {
+			case errChan <- err:
+			case <-s.done:
+			}
+			return
+		}
+		select {
+		case dataChan <- msg:
+		case <-s.done:
+			return
+		}
+	}
+}
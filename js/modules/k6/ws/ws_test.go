@@ -0,0 +1,209 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ws
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/gorilla/websocket"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/netext"
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+func assertSessionMetricsEmitted(t *testing.T, samples []stats.Sample, url string, status int, group string) {
+	seenSessions := false
+	seenSessionDuration := false
+	seenConnecting := false
+	for _, sample := range samples {
+		if sample.Tags["url"] == url {
+			switch sample.Metric {
+			case metrics.WSSessions:
+				seenSessions = true
+			case metrics.WSSessionDuration:
+				seenSessionDuration = true
+			case metrics.WSConnecting:
+				seenConnecting = true
+			}
+
+			assert.Equal(t, strconv.Itoa(status), sample.Tags["status"])
+			assert.Equal(t, group, sample.Tags["group"])
+		}
+	}
+	assert.True(t, seenSessions, "url %s didn't emit Sessions", url)
+	assert.True(t, seenSessionDuration, "url %s didn't emit SessionDuration", url)
+	assert.True(t, seenConnecting, "url %s didn't emit Connecting", url)
+}
+
+func assertMetricEmitted(t *testing.T, metric *stats.Metric, samples []stats.Sample, url string) float64 {
+	seen := false
+	total := 0.0
+	for _, sample := range samples {
+		if sample.Metric == metric && sample.Tags["url"] == url {
+			seen = true
+			total += sample.Value
+		}
+	}
+	assert.True(t, seen, "url %s didn't emit %s", url, metric.Name)
+	return total
+}
+
+func TestSession(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, req, nil)
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		for {
+			mt, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteMessage(mt, msg); err != nil {
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	root, err := lib.NewGroup("", nil)
+	assert.NoError(t, err)
+
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	state := &common.State{
+		Group: root,
+		HTTPTransport: &http.Transport{
+			DialContext: (netext.NewDialer(net.Dialer{
+				Timeout:   10 * time.Second,
+				KeepAlive: 60 * time.Second,
+				DualStack: true,
+			})).DialContext,
+		},
+	}
+
+	ctx := context.Background()
+	ctx = common.WithState(ctx, state)
+	ctx = common.WithRuntime(ctx, rt)
+	rt.Set("ws", common.Bind(rt, &WS{}, &ctx))
+	rt.Set("url", url)
+
+	t.Run("Echo", func(t *testing.T) {
+		state.Samples = nil
+		_, err := common.RunString(rt, `
+		let res = ws.connect(url, function(socket) {
+			socket.on("open", function() { socket.send("hello"); });
+			socket.on("message", function(data) {
+				if (data != "hello") { throw new Error("wrong message: " + data); }
+				socket.close();
+			});
+		});
+		if (res.status != 101) { throw new Error("wrong status: " + res.status); }
+		`)
+		assert.NoError(t, err)
+		assertSessionMetricsEmitted(t, state.Samples, url, 101, "")
+		assert.Equal(t, 1.0, assertMetricEmitted(t, metrics.WSMessagesSent, state.Samples, url))
+		assert.Equal(t, 1.0, assertMetricEmitted(t, metrics.WSMessagesReceived, state.Samples, url))
+	})
+	t.Run("Close", func(t *testing.T) {
+		state.Samples = nil
+		_, err := common.RunString(rt, `
+		let closed = false;
+		ws.connect(url, function(socket) {
+			socket.on("open", function() { socket.close(); });
+			socket.on("close", function() { closed = true; });
+		});
+		if (!closed) { throw new Error("close handler wasn't called"); }
+		`)
+		assert.NoError(t, err)
+		assertSessionMetricsEmitted(t, state.Samples, url, 101, "")
+	})
+	t.Run("Ping", func(t *testing.T) {
+		state.Samples = nil
+		_, err := common.RunString(rt, `
+		ws.connect(url, function(socket) {
+			socket.on("open", function() { socket.ping(); });
+			socket.on("pong", function() { socket.close(); });
+		});
+		`)
+		assert.NoError(t, err)
+		assertMetricEmitted(t, metrics.WSPing, state.Samples, url)
+	})
+	t.Run("SetTimeout", func(t *testing.T) {
+		state.Samples = nil
+		_, err := common.RunString(rt, `
+		let fired = false;
+		ws.connect(url, function(socket) {
+			socket.setTimeout(function() { fired = true; socket.close(); }, 10);
+		});
+		if (!fired) { throw new Error("timeout didn't fire"); }
+		`)
+		assert.NoError(t, err)
+	})
+	t.Run("SetInterval", func(t *testing.T) {
+		state.Samples = nil
+		_, err := common.RunString(rt, `
+		let ticks = 0;
+		ws.connect(url, function(socket) {
+			socket.setInterval(function() { if (++ticks == 3) { socket.close(); } }, 5);
+		});
+		if (ticks != 3) { throw new Error("wrong number of ticks: " + ticks); }
+		`)
+		assert.NoError(t, err)
+	})
+	t.Run("Params", func(t *testing.T) {
+		state.Samples = nil
+		_, err := common.RunString(rt, `
+		ws.connect(url, { tags: { tag: "value" } }, function(socket) {
+			socket.on("open", function() { socket.close(); });
+		});
+		`)
+		assert.NoError(t, err)
+		for _, sample := range state.Samples {
+			assert.Equal(t, "value", sample.Tags["tag"])
+		}
+	})
+	t.Run("Throw", func(t *testing.T) {
+		_, err := common.RunString(rt, `
+		ws.connect(url, function(socket) {
+			socket.on("open", function() { throw new Error("oops"); });
+		});
+		`)
+		assert.Error(t, err)
+	})
+	t.Run("Unroutable", func(t *testing.T) {
+		_, err := common.RunString(rt, `ws.connect("ws://sdafsgdhfjg/", function(socket) {});`)
+		assert.Error(t, err)
+	})
+}
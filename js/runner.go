@@ -22,8 +22,11 @@ package js
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
 	"net"
 	"net/http"
+	"net/http/cookiejar"
 	"time"
 
 	"github.com/dop251/goja"
@@ -31,7 +34,10 @@ import (
 	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/lib/netext"
 	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
 	"github.com/spf13/afero"
+	"github.com/viki-org/dnscache"
+	"golang.org/x/net/http2"
 )
 
 type Runner struct {
@@ -39,20 +45,35 @@ type Runner struct {
 	defaultGroup *lib.Group
 
 	Dialer *netext.Dialer
+	dnsTTL time.Duration
+
+	// JSON-encoded return value of setup(), handed to each iteration and teardown().
+	setupData []byte
+}
+
+func New(src *lib.SourceData, fs afero.Fs, env map[string]string) (*Runner, error) {
+	bundle, err := NewBundle(src, fs, env)
+	if err != nil {
+		return nil, err
+	}
+	return newFromBundle(bundle)
 }
 
-func New(src *lib.SourceData, fs afero.Fs) (*Runner, error) {
-	bundle, err := NewBundle(src, fs)
+func NewFromArchive(arc *lib.Archive) (*Runner, error) {
+	bundle, err := NewBundleFromArchive(arc)
 	if err != nil {
 		return nil, err
 	}
+	return newFromBundle(bundle)
+}
 
+func newFromBundle(bundle *Bundle) (*Runner, error) {
 	defaultGroup, err := lib.NewGroup("", nil)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Runner{
+	r := &Runner{
 		Bundle:       bundle,
 		defaultGroup: defaultGroup,
 		Dialer: netext.NewDialer(net.Dialer{
@@ -60,7 +81,29 @@ func New(src *lib.SourceData, fs afero.Fs) (*Runner, error) {
 			KeepAlive: 30 * time.Second,
 			DualStack: true,
 		}),
-	}, nil
+	}
+	r.configureDialer()
+	return r, nil
+}
+
+// Applies the DNS options to the dialer; they're validated when they're parsed.
+func (r *Runner) configureDialer() {
+	opts := r.Bundle.Options
+	r.Dialer.Hosts = opts.Hosts
+	r.Dialer.Select = opts.DNS.Select.String
+
+	ttl, _ := lib.ParseDNSTTL(opts.DNS.TTL.String)
+	switch {
+	case ttl < 0:
+		r.Dialer.Resolver = nil
+	case ttl != r.dnsTTL || r.Dialer.Resolver == nil:
+		r.Dialer.Resolver = dnscache.New(ttl)
+	}
+	r.dnsTTL = ttl
+}
+
+func (r *Runner) MakeArchive() *lib.Archive {
+	return r.Bundle.MakeArchive()
 }
 
 func (r *Runner) NewVU() (lib.VU, error) {
@@ -77,12 +120,20 @@ func (r *Runner) newVU() (*VU, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := checkScenarios(r.Bundle.Options, bi); err != nil {
+		return nil, err
+	}
+
+	transport, err := r.newTransport()
+	if err != nil {
+		return nil, err
+	}
 
 	// Make a VU, apply the VU context.
 	vu := &VU{
 		BundleInstance: *bi,
 		Runner:         r,
-		HTTPTransport:  &http.Transport{DialContext: r.Dialer.DialContext},
+		HTTPTransport:  transport,
 		VUContext:      NewVUContext(),
 	}
 	common.BindToGlobal(vu.Runtime, common.Bind(vu.Runtime, vu.VUContext, vu.Context))
@@ -95,6 +146,167 @@ func (r *Runner) newVU() (*VU, error) {
 	return vu, nil
 }
 
+// Checks that every scenario has a function to run. NewBundle() only checks the script's own
+// options; by now, they may have been replaced by ones from a config file or an archive.
+func checkScenarios(opts lib.Options, bi *BundleInstance) error {
+	needsDefault := len(opts.Scenarios) == 0
+	for name, sc := range opts.Scenarios {
+		if !sc.Exec.Valid || sc.Exec.String == "" || sc.Exec.String == "default" {
+			needsDefault = true
+			continue
+		}
+		if _, ok := bi.Exports[sc.Exec.String]; !ok {
+			return errors.Errorf("scenario %s: exec function %s is not exported", name, sc.Exec.String)
+		}
+	}
+	if needsDefault && bi.Default == nil {
+		return errors.New("script must export a default function")
+	}
+	return nil
+}
+
+// Makes a VU's transport; hosts with client certificates get transports of their own.
+func (r *Runner) newTransport() (*netext.HostTransport, error) {
+	opts := r.Bundle.Options
+	def, err := r.newHTTPTransport(opts.TLSConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &netext.HostTransport{Default: def}
+	for _, auth := range opts.TLSAuth {
+		cert, err := auth.Certificate()
+		if err != nil {
+			return nil, err
+		}
+		config := opts.TLSConfig()
+		config.Certificates = []tls.Certificate{*cert}
+		t, err := r.newHTTPTransport(config)
+		if err != nil {
+			return nil, err
+		}
+		transport.Routes = append(transport.Routes, netext.HostRoute{Match: auth.Matches, Transport: t})
+	}
+	return transport, nil
+}
+
+func (r *Runner) newHTTPTransport(config *tls.Config) (*http.Transport, error) {
+	t := &http.Transport{
+		DialContext:       r.Dialer.DialContext,
+		TLSClientConfig:   config,
+		DisableKeepAlives: r.Bundle.Options.NoConnectionReuse.Bool,
+	}
+
+	// HTTP/2 is only enabled by default for transports without a custom dialer or TLS config.
+	if err := http2.ConfigureTransport(t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (r *Runner) Setup(ctx context.Context) ([]stats.Sample, error) {
+	v, samples, err := r.runPart(ctx, "setup", "setup", nil)
+	if err != nil || v == nil || goja.IsUndefined(v) {
+		return samples, err
+	}
+
+	data, err := json.Marshal(v.Export())
+	if err != nil {
+		return samples, errors.Wrap(err, "setup() must return a JSON-serializable value")
+	}
+	r.setupData = data
+	return samples, nil
+}
+
+func (r *Runner) GetSetupData() []byte {
+	return r.setupData
+}
+
+func (r *Runner) SetSetupData(data []byte) {
+	r.setupData = data
+}
+
+func (r *Runner) Teardown(ctx context.Context) ([]stats.Sample, error) {
+	_, samples, err := r.runPart(ctx, "teardown", "teardown", r.setupData)
+	return samples, err
+}
+
+// Calls handleSummary(), if exported, with the summary; it returns an object mapping paths (or
+// "stdout", "stderr") to the contents to write there, as strings or byte arrays.
+func (r *Runner) HandleSummary(ctx context.Context, summary *lib.Summary) (map[string][]byte, error) {
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return nil, err
+	}
+	v, _, err := r.runPart(ctx, "handleSummary", "", data)
+	if err != nil || v == nil || goja.IsUndefined(v) || goja.IsNull(v) {
+		return nil, err
+	}
+
+	reports, ok := v.Export().(map[string]interface{})
+	if !ok {
+		return nil, errors.New("handleSummary() must return an object")
+	}
+	out := make(map[string][]byte, len(reports))
+	for k, report := range reports {
+		switch report := report.(type) {
+		case []byte:
+			out[k] = report
+		case string:
+			out[k] = []byte(report)
+		default:
+			return nil, errors.Errorf("handleSummary(): %s must be a string or a byte array", k)
+		}
+	}
+	return out, nil
+}
+
+// Runs an exported lifecycle function, if there is one, in a VU of its own. Any metrics it emits
+// are tagged with the given group, or the root group if that's empty.
+func (r *Runner) runPart(ctx context.Context, name, groupName string, arg []byte) (goja.Value, []stats.Sample, error) {
+	vu, err := r.newVU()
+	if err != nil {
+		return nil, nil, err
+	}
+	fn, ok := vu.Exports[name]
+	if !ok {
+		return nil, nil, nil
+	}
+
+	group := r.defaultGroup
+	if groupName != "" {
+		if group, err = r.defaultGroup.Group(groupName); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Cookies set here, eg. by logging in during setup(), last as long as the call does.
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	vu.CookieJar = jar
+
+	state := &common.State{
+		Options:       r.Bundle.Options,
+		Group:         group,
+		HTTPTransport: vu.HTTPTransport,
+		CookieJar:     vu.CookieJar,
+	}
+
+	ctx = common.WithRuntime(ctx, vu.Runtime)
+	ctx = common.WithState(ctx, state)
+	*vu.Context = ctx
+
+	args, err := vu.setupDataArgs(arg)
+	if err != nil {
+		return nil, nil, err
+	}
+	v, err := fn(goja.Undefined(), args...)
+	vu.HTTPTransport.CloseIdleConnections()
+	return v, state.Samples, err
+}
+
 func (r *Runner) GetDefaultGroup() *lib.Group {
 	return r.defaultGroup
 }
@@ -105,13 +317,15 @@ func (r *Runner) GetOptions() lib.Options {
 
 func (r *Runner) ApplyOptions(opts lib.Options) {
 	r.Bundle.Options = r.Bundle.Options.Apply(opts)
+	r.configureDialer()
 }
 
 type VU struct {
 	BundleInstance
 
 	Runner        *Runner
-	HTTPTransport *http.Transport
+	HTTPTransport *netext.HostTransport
+	CookieJar     *cookiejar.Jar
 	ID            int64
 	Iteration     int64
 
@@ -123,6 +337,7 @@ func (u *VU) RunOnce(ctx context.Context) ([]stats.Sample, error) {
 		Options:       u.Runner.Bundle.Options,
 		Group:         u.Runner.defaultGroup,
 		HTTPTransport: u.HTTPTransport,
+		CookieJar:     u.CookieJar,
 	}
 
 	ctx = common.WithRuntime(ctx, u.Runtime)
@@ -132,15 +347,50 @@ func (u *VU) RunOnce(ctx context.Context) ([]stats.Sample, error) {
 	u.Runtime.Set("__ITER", u.Iteration)
 	u.Iteration++
 
-	_, err := u.Default(goja.Undefined())
+	// Scenarios may run a different exported function; they're validated in newVU().
+	fn := u.Default
+	if sc := lib.GetScenario(ctx); sc != nil && sc.Exec.Valid && sc.Exec.String != "" {
+		var ok bool
+		if fn, ok = u.Exports[sc.Exec.String]; !ok {
+			return nil, errors.Errorf("scenario %s: exec function %s is not exported", sc.Name, sc.Exec.String)
+		}
+	}
+	if fn == nil {
+		return nil, errors.New("script must export a default function")
+	}
+	args, err := u.setupDataArgs(u.Runner.setupData)
+	if err != nil {
+		return nil, err
+	}
+	_, err = fn(goja.Undefined(), args...)
 
-	if u.Runner.Bundle.Options.NoConnectionReuse.Bool {
+	if u.Runner.Bundle.Options.NoVUConnectionReuse.Bool {
 		u.HTTPTransport.CloseIdleConnections()
 	}
 	return state.Samples, err
 }
 
+// Decodes setup() data into a fresh value in the VU's runtime, so no iteration sees another's
+// modifications to it.
+func (u *VU) setupDataArgs(data []byte) ([]goja.Value, error) {
+	if data == nil {
+		return nil, nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return []goja.Value{u.Runtime.ToValue(v)}, nil
+}
+
 func (u *VU) Reconfigure(id int64) error {
+	// A new identity gets a clean cookie jar.
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return err
+	}
+	u.CookieJar = jar
+
 	u.ID = id
 	u.Iteration = 0
 	u.Runtime.Set("__VU", u.ID)
@@ -42,7 +42,7 @@ func TestRunnerNew(t *testing.T) {
 			let counter = 0;
 			export default function() { counter++; }
 		`),
-		}, afero.NewMemMapFs())
+		}, afero.NewMemMapFs(), nil)
 		assert.NoError(t, err)
 
 		t.Run("NewVU", func(t *testing.T) {
@@ -63,7 +63,7 @@ func TestRunnerNew(t *testing.T) {
 		_, err := New(&lib.SourceData{
 			Filename: "/script.js",
 			Data:     []byte(`blarg`),
-		}, afero.NewMemMapFs())
+		}, afero.NewMemMapFs(), nil)
 		assert.EqualError(t, err, "ReferenceError: blarg is not defined at /script.js:1:14(0)")
 	})
 }
@@ -72,7 +72,7 @@ func TestRunnerGetDefaultGroup(t *testing.T) {
 	r, err := New(&lib.SourceData{
 		Filename: "/script.js",
 		Data:     []byte(`export default function() {};`),
-	}, afero.NewMemMapFs())
+	}, afero.NewMemMapFs(), nil)
 	assert.NoError(t, err)
 	assert.NotNil(t, r.GetDefaultGroup())
 }
@@ -81,7 +81,7 @@ func TestRunnerOptions(t *testing.T) {
 	r, err := New(&lib.SourceData{
 		Filename: "/script.js",
 		Data:     []byte(`export default function() {};`),
-	}, afero.NewMemMapFs())
+	}, afero.NewMemMapFs(), nil)
 	assert.NoError(t, err)
 
 	assert.Equal(t, r.Bundle.Options, r.GetOptions())
@@ -94,6 +94,55 @@ func TestRunnerOptions(t *testing.T) {
 	assert.Equal(t, null.NewBool(false, true), r.Bundle.Options.Paused)
 }
 
+func TestRunnerScenarios(t *testing.T) {
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+			export function api() {};
+			export default function() {};
+		`),
+	}, afero.NewMemMapFs(), nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	t.Run("Exec", func(t *testing.T) {
+		r.ApplyOptions(lib.Options{Scenarios: map[string]lib.Scenario{
+			"api": {VUs: null.IntFrom(1), Duration: time.Minute, Exec: null.StringFrom("api")},
+		}})
+		vu, err := r.NewVU()
+		if assert.NoError(t, err) {
+			sc := &lib.Scenario{Name: "api", Exec: null.StringFrom("api")}
+			_, err := vu.RunOnce(lib.WithScenario(context.Background(), sc))
+			assert.NoError(t, err)
+		}
+	})
+	t.Run("ExecMissing", func(t *testing.T) {
+		r.ApplyOptions(lib.Options{Scenarios: map[string]lib.Scenario{
+			"api": {VUs: null.IntFrom(1), Duration: time.Minute, Exec: null.StringFrom("nope")},
+		}})
+		_, err := r.NewVU()
+		assert.EqualError(t, err, "scenario api: exec function nope is not exported")
+
+		r2, err := NewFromArchive(r.MakeArchive())
+		if assert.NoError(t, err) {
+			_, err := r2.NewVU()
+			assert.EqualError(t, err, "scenario api: exec function nope is not exported")
+		}
+	})
+	t.Run("RunOnce", func(t *testing.T) {
+		r.ApplyOptions(lib.Options{Scenarios: map[string]lib.Scenario{
+			"api": {VUs: null.IntFrom(1), Duration: time.Minute, Exec: null.StringFrom("api")},
+		}})
+		vu, err := r.NewVU()
+		if assert.NoError(t, err) {
+			sc := &lib.Scenario{Name: "api", Exec: null.StringFrom("nope")}
+			_, err := vu.RunOnce(lib.WithScenario(context.Background(), sc))
+			assert.EqualError(t, err, "scenario api: exec function nope is not exported")
+		}
+	})
+}
+
 func TestRunnerIntegrationImports(t *testing.T) {
 	t.Run("Modules", func(t *testing.T) {
 		modules := []string{
@@ -107,7 +156,7 @@ func TestRunnerIntegrationImports(t *testing.T) {
 				_, err := New(&lib.SourceData{
 					Filename: "/script.js",
 					Data:     []byte(fmt.Sprintf(`import "%s"; export default function() {}`, mod)),
-				}, afero.NewMemMapFs())
+				}, afero.NewMemMapFs(), nil)
 				assert.NoError(t, err)
 			})
 		}
@@ -134,7 +183,7 @@ func TestRunnerIntegrationImports(t *testing.T) {
 					export default function() {
 						if (hi != "hi!") { throw new Error("incorrect value"); }
 					}`, data.path)),
-				}, fs)
+				}, fs, nil)
 				if !assert.NoError(t, err) {
 					return
 				}
@@ -157,7 +206,7 @@ func TestVURunContext(t *testing.T) {
 		export let options = { vus: 10 };
 		export default function() { fn(); }
 		`),
-	}, afero.NewMemMapFs())
+	}, afero.NewMemMapFs(), nil)
 	if !assert.NoError(t, err) {
 		return
 	}
@@ -189,7 +238,7 @@ func TestVURunSamples(t *testing.T) {
 	r, err := New(&lib.SourceData{
 		Filename: "/script.js",
 		Data:     []byte(`export default function() { fn(); }`),
-	}, afero.NewMemMapFs())
+	}, afero.NewMemMapFs(), nil)
 	if !assert.NoError(t, err) {
 		return
 	}
@@ -226,7 +275,7 @@ func TestVUIntegrationGroups(t *testing.T) {
 			});
 		}
 		`),
-	}, afero.NewMemMapFs())
+	}, afero.NewMemMapFs(), nil)
 	if !assert.NoError(t, err) {
 		return
 	}
@@ -272,7 +321,7 @@ func TestVUIntegrationMetrics(t *testing.T) {
 		let myMetric = new Trend("my_metric");
 		export default function() { myMetric.add(5); }
 		`),
-	}, afero.NewMemMapFs())
+	}, afero.NewMemMapFs(), nil)
 	if !assert.NoError(t, err) {
 		return
 	}
@@ -289,3 +338,154 @@ func TestVUIntegrationMetrics(t *testing.T) {
 		assert.Equal(t, stats.Trend, samples[0].Metric.Type)
 	}
 }
+
+func TestRunnerSetupTeardown(t *testing.T) {
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+			export function setup() {
+				return { v: 1 };
+			}
+			export default function(data) {
+				if (data.v !== 1) { throw new Error("default: wrong data: " + JSON.stringify(data)); }
+				data.v = 2;
+			}
+			export function teardown(data) {
+				if (data.v !== 1) { throw new Error("teardown: wrong data: " + JSON.stringify(data)); }
+			}
+		`),
+	}, afero.NewMemMapFs(), nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = r.Setup(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, `{"v":1}`, string(r.setupData))
+
+	vu, err := r.NewVU()
+	if !assert.NoError(t, err) {
+		return
+	}
+	for i := 0; i < 2; i++ {
+		_, err = vu.RunOnce(context.Background())
+		assert.NoError(t, err)
+	}
+
+	_, err = r.Teardown(context.Background())
+	assert.NoError(t, err)
+
+	t.Run("CookieJar", func(t *testing.T) {
+		r, err := New(&lib.SourceData{
+			Filename: "/script.js",
+			Data: []byte(`
+				import http from "k6/http";
+				export function setup() {
+					let jar = http.cookieJar();
+					jar.set("http://example.com/", "session", "abc");
+					return jar.cookiesForURL("http://example.com/");
+				}
+				export default function() {}
+			`),
+		}, afero.NewMemMapFs(), nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = r.Setup(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, `{"session":["abc"]}`, string(r.setupData))
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		r, err := New(&lib.SourceData{
+			Filename: "/script.js",
+			Data:     []byte(`export default function(data) { if (data !== undefined) { throw new Error("data"); } }`),
+		}, afero.NewMemMapFs(), nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = r.Setup(context.Background())
+		assert.NoError(t, err)
+		assert.Nil(t, r.setupData)
+
+		vu, err := r.NewVU()
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = vu.RunOnce(context.Background())
+		assert.NoError(t, err)
+		_, err = r.Teardown(context.Background())
+		assert.NoError(t, err)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := New(&lib.SourceData{
+			Filename: "/script.js",
+			Data:     []byte(`export let setup = 1; export default function() {}`),
+		}, afero.NewMemMapFs(), nil)
+		assert.EqualError(t, err, "exported setup must be a function")
+	})
+}
+
+func TestRunnerHandleSummary(t *testing.T) {
+	summary := &lib.Summary{
+		Duration: 1000,
+		Metrics: map[string]lib.SummaryMetric{
+			"my_metric": {Type: stats.Counter, Contains: stats.Default, Values: map[string]float64{"count": 2}},
+		},
+		RootGroup: lib.SummaryGroup{Groups: []lib.SummaryGroup{}, Checks: []lib.SummaryCheck{}},
+	}
+
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+			export default function() {}
+			export function handleSummary(data) {
+				return {
+					"stdout": "count=" + data.metrics.my_metric.values.count,
+					"/summary.json": JSON.stringify(data),
+				};
+			}
+		`),
+	}, afero.NewMemMapFs(), nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	reports, err := r.HandleSummary(context.Background(), summary)
+	assert.NoError(t, err)
+	assert.Equal(t, "count=2", string(reports["stdout"]))
+	assert.Contains(t, string(reports["/summary.json"]), `"root_group"`)
+
+	t.Run("Missing", func(t *testing.T) {
+		r, err := New(&lib.SourceData{
+			Filename: "/script.js",
+			Data:     []byte(`export default function() {}`),
+		}, afero.NewMemMapFs(), nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		reports, err := r.HandleSummary(context.Background(), summary)
+		assert.NoError(t, err)
+		assert.Nil(t, reports)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		testdata := map[string]string{
+			`return 1;`:               "handleSummary() must return an object",
+			`return { "stdout": 1 };`: "handleSummary(): stdout must be a string or a byte array",
+		}
+		for src, msg := range testdata {
+			t.Run(src, func(t *testing.T) {
+				r, err := New(&lib.SourceData{
+					Filename: "/script.js",
+					Data:     []byte(`export default function() {}; export function handleSummary() { ` + src + ` }`),
+				}, afero.NewMemMapFs(), nil)
+				if !assert.NoError(t, err) {
+					return
+				}
+				_, err = r.HandleSummary(context.Background(), summary)
+				assert.EqualError(t, err, msg)
+			})
+		}
+	})
+}
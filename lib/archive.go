@@ -0,0 +1,199 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// tarMagic is found at offset 257 of every POSIX (ustar) tar file.
+var tarMagic = []byte("ustar")
+
+// IsArchive returns whether the data looks like a tar file, eg. one written by Archive.Write.
+func IsArchive(data []byte) bool {
+	return len(data) >= 262 && bytes.Equal(data[257:262], tarMagic)
+}
+
+// An Archive is a script bundled up with everything it needs to run: all scripts it imports,
+// all files it open()s, and the options it was created with. Running it doesn't touch the
+// filesystem or the network to load anything.
+type Archive struct {
+	// The runner to use, eg. "js".
+	Type string `json:"type"`
+
+	// Options to run the test with.
+	Options Options `json:"options"`
+
+	// Environment variables given when archiving, which the script sees in __ENV; the rest of
+	// the environment isn't archived, and is taken from wherever the archive is run.
+	Env map[string]string `json:"env"`
+
+	// Filename and contents of the main script, and its working directory.
+	Filename string `json:"filename"`
+	Pwd      string `json:"pwd"`
+	Data     []byte `json:"-"`
+
+	// Imported scripts and open()ed files, by the names they were resolved to; local files
+	// have absolute paths, remote ones are eg. "github.com/user/repo/file.js".
+	Scripts map[string][]byte `json:"-"`
+	Files   map[string][]byte `json:"-"`
+}
+
+// Turns a resolved name into a path inside the archive, and back, keeping local and remote
+// files apart; otherwise "/github.com/..." and "github.com/..." would clash.
+func archivePath(dir, name string) string {
+	if strings.HasPrefix(name, "/") {
+		return path.Join(dir, "local", name)
+	}
+	return path.Join(dir, "remote", name)
+}
+
+func archiveName(p string) (dir, name string) {
+	parts := strings.SplitN(p, "/", 3)
+	if len(parts) != 3 {
+		return "", ""
+	}
+	switch parts[1] {
+	case "local":
+		return parts[0], "/" + parts[2]
+	case "remote":
+		return parts[0], parts[2]
+	default:
+		return "", ""
+	}
+}
+
+// ReadArchive reads an archive written by Archive.Write.
+func ReadArchive(r io.Reader) (*Archive, error) {
+	arc := &Archive{Scripts: make(map[string][]byte), Files: make(map[string][]byte)}
+	var hasMetadata, hasData bool
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+
+		switch hdr.Name {
+		case "metadata.json":
+			if err := json.Unmarshal(data, arc); err != nil {
+				return nil, errors.Wrap(err, "metadata.json")
+			}
+			hasMetadata = true
+			continue
+		case "data":
+			arc.Data = data
+			hasData = true
+			continue
+		}
+
+		switch dir, name := archiveName(hdr.Name); dir {
+		case "scripts":
+			arc.Scripts[name] = data
+		case "files":
+			arc.Files[name] = data
+		default:
+			return nil, errors.Errorf("unknown file in archive: %s", hdr.Name)
+		}
+	}
+
+	if !hasMetadata {
+		return nil, errors.New("archive has no metadata.json")
+	}
+	if !hasData {
+		return nil, errors.New("archive has no main script")
+	}
+	return arc, nil
+}
+
+// Write writes the archive as a tar file.
+func (arc *Archive) Write(out io.Writer) error {
+	tw := tar.NewWriter(out)
+	now := time.Now()
+
+	metadata, err := json.MarshalIndent(arc, "", "  ")
+	if err != nil {
+		return err
+	}
+	write := func(name string, data []byte) error {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(data)),
+			ModTime:  now,
+			Typeflag: tar.TypeReg,
+		}); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	if err := write("metadata.json", metadata); err != nil {
+		return err
+	}
+	if err := write("data", arc.Data); err != nil {
+		return err
+	}
+
+	// Keep the layout stable, so archiving the same script twice gives the same contents.
+	for _, dir := range []struct {
+		name  string
+		files map[string][]byte
+	}{
+		{"scripts", arc.Scripts},
+		{"files", arc.Files},
+	} {
+		names := make([]string, 0, len(dir.files))
+		for name := range dir.files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if err := write(archivePath(dir.name, name), dir.files[name]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tw.Close()
+}
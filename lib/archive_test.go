@@ -0,0 +1,158 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestArchiveReadWrite(t *testing.T) {
+	ths, err := stats.NewThresholds([]string{"avg<100"})
+	assert.NoError(t, err)
+
+	arc := &Archive{
+		Type: "js",
+		Options: Options{
+			VUs:    null.IntFrom(10),
+			Stages: []Stage{{Duration: 10 * time.Second, Target: null.IntFrom(5)}},
+			Scenarios: map[string]Scenario{
+				"sc": {VUs: null.IntFrom(1), StartTime: 5 * time.Second, Duration: time.Minute},
+			},
+			TLSVersion:      &TLSVersions{Min: tls.VersionTLS11, Max: tls.VersionTLS12},
+			TLSCipherSuites: TLSCipherSuites{TLSCipherSuiteNames["TLS_RSA_WITH_AES_128_GCM_SHA256"]},
+			Thresholds:      map[string]stats.Thresholds{"http_req_duration": ths},
+		},
+		Env:      map[string]string{"TARGET": "staging"},
+		Filename: "/path/to/script.js",
+		Pwd:      "/path/to",
+		Data:     []byte(`export default function() {}`),
+		Scripts: map[string][]byte{
+			"/path/to/lib.js":             []byte(`exports.fn = 1;`),
+			"github.com/user/repo/lib.js": []byte(`exports.fn = 2;`),
+		},
+		Files: map[string][]byte{
+			"/path/to/data.bin": {0x00, 0x01, 0x02},
+		},
+	}
+
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, arc.Write(buf))
+	assert.True(t, IsArchive(buf.Bytes()))
+
+	arc2, err := ReadArchive(bytes.NewReader(buf.Bytes()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, arc.Type, arc2.Type)
+	assert.Equal(t, arc.Env, arc2.Env)
+	assert.Equal(t, arc.Filename, arc2.Filename)
+	assert.Equal(t, arc.Pwd, arc2.Pwd)
+	assert.Equal(t, arc.Data, arc2.Data)
+	assert.Equal(t, arc.Scripts, arc2.Scripts)
+	assert.Equal(t, arc.Files, arc2.Files)
+
+	opts, opts2 := arc.Options, arc2.Options
+	assert.Equal(t, opts.VUs, opts2.VUs)
+	assert.Equal(t, opts.Stages, opts2.Stages)
+	assert.Equal(t, opts.Scenarios, opts2.Scenarios)
+	assert.Equal(t, opts.TLSVersion, opts2.TLSVersion)
+	assert.Equal(t, opts.TLSCipherSuites, opts2.TLSCipherSuites)
+	if assert.Len(t, opts2.Thresholds["http_req_duration"].Thresholds, 1) {
+		assert.Equal(t, "avg<100", opts2.Thresholds["http_req_duration"].Thresholds[0].Source)
+	}
+
+	t.Run("Stable", func(t *testing.T) {
+		arc.Options = Options{}
+		buf1, buf2 := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+		assert.NoError(t, arc.Write(buf1))
+		assert.NoError(t, arc.Write(buf2))
+
+		var names1, names2 []string
+		for _, pair := range []struct {
+			buf   *bytes.Buffer
+			names *[]string
+		}{{buf1, &names1}, {buf2, &names2}} {
+			tr := tar.NewReader(pair.buf)
+			for hdr, err := tr.Next(); err == nil; hdr, err = tr.Next() {
+				*pair.names = append(*pair.names, hdr.Name)
+			}
+		}
+		assert.Equal(t, []string{
+			"metadata.json",
+			"data",
+			"scripts/local/path/to/lib.js",
+			"scripts/remote/github.com/user/repo/lib.js",
+			"files/local/path/to/data.bin",
+		}, names1)
+		assert.Equal(t, names1, names2)
+	})
+}
+
+func TestReadArchiveInvalid(t *testing.T) {
+	makeTar := func(files map[string]string) []byte {
+		buf := bytes.NewBuffer(nil)
+		tw := tar.NewWriter(buf)
+		for name, data := range files {
+			assert.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data))}))
+			_, err := tw.Write([]byte(data))
+			assert.NoError(t, err)
+		}
+		assert.NoError(t, tw.Close())
+		return buf.Bytes()
+	}
+	metadata, err := json.Marshal(Archive{Type: "js", Filename: "/script.js"})
+	assert.NoError(t, err)
+
+	testdata := map[string]struct {
+		files map[string]string
+		err   string
+	}{
+		"no metadata": {map[string]string{"data": ""}, "archive has no metadata.json"},
+		"no data":     {map[string]string{"metadata.json": string(metadata)}, "archive has no main script"},
+		"bad metadata": {
+			map[string]string{"metadata.json": "{", "data": ""},
+			"metadata.json: unexpected end of JSON input",
+		},
+		"unknown file": {
+			map[string]string{"metadata.json": string(metadata), "data": "", "other/file": ""},
+			"unknown file in archive: other/file",
+		},
+	}
+	for name, data := range testdata {
+		t.Run(name, func(t *testing.T) {
+			_, err := ReadArchive(bytes.NewReader(makeTar(data.files)))
+			assert.EqualError(t, err, data.err)
+		})
+	}
+
+	t.Run("not a tar", func(t *testing.T) {
+		assert.False(t, IsArchive([]byte(`export default function() {}`)))
+	})
+}
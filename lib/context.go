@@ -0,0 +1,77 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"context"
+	"time"
+)
+
+type ctxKey int
+
+const (
+	ctxKeyScenario ctxKey = iota
+)
+
+// WithScenario attaches the scenario a VU is running as part of to its context.
+func WithScenario(ctx context.Context, sc *Scenario) context.Context {
+	return context.WithValue(ctx, ctxKeyScenario, sc)
+}
+
+// GetScenario returns the scenario a VU is running, or nil if it's not part of one.
+func GetScenario(ctx context.Context) *Scenario {
+	v := ctx.Value(ctxKeyScenario)
+	if v == nil {
+		return nil
+	}
+	return v.(*Scenario)
+}
+
+// Carries another context's values, but not its deadline or cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
+
+// Returns a context with ctx's values, which is only cancelled once grace has passed since ctx
+// was (or when the returned cancel function is called).
+func withGracePeriod(ctx context.Context, grace time.Duration) (context.Context, context.CancelFunc) {
+	gctx, cancel := context.WithCancel(detachedContext{ctx})
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-gctx.Done():
+			return
+		}
+		timer := time.NewTimer(grace)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			cancel()
+		case <-gctx.Done():
+		}
+	}()
+	return gctx, cancel
+}
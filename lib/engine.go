@@ -23,6 +23,7 @@ package lib
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -41,6 +42,8 @@ const (
 	CollectRate     = 10 * time.Millisecond
 	ThresholdsRate  = 2 * time.Second
 	ShutdownTimeout = 10 * time.Second
+	SetupTimeout    = 1 * time.Minute
+	TeardownTimeout = 1 * time.Minute
 
 	BackoffAmount = 50 * time.Millisecond
 	BackoffMax    = 10 * time.Second
@@ -50,11 +53,38 @@ type vuEntry struct {
 	VU     VU
 	Cancel context.CancelFunc
 
+	// If set, the VU waits for an iteration to be handed to it, rather than looping.
+	Arrivals chan struct{}
+
+	// Applied to every sample the VU emits.
+	Tags map[string]string
+
+	// How long a running iteration gets to finish once the VU is stopped.
+	GracefulStop time.Duration
+
 	Samples    []stats.Sample
 	Iterations int64
 	lock       sync.Mutex
 }
 
+// Appends the VU's buffered samples to dst and clears the buffer.
+func (vu *vuEntry) drainSamples(dst []stats.Sample) []stats.Sample {
+	vu.lock.Lock()
+	defer vu.lock.Unlock()
+
+	if len(vu.Samples) > 0 {
+		dst = append(dst, vu.Samples...)
+		vu.Samples = nil
+	}
+	return dst
+}
+
+type scenarioEntry struct {
+	Scenario *Scenario
+	VUs      []*vuEntry
+	Arrivals chan struct{}
+}
+
 // The Engine is the beating heart of K6.
 type Engine struct {
 	Runner    Runner
@@ -62,9 +92,17 @@ type Engine struct {
 	Collector Collector
 	Logger    *log.Logger
 
-	Stages      []Stage
-	Metrics     map[string]*stats.Metric
-	MetricsLock sync.RWMutex
+	// Reports VUs running outside of the engine, eg. on the agents of a distributed test;
+	// they're counted in the vus and vus_max metrics along with its own.
+	ExternalVUs func() (vus, vusMax int64)
+
+	Stages       []Stage
+	GracefulStop time.Duration
+	Metrics      map[string]*stats.Metric
+	MetricsLock  sync.RWMutex
+
+	// System tags that are stripped from samples; see the systemTags option.
+	droppedTags map[string]bool
 
 	// Assigned to metrics upon first received sample.
 	thresholds map[string]stats.Thresholds
@@ -85,9 +123,21 @@ type Engine struct {
 
 	nextVUID int64
 
+	// Arrival-rate tracking; arrivals is nil unless the rate option is set.
+	rate             int64
+	atStageStartRate int64
+	arrivals         chan struct{}
+	arrivalDebt      float64
+
+	// Scenarios, sorted by name; each has its own VUs, outside of the pool above.
+	scenarios      []*scenarioEntry
+	numScenarioVUs int64
+	maxScenarioVUs int64
+
 	// Atomic counters.
 	numIterations int64
 	numErrors     int64
+	numDropped    int64
 
 	thresholdsTainted bool
 
@@ -110,6 +160,37 @@ func NewEngine(r Runner, o Options) (*Engine, error) {
 	}
 	e.clearSubcontext()
 
+	gracefulStop, err := parseGracefulStop(o.GracefulStop)
+	if err != nil {
+		return nil, errors.Wrap(err, "options.gracefulStop")
+	}
+	e.GracefulStop = gracefulStop
+
+	droppedTags, err := droppedSystemTags(o.SystemTags)
+	if err != nil {
+		return nil, errors.Wrap(err, "options.systemTags")
+	}
+	e.droppedTags = droppedTags
+	if err := checkSubmetricTags(o.Thresholds, droppedTags, o.Tags); err != nil {
+		return nil, errors.Wrap(err, "options.thresholds")
+	}
+
+	if o.ExecutionSegment != nil && len(o.Scenarios) == 0 {
+		o = o.ExecutionSegment.scaleOptions(o)
+		e.Options = o
+	}
+
+	if len(o.Scenarios) > 0 {
+		// Scenarios bring their own schedules; the top-level one just covers all of them.
+		end, err := e.initScenarios(o.Scenarios, o.ExecutionSegment)
+		if err != nil {
+			return nil, err
+		}
+		e.Stages = []Stage{{Duration: end}}
+		e.applySharedOptions(o)
+		return e, nil
+	}
+
 	if o.Stages != nil {
 		e.Stages = o.Stages
 	} else if o.Duration.Valid {
@@ -121,6 +202,10 @@ func NewEngine(r Runner, o Options) (*Engine, error) {
 	} else {
 		e.Stages = []Stage{{Duration: 0}}
 	}
+	if o.Rate.Valid && o.Rate.Int64 > 0 {
+		e.rate = o.Rate.Int64
+		e.arrivals = make(chan struct{})
+	}
 	if o.VUsMax.Valid {
 		if err := e.SetVUsMax(o.VUsMax.Int64); err != nil {
 			return nil, err
@@ -131,6 +216,73 @@ func NewEngine(r Runner, o Options) (*Engine, error) {
 			return nil, err
 		}
 	}
+	e.applySharedOptions(o)
+	return e, nil
+}
+
+// Parses a gracefulStop option; an empty one means no grace period.
+func parseGracefulStop(s null.String) (time.Duration, error) {
+	if !s.Valid || s.String == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(s.String)
+}
+
+// Returns the system tags that aren't in the given list; nil keeps all of them.
+func droppedSystemTags(keep []string) (map[string]bool, error) {
+	if keep == nil {
+		return nil, nil
+	}
+	known := make(map[string]bool, len(SystemTagNames))
+	for _, name := range SystemTagNames {
+		known[name] = true
+	}
+	kept := make(map[string]bool, len(keep))
+	for _, name := range keep {
+		if !known[name] {
+			return nil, errors.Errorf("unknown system tag: %s", name)
+		}
+		kept[name] = true
+	}
+
+	dropped := make(map[string]bool, len(SystemTagNames))
+	for _, name := range SystemTagNames {
+		if !kept[name] {
+			dropped[name] = true
+		}
+	}
+	return dropped, nil
+}
+
+// Checks that no threshold filters on a tag that's dropped before samples reach it, which would
+// leave it matching nothing; tags set for the whole test are never dropped.
+func checkSubmetricTags(thresholds map[string]stats.Thresholds, dropped map[string]bool, tags map[string]string) error {
+	names := make([]string, 0, len(thresholds))
+	for name := range thresholds {
+		if strings.Contains(name, "{") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		_, sm := stats.NewSubmetric(name)
+		keys := make([]string, 0, len(sm.Tags))
+		for k := range sm.Tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if _, ok := tags[k]; dropped[k] && !ok {
+				return errors.Errorf("%s filters on the %s tag, which isn't in systemTags", name, k)
+			}
+		}
+	}
+	return nil
+}
+
+// Applies the options that don't depend on how the test is scheduled.
+func (e *Engine) applySharedOptions(o Options) {
 	if o.Paused.Valid {
 		e.SetPaused(o.Paused.Bool)
 	}
@@ -146,11 +298,87 @@ func NewEngine(r Runner, o Options) (*Engine, error) {
 			e.submetrics[parent] = append(e.submetrics[parent], sm)
 		}
 	}
+}
 
-	return e, nil
+// Validates scenarios and allocates their VUs, scaled down to the given segment, if any; ones
+// left without VUs or iterations are skipped. Returns the time the last one ends.
+func (e *Engine) initScenarios(scenarios map[string]Scenario, seg *ExecutionSegment) (time.Duration, error) {
+	names := make([]string, 0, len(scenarios))
+	for name := range scenarios {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var end time.Duration
+	for _, name := range names {
+		sc := scenarios[name]
+		sc.Name = name
+		if sc.VUs.Int64 <= 0 {
+			return 0, errors.Errorf("scenario %s: vus must be positive", name)
+		}
+		if sc.Duration <= 0 {
+			return 0, errors.Errorf("scenario %s: duration must be positive", name)
+		}
+		if sc.StartTime < 0 {
+			return 0, errors.Errorf("scenario %s: startTime can't be negative", name)
+		}
+		if scEnd := sc.StartTime + sc.Duration; scEnd > end {
+			end = scEnd
+		}
+
+		if seg != nil {
+			sc.VUs = null.IntFrom(seg.Scale(sc.VUs.Int64))
+			if sc.Rate.Int64 > 0 {
+				sc.Rate = null.IntFrom(seg.Scale(sc.Rate.Int64))
+				if sc.Rate.Int64 == 0 {
+					continue
+				}
+			}
+			if sc.VUs.Int64 == 0 {
+				continue
+			}
+		}
+
+		gracefulStop := e.GracefulStop
+		if sc.GracefulStop.Valid {
+			d, err := parseGracefulStop(sc.GracefulStop)
+			if err != nil {
+				return 0, errors.Wrapf(err, "scenario %s: gracefulStop", name)
+			}
+			gracefulStop = d
+		}
+
+		tags := map[string]string{"scenario": name}
+		for k, v := range sc.Tags {
+			tags[k] = v
+		}
+
+		entry := &scenarioEntry{Scenario: &sc}
+		if sc.Rate.Int64 > 0 {
+			entry.Arrivals = make(chan struct{})
+		}
+		for i := int64(0); i < sc.VUs.Int64; i++ {
+			vu := &vuEntry{Arrivals: entry.Arrivals, Tags: tags, GracefulStop: gracefulStop}
+			if e.Runner != nil {
+				v, err := e.Runner.NewVU()
+				if err != nil {
+					return 0, errors.Wrapf(err, "scenario %s", name)
+				}
+				vu.VU = v
+			}
+			entry.VUs = append(entry.VUs, vu)
+		}
+		e.scenarios = append(e.scenarios, entry)
+		e.maxScenarioVUs += sc.VUs.Int64
+	}
+	return end, nil
 }
 
 func (e *Engine) Run(ctx context.Context) error {
+	// Crossing a threshold that aborts the test cancels this.
+	ctx, abort := context.WithCancel(ctx)
+	defer abort()
+
 	collectorctx, collectorcancel := context.WithCancel(context.Background())
 	collectorch := make(chan interface{})
 	if e.Collector != nil {
@@ -181,13 +409,13 @@ func (e *Engine) Run(ctx context.Context) error {
 		// Run thresholds.
 		e.subwg.Add(1)
 		go func(ctx context.Context) {
-			e.runThresholds(ctx)
+			e.runThresholds(ctx, abort)
 			e.subwg.Done()
 		}(e.subctx)
 	}
 	e.lock.Unlock()
 
-	close(e.vuStop)
+	setupDone := false
 	defer func() {
 		e.lock.Lock()
 		e.vuStop = make(chan interface{})
@@ -198,6 +426,13 @@ func (e *Engine) Run(ctx context.Context) error {
 		e.clearSubcontext()
 		e.subwg.Wait()
 
+		// Tear down, once everything else has stopped; only if we set up to begin with.
+		if setupDone {
+			if err := e.runTeardown(); err != nil {
+				e.Logger.WithError(err).Error("Teardown failed")
+			}
+		}
+
 		// Emit final metrics.
 		e.emitMetrics()
 
@@ -218,11 +453,32 @@ func (e *Engine) Run(ctx context.Context) error {
 	e.atStage = 0
 	e.atStageSince = 0
 	e.atStageStartVUs = e.vus
+	e.atStageStartRate = e.rate
+	e.arrivalDebt = 0
 	e.nextVUID = 0
 	e.numErrors = 0
 	e.lock.Unlock()
 
 	atomic.StoreInt64(&e.numIterations, 0)
+	atomic.StoreInt64(&e.numDropped, 0)
+
+	// Run setup before letting any VUs loose; a failure here aborts the test.
+	if err := e.runSetup(ctx); err != nil {
+		return err
+	}
+	setupDone = true
+	close(e.vuStop)
+
+	// Run scenarios, if any; they start counting from here.
+	e.lock.Lock()
+	for _, sc := range e.scenarios {
+		e.subwg.Add(1)
+		go func(ctx context.Context, sc *scenarioEntry) {
+			e.runScenario(ctx, sc)
+			e.subwg.Done()
+		}(e.subctx, sc)
+	}
+	e.lock.Unlock()
 
 	var lastTick time.Time
 	ticker := time.NewTicker(TickRate)
@@ -244,7 +500,7 @@ func (e *Engine) Run(ctx context.Context) error {
 
 		// If we have an iteration cap, exit once we hit it.
 		numIterations := atomic.LoadInt64(&e.numIterations)
-		if maxIterations > 0 && numIterations >= atomic.LoadInt64(&e.vusMax)*maxIterations {
+		if maxIterations > 0 && len(e.scenarios) == 0 && numIterations >= atomic.LoadInt64(&e.vusMax)*maxIterations {
 			e.Logger.WithFields(log.Fields{
 				"total": e.numIterations,
 				"cap":   e.vusMax * maxIterations,
@@ -269,6 +525,9 @@ func (e *Engine) Run(ctx context.Context) error {
 			e.Logger.Debug("run: processStages() returned false; exiting...")
 			return nil
 		}
+		if e.arrivals != nil {
+			e.processArrivals(dT)
+		}
 
 		select {
 		case <-ticker.C:
@@ -279,6 +538,39 @@ func (e *Engine) Run(ctx context.Context) error {
 	}
 }
 
+func (e *Engine) runSetup(ctx context.Context) error {
+	if e.Runner == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, SetupTimeout)
+	defer cancel()
+
+	samples, err := e.Runner.Setup(ctx)
+	e.processSamples(samples...)
+	if err != nil {
+		return errors.Wrap(err, "setup")
+	}
+	return nil
+}
+
+func (e *Engine) runTeardown() error {
+	if e.Runner == nil {
+		return nil
+	}
+
+	// The test context may well have expired by now; teardown gets its own.
+	ctx, cancel := context.WithTimeout(context.Background(), TeardownTimeout)
+	defer cancel()
+
+	samples, err := e.Runner.Teardown(ctx)
+	e.processSamples(samples...)
+	if err != nil {
+		return errors.Wrap(err, "teardown")
+	}
+	return nil
+}
+
 func (e *Engine) IsRunning() bool {
 	e.lock.RLock()
 	vuStop := e.vuStop
@@ -385,7 +677,7 @@ func (e *Engine) SetVUsMax(v int64) error {
 
 	// Scale up
 	for len(e.vuEntries) < int(v) {
-		var entry vuEntry
+		entry := vuEntry{Arrivals: e.arrivals, GracefulStop: e.GracefulStop}
 		if e.Runner != nil {
 			vu, err := e.Runner.NewVU()
 			if err != nil {
@@ -412,6 +704,17 @@ func (e *Engine) GetVUsMax() int64 {
 	return e.vusMax
 }
 
+func (e *Engine) GetRate() int64 {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	return e.rate
+}
+
+func (e *Engine) GetDroppedIterations() int64 {
+	return atomic.LoadInt64(&e.numDropped)
+}
+
 func (e *Engine) IsTainted() bool {
 	e.MetricsLock.RLock()
 	defer e.MetricsLock.RUnlock()
@@ -469,6 +772,7 @@ func (e *Engine) processStages(dT time.Duration) (bool, error) {
 		stageIdx := -1
 		stageStart := 0 * time.Second
 		stageStartVUs := e.vus
+		stageStartRate := e.rate
 		for i, s := range e.Stages {
 			if stageStart+s.Duration > e.atTime || s.Duration == 0 {
 				e.Logger.WithField("idx", i).Debug("processStages: proceeding to next stage...")
@@ -478,7 +782,11 @@ func (e *Engine) processStages(dT time.Duration) (bool, error) {
 			}
 			stageStart += s.Duration
 			if s.Target.Valid {
-				stageStartVUs = s.Target.Int64
+				if e.arrivals != nil {
+					stageStartRate = s.Target.Int64
+				} else {
+					stageStartVUs = s.Target.Int64
+				}
 			}
 		}
 		if stageIdx == -1 {
@@ -489,19 +797,32 @@ func (e *Engine) processStages(dT time.Duration) (bool, error) {
 		e.atStage = stageIdx
 		e.atStageSince = stageStart
 
-		e.Logger.WithField("vus", stageStartVUs).Debug("processStages: normalizing VU count...")
-		if err := e.setVUsNoLock(stageStartVUs); err != nil {
-			return false, errors.Wrapf(err, "stage #%d (normalization)", e.atStage)
+		if e.arrivals != nil {
+			e.Logger.WithField("rate", stageStartRate).Debug("processStages: normalizing rate...")
+			e.rate = stageStartRate
+			e.atStageStartRate = stageStartRate
+		} else {
+			e.Logger.WithField("vus", stageStartVUs).Debug("processStages: normalizing VU count...")
+			if err := e.setVUsNoLock(stageStartVUs); err != nil {
+				return false, errors.Wrapf(err, "stage #%d (normalization)", e.atStage)
+			}
+			e.atStageStartVUs = stageStartVUs
 		}
-		e.atStageStartVUs = stageStartVUs
 	}
 	if stage.Target.Valid {
-		from := e.atStageStartVUs
-		to := stage.Target.Int64
 		t := 1.0
 		if stage.Duration > 0 {
 			t = Clampf(float64(e.atTime-e.atStageSince)/float64(stage.Duration), 0.0, 1.0)
 		}
+
+		// In arrival-rate mode, stages ramp the rate; VUs are left alone.
+		if e.arrivals != nil {
+			e.rate = Lerp(e.atStageStartRate, stage.Target.Int64, t)
+			return true, nil
+		}
+
+		from := e.atStageStartVUs
+		to := stage.Target.Int64
 		vus := Lerp(from, to, t)
 		if e.vus != vus {
 			e.Logger.WithFields(log.Fields{"from": e.vus, "to": vus}).Debug("processStages: interpolating...")
@@ -514,6 +835,103 @@ func (e *Engine) processStages(dT time.Duration) (bool, error) {
 	return true, nil
 }
 
+// Hands out the iterations that became due over dT to idle VUs. Iterations that find no idle
+// VU are dropped rather than queued, otherwise a slow target would just make the queue grow.
+func (e *Engine) processArrivals(dT time.Duration) {
+	e.lock.Lock()
+	e.arrivalDebt += float64(e.rate) * dT.Seconds()
+	due := int64(e.arrivalDebt)
+	e.arrivalDebt -= float64(due)
+	e.lock.Unlock()
+
+	e.dispatchArrivals(e.arrivals, due, nil)
+}
+
+func (e *Engine) dispatchArrivals(arrivals chan struct{}, due int64, tags map[string]string) {
+	var dropped int64
+	for i := int64(0); i < due; i++ {
+		select {
+		case arrivals <- struct{}{}:
+		default:
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		atomic.AddInt64(&e.numDropped, dropped)
+		e.processSamples(stats.Sample{
+			Time:   time.Now(),
+			Metric: metrics.DroppedIterations,
+			Tags:   tags,
+			Value:  float64(dropped),
+		})
+	}
+}
+
+// Runs a scenario's VUs from its start time until the end of its duration.
+func (e *Engine) runScenario(ctx context.Context, sc *scenarioEntry) {
+	select {
+	case <-time.After(sc.Scenario.StartTime):
+	case <-ctx.Done():
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(WithScenario(ctx, sc.Scenario), sc.Scenario.Duration)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, vu := range sc.VUs {
+		// nil runners are used for testing.
+		if vu.VU != nil {
+			if err := vu.VU.Reconfigure(atomic.AddInt64(&e.nextVUID, 1)); err != nil {
+				e.Logger.WithError(err).WithField("scenario", sc.Scenario.Name).Error("Couldn't configure VU")
+				continue
+			}
+		}
+
+		wg.Add(1)
+		go func(vu *vuEntry) {
+			atomic.AddInt64(&e.numScenarioVUs, 1)
+			e.runVU(ctx, vu)
+			atomic.AddInt64(&e.numScenarioVUs, -1)
+			wg.Done()
+		}(vu)
+	}
+
+	if sc.Arrivals != nil {
+		e.runScenarioArrivals(ctx, sc)
+	}
+	wg.Wait()
+}
+
+// Schedules iterations for an arrival-rate scenario, along the lines of processArrivals().
+func (e *Engine) runScenarioArrivals(ctx context.Context, sc *scenarioEntry) {
+	rate := float64(sc.Scenario.Rate.Int64)
+	tags := sc.VUs[0].Tags
+
+	ticker := time.NewTicker(TickRate)
+	defer ticker.Stop()
+
+	lastTick := time.Now()
+	debt := 0.0
+	for {
+		select {
+		case now := <-ticker.C:
+			dT := now.Sub(lastTick)
+			lastTick = now
+			if e.IsPaused() {
+				continue
+			}
+
+			debt += rate * dT.Seconds()
+			due := int64(debt)
+			debt -= float64(due)
+			e.dispatchArrivals(sc.Arrivals, due, tags)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
 func (e *Engine) runVU(ctx context.Context, vu *vuEntry) {
 	maxIterations := e.Options.Iterations.Int64
 
@@ -524,8 +942,11 @@ func (e *Engine) runVU(ctx context.Context, vu *vuEntry) {
 	}
 
 	// Sleep until the engine starts running.
+	e.lock.RLock()
+	vuStop := e.vuStop
+	e.lock.RUnlock()
 	select {
-	case <-e.vuStop:
+	case <-vuStop:
 	case <-ctx.Done():
 		return
 	}
@@ -552,8 +973,18 @@ func (e *Engine) runVU(ctx context.Context, vu *vuEntry) {
 		default:
 		}
 
+		// In arrival-rate mode, wait for the engine to schedule an iteration.
+		if vu.Arrivals != nil {
+			select {
+			case <-vu.Arrivals:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		// The schedule paces VUs in arrival-rate mode, backing off would just drop iterations.
 		succ := e.runVUOnce(ctx, vu)
-		if !succ {
+		if !succ && vu.Arrivals == nil {
 			backoff += BackoffAmount * time.Duration(backoffCounter)
 			if backoff > BackoffMax {
 				backoff = BackoffMax
@@ -570,12 +1001,19 @@ func (e *Engine) runVU(ctx context.Context, vu *vuEntry) {
 }
 
 func (e *Engine) runVUOnce(ctx context.Context, vu *vuEntry) bool {
-	samples, err := vu.VU.RunOnce(ctx)
+	// With a graceful stop, an iteration may outlive its VU, for up to that long.
+	itctx := ctx
+	if vu.GracefulStop > 0 {
+		var cancel context.CancelFunc
+		itctx, cancel = withGracePeriod(ctx, vu.GracefulStop)
+		defer cancel()
+	}
+	samples, err := vu.VU.RunOnce(itctx)
 
-	// Expired VUs usually have request cancellation errors, and thus skewed metrics and
-	// unhelpful "request cancelled" errors. Don't process those.
+	// Interrupted iterations usually have request cancellation errors, and thus skewed metrics
+	// and unhelpful "request cancelled" errors. Don't process those.
 	select {
-	case <-ctx.Done():
+	case <-itctx.Done():
 		return true
 	default:
 	}
@@ -607,6 +1045,19 @@ func (e *Engine) runVUOnce(ctx context.Context, vu *vuEntry) bool {
 		atomic.AddInt64(&e.numErrors, 1)
 	}
 
+	if len(vu.Tags) > 0 {
+		for i, sample := range samples {
+			tags := make(map[string]string, len(sample.Tags)+len(vu.Tags))
+			for k, v := range sample.Tags {
+				tags[k] = v
+			}
+			for k, v := range vu.Tags {
+				tags[k] = v
+			}
+			samples[i].Tags = tags
+		}
+	}
+
 	vu.lock.Lock()
 	vu.Samples = append(vu.Samples, samples...)
 	vu.lock.Unlock()
@@ -630,34 +1081,49 @@ func (e *Engine) emitMetrics() {
 	e.lock.RLock()
 	defer e.lock.RUnlock()
 
+	vus := e.vus + atomic.LoadInt64(&e.numScenarioVUs)
+	vusMax := e.vusMax + e.maxScenarioVUs
+	if e.ExternalVUs != nil {
+		extVUs, extVUsMax := e.ExternalVUs()
+		vus += extVUs
+		vusMax += extVUsMax
+	}
+
 	t := time.Now()
 	e.processSamples(
 		stats.Sample{
 			Time:   t,
 			Metric: metrics.VUs,
-			Value:  float64(e.vus),
+			Value:  float64(vus),
 		},
 		stats.Sample{
 			Time:   t,
 			Metric: metrics.VUsMax,
-			Value:  float64(e.vusMax),
+			Value:  float64(vusMax),
 		},
 	)
 }
 
-func (e *Engine) runThresholds(ctx context.Context) {
+func (e *Engine) runThresholds(ctx context.Context, abort func()) {
 	ticker := time.NewTicker(ThresholdsRate)
 	for {
 		select {
 		case <-ticker.C:
-			e.processThresholds()
+			if e.processThresholds() {
+				e.Logger.Warn("Thresholds have been crossed; aborting the test")
+				abort()
+				return
+			}
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
-func (e *Engine) processThresholds() {
+// Evaluates all thresholds; returns whether any failing ones should abort the test.
+func (e *Engine) processThresholds() (shouldAbort bool) {
+	atTime := e.AtTime()
+
 	e.MetricsLock.Lock()
 	defer e.MetricsLock.Unlock()
 
@@ -678,8 +1144,12 @@ func (e *Engine) processThresholds() {
 			e.Logger.WithField("m", m.Name).Debug("Thresholds failed")
 			m.Tainted = null.BoolFrom(true)
 			e.thresholdsTainted = true
+			if m.Thresholds.ShouldAbort(atTime) {
+				shouldAbort = true
+			}
 		}
 	}
+	return shouldAbort
 }
 
 func (e *Engine) runCollection(ctx context.Context) {
@@ -700,20 +1170,27 @@ func (e *Engine) collect() []stats.Sample {
 
 	samples := []stats.Sample{}
 	for _, vu := range e.vuEntries {
-		vu.lock.Lock()
-		if len(vu.Samples) > 0 {
-			samples = append(samples, vu.Samples...)
-			vu.Samples = nil
+		samples = vu.drainSamples(samples)
+	}
+	for _, sc := range e.scenarios {
+		for _, vu := range sc.VUs {
+			samples = vu.drainSamples(samples)
 		}
-		vu.lock.Unlock()
 	}
 	return samples
 }
 
+// ProcessSamples feeds samples from outside the engine, eg. ones streamed in from the agents of a
+// distributed test, into its metrics, thresholds and collector, as if its own VUs emitted them.
+func (e *Engine) ProcessSamples(samples ...stats.Sample) {
+	e.processSamples(samples...)
+}
+
 func (e *Engine) processSamples(samples ...stats.Sample) {
 	if len(samples) == 0 {
 		return
 	}
+	e.applyTags(samples)
 
 	e.MetricsLock.Lock()
 	defer e.MetricsLock.Unlock()
@@ -728,7 +1205,8 @@ func (e *Engine) processSamples(samples ...stats.Sample) {
 		}
 		m.Sink.Add(sample)
 
-		for _, sm := range m.Submetrics {
+		for i := range m.Submetrics {
+			sm := &m.Submetrics[i]
 			passing := true
 			for k, v := range sm.Tags {
 				if sample.Tags[k] != v {
@@ -753,3 +1231,23 @@ func (e *Engine) processSamples(samples ...stats.Sample) {
 		e.Collector.Collect(samples)
 	}
 }
+
+// Strips unwanted system tags from samples and applies the test-wide ones, so collectors and
+// thresholds alike see the same tags. Samples often share tag maps, so they're copied.
+func (e *Engine) applyTags(samples []stats.Sample) {
+	if len(e.Options.Tags) == 0 && len(e.droppedTags) == 0 {
+		return
+	}
+	for i, sample := range samples {
+		tags := make(map[string]string, len(e.Options.Tags)+len(sample.Tags))
+		for k, v := range e.Options.Tags {
+			tags[k] = v
+		}
+		for k, v := range sample.Tags {
+			if !e.droppedTags[k] {
+				tags[k] = v
+			}
+		}
+		samples[i].Tags = tags
+	}
+}
@@ -22,12 +22,14 @@ package lib
 
 import (
 	"context"
+	"encoding/json"
 	"runtime"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	logtest "github.com/Sirupsen/logrus/hooks/test"
+	"github.com/loadimpact/k6/lib/metrics"
 	"github.com/loadimpact/k6/stats"
 	"github.com/loadimpact/k6/stats/dummy"
 	"github.com/pkg/errors"
@@ -115,6 +117,36 @@ func TestNewEngineOptions(t *testing.T) {
 			assert.Equal(t, e.Stages[0], Stage{Duration: 10 * time.Second, Target: null.IntFrom(10)})
 		}
 	})
+	t.Run("ExecutionSegment", func(t *testing.T) {
+		seg, err := ParseExecutionSegment("1/2:1")
+		assert.NoError(t, err)
+		e, err, _ := newTestEngine(nil, Options{
+			VUs:              null.IntFrom(3),
+			VUsMax:           null.IntFrom(5),
+			ExecutionSegment: seg,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), e.GetVUs())
+		assert.Equal(t, int64(3), e.GetVUsMax())
+	})
+	t.Run("GracefulStop", func(t *testing.T) {
+		e, err, _ := newTestEngine(nil, Options{
+			VUsMax:       null.IntFrom(1),
+			GracefulStop: null.StringFrom("5s"),
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 5*time.Second, e.GracefulStop)
+		if assert.Len(t, e.vuEntries, 1) {
+			assert.Equal(t, 5*time.Second, e.vuEntries[0].GracefulStop)
+		}
+
+		t.Run("invalid", func(t *testing.T) {
+			_, err, _ := newTestEngine(nil, Options{GracefulStop: null.StringFrom("forever")})
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), "options.gracefulStop: time: invalid duration")
+			}
+		})
+	})
 	t.Run("VUsMax", func(t *testing.T) {
 		t.Run("not set", func(t *testing.T) {
 			e, err, _ := newTestEngine(nil, Options{})
@@ -185,6 +217,25 @@ func TestNewEngineOptions(t *testing.T) {
 			assert.True(t, e.IsPaused())
 		})
 	})
+	t.Run("Rate", func(t *testing.T) {
+		t.Run("not set", func(t *testing.T) {
+			e, err, _ := newTestEngine(nil, Options{})
+			assert.NoError(t, err)
+			assert.Nil(t, e.arrivals)
+			assert.Equal(t, int64(0), e.GetRate())
+		})
+		t.Run("zero", func(t *testing.T) {
+			e, err, _ := newTestEngine(nil, Options{Rate: null.IntFrom(0)})
+			assert.NoError(t, err)
+			assert.Nil(t, e.arrivals)
+		})
+		t.Run("set", func(t *testing.T) {
+			e, err, _ := newTestEngine(nil, Options{Rate: null.IntFrom(100)})
+			assert.NoError(t, err)
+			assert.NotNil(t, e.arrivals)
+			assert.Equal(t, int64(100), e.GetRate())
+		})
+	})
 	t.Run("thresholds", func(t *testing.T) {
 		e, err, _ := newTestEngine(nil, Options{
 			Thresholds: map[string]stats.Thresholds{
@@ -207,6 +258,21 @@ func TestNewEngineOptions(t *testing.T) {
 	})
 }
 
+// A RunnerFunc with setup and teardown hooks.
+type setupTeardownRunner struct {
+	RunnerFunc
+	SetupFn    func(ctx context.Context) ([]stats.Sample, error)
+	TeardownFn func(ctx context.Context) ([]stats.Sample, error)
+}
+
+func (r setupTeardownRunner) Setup(ctx context.Context) ([]stats.Sample, error) {
+	return r.SetupFn(ctx)
+}
+
+func (r setupTeardownRunner) Teardown(ctx context.Context) ([]stats.Sample, error) {
+	return r.TeardownFn(ctx)
+}
+
 func TestEngineRun(t *testing.T) {
 	t.Run("exits with context", func(t *testing.T) {
 		startTime := time.Now()
@@ -308,6 +374,63 @@ func TestEngineRun(t *testing.T) {
 			})
 		}
 	})
+	t.Run("setup and teardown", func(t *testing.T) {
+		setupMetric := stats.New("setup_metric", stats.Counter)
+		teardownMetric := stats.New("teardown_metric", stats.Counter)
+
+		var numSetup, numTeardown, numIterations int64
+		r := setupTeardownRunner{
+			RunnerFunc: func(ctx context.Context) ([]stats.Sample, error) {
+				assert.Equal(t, int64(1), atomic.LoadInt64(&numSetup), "iteration before setup")
+				assert.Equal(t, int64(0), atomic.LoadInt64(&numTeardown), "iteration after teardown")
+				atomic.AddInt64(&numIterations, 1)
+				return nil, nil
+			},
+			SetupFn: func(ctx context.Context) ([]stats.Sample, error) {
+				atomic.AddInt64(&numSetup, 1)
+				return []stats.Sample{{Metric: setupMetric, Value: 1.0}}, nil
+			},
+			TeardownFn: func(ctx context.Context) ([]stats.Sample, error) {
+				atomic.AddInt64(&numTeardown, 1)
+				return []stats.Sample{{Metric: teardownMetric, Value: 1.0}}, nil
+			},
+		}
+		e, err, _ := newTestEngine(r, Options{VUsMax: null.IntFrom(2), VUs: null.IntFrom(2)})
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		assert.NoError(t, e.Run(ctx))
+		cancel()
+
+		assert.Equal(t, int64(1), atomic.LoadInt64(&numSetup))
+		assert.Equal(t, int64(1), atomic.LoadInt64(&numTeardown))
+		assert.True(t, atomic.LoadInt64(&numIterations) > 0, "no iterations performed")
+		assert.Contains(t, e.Metrics, "setup_metric")
+		assert.Contains(t, e.Metrics, "teardown_metric")
+	})
+	t.Run("setup fails", func(t *testing.T) {
+		var numTeardown int64
+		r := setupTeardownRunner{
+			RunnerFunc: func(ctx context.Context) ([]stats.Sample, error) {
+				assert.Fail(t, "iteration ran after failed setup")
+				return nil, nil
+			},
+			SetupFn: func(ctx context.Context) ([]stats.Sample, error) {
+				return nil, errors.New("oops")
+			},
+			TeardownFn: func(ctx context.Context) ([]stats.Sample, error) {
+				atomic.AddInt64(&numTeardown, 1)
+				return nil, nil
+			},
+		}
+		e, err, _ := newTestEngine(r, Options{VUsMax: null.IntFrom(1), VUs: null.IntFrom(1)})
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		assert.EqualError(t, e.Run(ctx), "setup: oops")
+		cancel()
+		assert.Equal(t, int64(0), atomic.LoadInt64(&numTeardown))
+	})
 }
 
 func TestEngineIsRunning(t *testing.T) {
@@ -658,6 +781,45 @@ func TestEngine_runVUOnceKeepsCounters(t *testing.T) {
 			})
 		})
 	})
+	t.Run("graceful", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		t.Run("finished", func(t *testing.T) {
+			e.numIterations = 0
+			e.runVUOnce(ctx, &vuEntry{
+				GracefulStop: 1 * time.Second,
+				VU: RunnerFunc(func(ctx context.Context) ([]stats.Sample, error) {
+					time.Sleep(10 * time.Millisecond)
+					return nil, ctx.Err()
+				}).VU(),
+			})
+			assert.Equal(t, int64(1), e.numIterations)
+		})
+		t.Run("interrupted", func(t *testing.T) {
+			e.numIterations = 0
+			startTime := time.Now()
+			e.runVUOnce(ctx, &vuEntry{
+				GracefulStop: 50 * time.Millisecond,
+				VU: RunnerFunc(func(ctx context.Context) ([]stats.Sample, error) {
+					<-ctx.Done()
+					return nil, ctx.Err()
+				}).VU(),
+			})
+			assert.Equal(t, int64(0), e.numIterations)
+			assert.WithinDuration(t, startTime.Add(50*time.Millisecond), time.Now(), 40*time.Millisecond)
+		})
+		t.Run("values", func(t *testing.T) {
+			sc := &Scenario{Name: "sc"}
+			e.runVUOnce(WithScenario(ctx, sc), &vuEntry{
+				GracefulStop: 1 * time.Second,
+				VU: RunnerFunc(func(ctx context.Context) ([]stats.Sample, error) {
+					assert.Equal(t, sc, GetScenario(ctx))
+					return nil, nil
+				}).VU(),
+			})
+		})
+	})
 }
 
 func TestEngine_processStages(t *testing.T) {
@@ -845,6 +1007,284 @@ func TestEngine_processStages(t *testing.T) {
 	}
 }
 
+func TestEngine_processStagesRate(t *testing.T) {
+	e, err, _ := newTestEngine(nil, Options{
+		VUs:    null.IntFrom(5),
+		VUsMax: null.IntFrom(10),
+		Rate:   null.IntFrom(10),
+	})
+	assert.NoError(t, err)
+	e.Stages = []Stage{
+		{Duration: 10 * time.Second, Target: null.IntFrom(110)},
+		{Duration: 10 * time.Second},
+	}
+	e.atStageStartRate = e.rate
+
+	checkpoints := []struct {
+		D    time.Duration
+		Rate int64
+	}{
+		{0 * time.Second, 10},
+		{5 * time.Second, 60},
+		{5 * time.Second, 110},
+		{5 * time.Second, 110},
+	}
+	for _, ckp := range checkpoints {
+		t.Run((e.AtTime() + ckp.D).String(), func(t *testing.T) {
+			cont, err := e.processStages(ckp.D)
+			assert.NoError(t, err)
+			assert.True(t, cont, "test stopped")
+			assert.Equal(t, ckp.Rate, e.GetRate())
+			assert.Equal(t, int64(5), e.GetVUs(), "rate stages changed the VU count")
+		})
+	}
+}
+
+func TestEngine_processArrivals(t *testing.T) {
+	t.Run("drops without idle vus", func(t *testing.T) {
+		e, err, _ := newTestEngine(nil, Options{Rate: null.IntFrom(10)})
+		assert.NoError(t, err)
+
+		e.processArrivals(1 * time.Second)
+		assert.Equal(t, int64(10), e.GetDroppedIterations())
+		assert.Contains(t, e.Metrics, "dropped_iterations")
+	})
+	t.Run("carries fractions over", func(t *testing.T) {
+		e, err, _ := newTestEngine(nil, Options{Rate: null.IntFrom(10)})
+		assert.NoError(t, err)
+
+		e.processArrivals(150 * time.Millisecond)
+		assert.Equal(t, int64(1), e.GetDroppedIterations())
+		e.processArrivals(50 * time.Millisecond)
+		assert.Equal(t, int64(2), e.GetDroppedIterations())
+	})
+	t.Run("hands out iterations", func(t *testing.T) {
+		e, err, _ := newTestEngine(nil, Options{Rate: null.IntFrom(10)})
+		assert.NoError(t, err)
+
+		received := make(chan struct{})
+		go func() {
+			<-e.arrivals
+			close(received)
+		}()
+		for {
+			e.processArrivals(100 * time.Millisecond)
+			select {
+			case <-received:
+				return
+			case <-time.After(TickRate):
+			}
+		}
+	})
+}
+
+func TestEngineRunRate(t *testing.T) {
+	t.Run("constant", func(t *testing.T) {
+		e, err, _ := newTestEngine(RunnerFunc(func(ctx context.Context) ([]stats.Sample, error) {
+			return nil, nil
+		}), Options{VUs: null.IntFrom(2), VUsMax: null.IntFrom(2), Rate: null.IntFrom(100)})
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		assert.NoError(t, e.Run(ctx))
+
+		// Roughly 50 iterations, independent of how quickly each of them completes.
+		iterations := atomic.LoadInt64(&e.numIterations)
+		assert.True(t, iterations > 25 && iterations <= 51, "wrong number of iterations: %d", iterations)
+	})
+	t.Run("dropped", func(t *testing.T) {
+		e, err, _ := newTestEngine(RunnerFunc(func(ctx context.Context) ([]stats.Sample, error) {
+			select {
+			case <-time.After(100 * time.Millisecond):
+			case <-ctx.Done():
+			}
+			return nil, nil
+		}), Options{VUs: null.IntFrom(1), VUsMax: null.IntFrom(1), Rate: null.IntFrom(100)})
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		assert.NoError(t, e.Run(ctx))
+
+		assert.True(t, e.GetDroppedIterations() > 0, "no iterations dropped")
+		assert.True(t, atomic.LoadInt64(&e.numIterations) <= 5, "more iterations than the VU could run")
+	})
+}
+
+func TestNewEngineScenarios(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		e, err, _ := newTestEngine(nil, Options{
+			VUs:    null.IntFrom(10),
+			VUsMax: null.IntFrom(10),
+			Scenarios: map[string]Scenario{
+				"browse": {VUs: null.IntFrom(2), Duration: 10 * time.Second},
+				"api":    {VUs: null.IntFrom(3), Rate: null.IntFrom(100), StartTime: 5 * time.Second, Duration: 10 * time.Second},
+			},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []Stage{{Duration: 15 * time.Second}}, e.Stages)
+		assert.Equal(t, int64(0), e.GetVUsMax(), "top-level vus shouldn't be allocated")
+		if assert.Len(t, e.scenarios, 2) {
+			assert.Equal(t, "api", e.scenarios[0].Scenario.Name)
+			assert.Len(t, e.scenarios[0].VUs, 3)
+			assert.NotNil(t, e.scenarios[0].Arrivals)
+			assert.Equal(t, "browse", e.scenarios[1].Scenario.Name)
+			assert.Len(t, e.scenarios[1].VUs, 2)
+			assert.Nil(t, e.scenarios[1].Arrivals)
+		}
+	})
+	t.Run("ExecutionSegment", func(t *testing.T) {
+		seg, err := ParseExecutionSegment("0:1/2")
+		assert.NoError(t, err)
+		e, err, _ := newTestEngine(nil, Options{
+			ExecutionSegment: seg,
+			Scenarios: map[string]Scenario{
+				"browse": {VUs: null.IntFrom(5), Duration: 10 * time.Second},
+				"api":    {VUs: null.IntFrom(4), Rate: null.IntFrom(1), Duration: 10 * time.Second},
+				"admin":  {VUs: null.IntFrom(1), StartTime: 10 * time.Second, Duration: 10 * time.Second},
+			},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []Stage{{Duration: 20 * time.Second}}, e.Stages, "skipped scenarios still count towards the end")
+		if assert.Len(t, e.scenarios, 1) {
+			assert.Equal(t, "browse", e.scenarios[0].Scenario.Name)
+			assert.Len(t, e.scenarios[0].VUs, 2)
+		}
+	})
+	t.Run("GracefulStop", func(t *testing.T) {
+		e, err, _ := newTestEngine(nil, Options{
+			GracefulStop: null.StringFrom("5s"),
+			Scenarios: map[string]Scenario{
+				"default":  {VUs: null.IntFrom(1), Duration: 10 * time.Second},
+				"override": {VUs: null.IntFrom(1), Duration: 10 * time.Second, GracefulStop: null.StringFrom("1s")},
+			},
+		})
+		assert.NoError(t, err)
+		if assert.Len(t, e.scenarios, 2) {
+			assert.Equal(t, 5*time.Second, e.scenarios[0].VUs[0].GracefulStop)
+			assert.Equal(t, 1*time.Second, e.scenarios[1].VUs[0].GracefulStop)
+		}
+
+		t.Run("invalid", func(t *testing.T) {
+			_, err, _ := newTestEngine(nil, Options{Scenarios: map[string]Scenario{
+				"sc": {VUs: null.IntFrom(1), Duration: 1 * time.Second, GracefulStop: null.StringFrom("x")},
+			}})
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), "scenario sc: gracefulStop: time: invalid duration")
+			}
+		})
+	})
+	testdata := map[string]struct {
+		Scenario Scenario
+		Error    string
+	}{
+		"no vus":         {Scenario{Duration: 1 * time.Second}, "scenario sc: vus must be positive"},
+		"no duration":    {Scenario{VUs: null.IntFrom(1)}, "scenario sc: duration must be positive"},
+		"negative start": {Scenario{VUs: null.IntFrom(1), Duration: 1 * time.Second, StartTime: -1}, "scenario sc: startTime can't be negative"},
+	}
+	for name, data := range testdata {
+		t.Run(name, func(t *testing.T) {
+			_, err, _ := newTestEngine(nil, Options{Scenarios: map[string]Scenario{"sc": data.Scenario}})
+			assert.EqualError(t, err, data.Error)
+		})
+	}
+}
+
+func TestEngineRunGracefulStop(t *testing.T) {
+	testMetric := stats.New("test_metric", stats.Counter)
+	testdata := map[string]struct {
+		gracefulStop string
+		count        int
+	}{
+		"none":   {"", 1},
+		"window": {"200ms", 2},
+	}
+	for name, data := range testdata {
+		t.Run(name, func(t *testing.T) {
+			// The second iteration is still running when the test ends.
+			c := &dummy.Collector{}
+			e, err, _ := newTestEngine(RunnerFunc(func(ctx context.Context) ([]stats.Sample, error) {
+				select {
+				case <-time.After(80 * time.Millisecond):
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+				return []stats.Sample{{Metric: testMetric, Value: 1}}, nil
+			}), Options{
+				VUs:          null.IntFrom(1),
+				VUsMax:       null.IntFrom(1),
+				Duration:     null.StringFrom("100ms"),
+				GracefulStop: null.StringFrom(data.gracefulStop),
+			})
+			assert.NoError(t, err)
+			e.Collector = c
+			assert.NoError(t, e.Run(context.Background()))
+
+			count := 0
+			for _, sample := range c.Samples {
+				if sample.Metric == testMetric {
+					count++
+				}
+			}
+			assert.Equal(t, data.count, count)
+		})
+	}
+}
+
+func TestEngineRunScenarios(t *testing.T) {
+	testMetric := stats.New("test_metric", stats.Counter)
+	c := &dummy.Collector{}
+
+	e, err, _ := newTestEngine(RunnerFunc(func(ctx context.Context) ([]stats.Sample, error) {
+		sc := GetScenario(ctx)
+		if sc == nil {
+			return nil, errors.New("no scenario in context")
+		}
+		return []stats.Sample{{Metric: testMetric, Value: 1, Tags: map[string]string{"exec": sc.Exec.String}}}, nil
+	}), Options{Scenarios: map[string]Scenario{
+		"loop": {
+			VUs:      null.IntFrom(1),
+			Duration: 200 * time.Millisecond,
+			Exec:     null.StringFrom("loopFn"),
+			Tags:     map[string]string{"kind": "loop"},
+		},
+		"rate": {
+			VUs:       null.IntFrom(1),
+			Rate:      null.IntFrom(50),
+			StartTime: 100 * time.Millisecond,
+			Duration:  200 * time.Millisecond,
+			Exec:      null.StringFrom("rateFn"),
+		},
+	}})
+	assert.NoError(t, err)
+	e.Collector = c
+
+	startTime := time.Now()
+	assert.NoError(t, e.Run(context.Background()))
+	assert.WithinDuration(t, startTime.Add(300*time.Millisecond), time.Now(), 200*time.Millisecond)
+	assert.Equal(t, int64(0), e.numErrors)
+
+	counts := map[string]int{}
+	for _, sample := range c.Samples {
+		if sample.Metric != testMetric {
+			continue
+		}
+		counts[sample.Tags["scenario"]]++
+		switch sample.Tags["scenario"] {
+		case "loop":
+			assert.Equal(t, "loopFn", sample.Tags["exec"])
+			assert.Equal(t, "loop", sample.Tags["kind"])
+		case "rate":
+			assert.Equal(t, "rateFn", sample.Tags["exec"])
+		default:
+			assert.Fail(t, "sample without a scenario", "%v", sample.Tags)
+		}
+	}
+	assert.True(t, counts["loop"] > 10, "too few looping iterations: %d", counts["loop"])
+	assert.True(t, counts["rate"] > 0 && counts["rate"] <= 11, "wrong number of rate iterations: %d", counts["rate"])
+}
+
 func TestEngineCollector(t *testing.T) {
 	testMetric := stats.New("test_metric", stats.Trend)
 	c := &dummy.Collector{}
@@ -880,6 +1320,16 @@ func TestEngineCollector(t *testing.T) {
 	assert.Equal(t, numEngineSamples, numCollectorSamples)
 }
 
+func TestEngine_emitMetricsExternalVUs(t *testing.T) {
+	e, err, _ := newTestEngine(nil, Options{VUs: null.IntFrom(1), VUsMax: null.IntFrom(2)})
+	assert.NoError(t, err)
+	e.ExternalVUs = func() (int64, int64) { return 10, 20 }
+
+	e.emitMetrics()
+	assert.Equal(t, 11.0, e.Metrics[metrics.VUs.Name].Sink.(*stats.GaugeSink).Value)
+	assert.Equal(t, 22.0, e.Metrics[metrics.VUsMax.Name].Sink.(*stats.GaugeSink).Value)
+}
+
 func TestEngine_processSamples(t *testing.T) {
 	metric := stats.New("my_metric", stats.Gauge)
 
@@ -893,6 +1343,77 @@ func TestEngine_processSamples(t *testing.T) {
 
 		assert.IsType(t, &stats.GaugeSink{}, e.Metrics["my_metric"].Sink)
 	})
+	t.Run("tags", func(t *testing.T) {
+		e, err, _ := newTestEngine(nil, Options{Tags: map[string]string{"env": "staging", "a": "0"}})
+		assert.NoError(t, err)
+
+		shared := map[string]string{"a": "1"}
+		samples := []stats.Sample{
+			{Metric: metric, Value: 1, Tags: shared},
+			{Metric: metric, Value: 2},
+		}
+		e.applyTags(samples)
+		assert.Equal(t, map[string]string{"env": "staging", "a": "1"}, samples[0].Tags)
+		assert.Equal(t, map[string]string{"env": "staging", "a": "0"}, samples[1].Tags)
+		assert.Equal(t, map[string]string{"a": "1"}, shared, "sample tags were modified in place")
+	})
+	t.Run("system tags", func(t *testing.T) {
+		e, err, _ := newTestEngine(nil, Options{
+			SystemTags: []string{"status"},
+			Tags:       map[string]string{"env": "staging"},
+		})
+		assert.NoError(t, err)
+
+		samples := []stats.Sample{{Metric: metric, Value: 1, Tags: map[string]string{
+			"status": "200", "url": "http://example.com/", "error": "", "custom": "1",
+		}}}
+		e.applyTags(samples)
+		assert.Equal(t, map[string]string{"status": "200", "custom": "1", "env": "staging"}, samples[0].Tags)
+
+		t.Run("none", func(t *testing.T) {
+			e, err, _ := newTestEngine(nil, Options{SystemTags: []string{}})
+			assert.NoError(t, err)
+
+			samples := []stats.Sample{{Metric: metric, Value: 1, Tags: map[string]string{"status": "200", "custom": "1"}}}
+			e.applyTags(samples)
+			assert.Equal(t, map[string]string{"custom": "1"}, samples[0].Tags)
+		})
+		t.Run("repeated", func(t *testing.T) {
+			e, err, _ := newTestEngine(nil, Options{SystemTags: []string{"url", "status", "url"}})
+			assert.NoError(t, err)
+
+			samples := []stats.Sample{{Metric: metric, Value: 1, Tags: map[string]string{"status": "200", "url": "http://example.com/", "method": "GET"}}}
+			e.applyTags(samples)
+			assert.Equal(t, map[string]string{"status": "200", "url": "http://example.com/"}, samples[0].Tags)
+		})
+		t.Run("unknown", func(t *testing.T) {
+			_, err, _ := newTestEngine(nil, Options{SystemTags: []string{"status", "colour"}})
+			assert.EqualError(t, err, "options.systemTags: unknown system tag: colour")
+		})
+		t.Run("threshold", func(t *testing.T) {
+			ths, err := stats.NewThresholds([]string{`1+1==2`})
+			assert.NoError(t, err)
+
+			_, err, _ = newTestEngine(nil, Options{
+				SystemTags: []string{"url"},
+				Thresholds: map[string]stats.Thresholds{"my_metric{status:200}": ths},
+			})
+			assert.EqualError(t, err, "options.thresholds: my_metric{status:200} filters on the status tag, which isn't in systemTags")
+
+			_, err, _ = newTestEngine(nil, Options{
+				SystemTags: []string{"status"},
+				Thresholds: map[string]stats.Thresholds{"my_metric{status:200,custom:1}": ths},
+			})
+			assert.NoError(t, err, "only system tags are dropped")
+
+			_, err, _ = newTestEngine(nil, Options{
+				SystemTags: []string{},
+				Tags:       map[string]string{"status": "test"},
+				Thresholds: map[string]stats.Thresholds{"my_metric{status:test}": ths},
+			})
+			assert.NoError(t, err, "tags set for the whole test aren't dropped")
+		})
+	})
 	t.Run("submetric", func(t *testing.T) {
 		ths, err := stats.NewThresholds([]string{`1+1==2`})
 		assert.NoError(t, err)
@@ -916,6 +1437,29 @@ func TestEngine_processSamples(t *testing.T) {
 		assert.IsType(t, &stats.GaugeSink{}, e.Metrics["my_metric"].Sink)
 		assert.IsType(t, &stats.GaugeSink{}, e.Metrics["my_metric{a:1}"].Sink)
 	})
+	t.Run("submetric accumulates", func(t *testing.T) {
+		trend := stats.New("my_trend", stats.Trend)
+		ths, err := stats.NewThresholds([]string{`1+1==2`})
+		assert.NoError(t, err)
+
+		e, err, _ := newTestEngine(nil, Options{
+			Thresholds: map[string]stats.Thresholds{
+				"my_trend{a:1}": ths,
+			},
+		})
+		assert.NoError(t, err)
+
+		e.processSamples(
+			stats.Sample{Metric: trend, Value: 1.0, Tags: map[string]string{"a": "1"}},
+			stats.Sample{Metric: trend, Value: 2.0, Tags: map[string]string{"a": "2"}},
+		)
+		e.processSamples(
+			stats.Sample{Metric: trend, Value: 3.0, Tags: map[string]string{"a": "1"}},
+		)
+
+		assert.Equal(t, []float64{1.0, 2.0, 3.0}, e.Metrics["my_trend"].Sink.(*stats.TrendSink).Values)
+		assert.Equal(t, []float64{1.0, 3.0}, e.Metrics["my_trend{a:1}"].Sink.(*stats.TrendSink).Values)
+	})
 }
 
 func TestEngine_processThresholds(t *testing.T) {
@@ -955,3 +1499,54 @@ func TestEngine_processThresholds(t *testing.T) {
 		})
 	}
 }
+
+func TestEngine_processThresholdsAbort(t *testing.T) {
+	metric := stats.New("my_metric", stats.Gauge)
+
+	testdata := map[string]struct {
+		abort  bool
+		atTime time.Duration
+		src    string
+	}{
+		"passing":             {false, 0, `[{"threshold": "1+1==2", "abortOnFail": true}]`},
+		"failing":             {true, 0, `[{"threshold": "1+1==3", "abortOnFail": true}]`},
+		"failing,no abort":    {false, 0, `["1+1==3"]`},
+		"failing,in grace":    {false, 5 * time.Second, `[{"threshold": "1+1==3", "abortOnFail": true, "delayAbortEval": "10s"}]`},
+		"failing,after grace": {true, 10 * time.Second, `[{"threshold": "1+1==3", "abortOnFail": true, "delayAbortEval": "10s"}]`},
+	}
+	for name, data := range testdata {
+		t.Run(name, func(t *testing.T) {
+			var ths stats.Thresholds
+			assert.NoError(t, json.Unmarshal([]byte(data.src), &ths))
+
+			e, err, _ := newTestEngine(nil, Options{Thresholds: map[string]stats.Thresholds{"my_metric": ths}})
+			assert.NoError(t, err)
+			e.atTime = data.atTime
+
+			e.processSamples(stats.Sample{Metric: metric, Value: 1.25})
+			assert.Equal(t, data.abort, e.processThresholds())
+		})
+	}
+}
+
+func TestEngineRunThresholdsAbort(t *testing.T) {
+	metric := stats.New("my_metric", stats.Gauge)
+
+	var ths stats.Thresholds
+	assert.NoError(t, json.Unmarshal([]byte(`[{"threshold": "1+1==3", "abortOnFail": true}]`), &ths))
+
+	e, err, _ := newTestEngine(RunnerFunc(func(ctx context.Context) ([]stats.Sample, error) {
+		return []stats.Sample{{Metric: metric, Value: 1.0}}, nil
+	}), Options{
+		VUs:        null.IntFrom(1),
+		VUsMax:     null.IntFrom(1),
+		Thresholds: map[string]stats.Thresholds{"my_metric": ths},
+	})
+	assert.NoError(t, err)
+	e.Stages = []Stage{{Duration: 1 * time.Minute}}
+
+	startTime := time.Now()
+	assert.NoError(t, e.Run(context.Background()))
+	assert.WithinDuration(t, startTime.Add(ThresholdsRate), time.Now(), 1*time.Second)
+	assert.True(t, e.IsTainted())
+}
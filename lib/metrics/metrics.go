@@ -11,6 +11,9 @@ var (
 	Iterations = stats.New("iterations", stats.Counter)
 	Errors     = stats.New("errors", stats.Counter)
 
+	// Emitted when an iteration is due, but there's no free VU to run it.
+	DroppedIterations = stats.New("dropped_iterations", stats.Counter)
+
 	// Runner-emitted.
 	Checks = stats.New("checks", stats.Rate)
 
@@ -23,6 +26,17 @@ var (
 	HTTPReqWaiting    = stats.New("http_req_waiting", stats.Trend, stats.Time)
 	HTTPReqReceiving  = stats.New("http_req_receiving", stats.Trend, stats.Time)
 
+	// Websocket-related.
+	WSSessions         = stats.New("ws_sessions", stats.Counter)
+	WSMessagesSent     = stats.New("ws_msgs_sent", stats.Counter)
+	WSMessagesReceived = stats.New("ws_msgs_received", stats.Counter)
+	WSPing             = stats.New("ws_ping", stats.Trend, stats.Time)
+	WSSessionDuration  = stats.New("ws_session_duration", stats.Trend, stats.Time)
+	WSConnecting       = stats.New("ws_connecting", stats.Trend, stats.Time)
+
+	// gRPC-related.
+	GRPCReqDuration = stats.New("grpc_req_duration", stats.Trend, stats.Time)
+
 	// Network-related; used for future protocols as well.
 	DataSent     = stats.New("data_sent", stats.Counter, stats.Data)
 	DataReceived = stats.New("data_received", stats.Counter, stats.Data)
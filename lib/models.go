@@ -46,6 +46,13 @@ type Stage struct {
 	Target   null.Int      `json:"target"`
 }
 
+func (s Stage) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Duration string   `json:"duration"`
+		Target   null.Int `json:"target"`
+	}{s.Duration.String(), s.Target})
+}
+
 func (s *Stage) UnmarshalJSON(data []byte) error {
 	var fields struct {
 		Duration string   `json:"duration"`
@@ -68,6 +75,75 @@ func (s *Stage) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// A Scenario is a workload that's scheduled independently of the others in a test; it gets
+// its own VUs, which either loop for its whole duration, or (if Rate is set) pick up
+// iterations at a fixed rate. All samples it emits are tagged with its name and Tags.
+type Scenario struct {
+	Name string `json:"-"`
+
+	VUs       null.Int          `json:"vus"`
+	Rate      null.Int          `json:"rate"`
+	StartTime time.Duration     `json:"startTime"`
+	Duration  time.Duration     `json:"duration"`
+	Exec      null.String       `json:"exec"`
+	Tags      map[string]string `json:"tags"`
+
+	// Overrides the test's gracefulStop for this scenario's iterations.
+	GracefulStop null.String `json:"gracefulStop"`
+}
+
+func (s Scenario) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		VUs       null.Int          `json:"vus"`
+		Rate      null.Int          `json:"rate"`
+		StartTime string            `json:"startTime"`
+		Duration  string            `json:"duration"`
+		Exec      null.String       `json:"exec"`
+		Tags      map[string]string `json:"tags"`
+
+		GracefulStop null.String `json:"gracefulStop"`
+	}{s.VUs, s.Rate, s.StartTime.String(), s.Duration.String(), s.Exec, s.Tags, s.GracefulStop})
+}
+
+func (s *Scenario) UnmarshalJSON(data []byte) error {
+	var fields struct {
+		VUs       null.Int          `json:"vus"`
+		Rate      null.Int          `json:"rate"`
+		StartTime string            `json:"startTime"`
+		Duration  string            `json:"duration"`
+		Exec      null.String       `json:"exec"`
+		Tags      map[string]string `json:"tags"`
+
+		GracefulStop null.String `json:"gracefulStop"`
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	s.VUs = fields.VUs
+	s.Rate = fields.Rate
+	s.Exec = fields.Exec
+	s.Tags = fields.Tags
+	s.GracefulStop = fields.GracefulStop
+
+	if fields.StartTime != "" {
+		d, err := time.ParseDuration(fields.StartTime)
+		if err != nil {
+			return errors.Wrap(err, "startTime")
+		}
+		s.StartTime = d
+	}
+	if fields.Duration != "" {
+		d, err := time.ParseDuration(fields.Duration)
+		if err != nil {
+			return errors.Wrap(err, "duration")
+		}
+		s.Duration = d
+	}
+
+	return nil
+}
+
 type Group struct {
 	ID     string            `json:"id"`
 	Path   string            `json:"path"`
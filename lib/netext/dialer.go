@@ -22,17 +22,35 @@ package netext
 
 import (
 	"context"
+	"math/rand"
 	"net"
-	"strings"
 	"sync/atomic"
 
+	"github.com/pkg/errors"
 	"github.com/viki-org/dnscache"
 )
 
+// Ways a Dialer can pick which of a name's IPs to connect to.
+const (
+	DNSFirst      = "first"
+	DNSRandom     = "random"
+	DNSRoundRobin = "roundRobin"
+)
+
 type Dialer struct {
+	// Round-robin counter; first in the struct, so it's 64-bit aligned for atomic access.
+	next uint64
+
 	net.Dialer
 
+	// Caches lookups; if nil, names are resolved on every connection.
 	Resolver *dnscache.Resolver
+
+	// Static host mappings, to an IP or another name, checked before the resolver is.
+	Hosts map[string]string
+
+	// Which of a name's IPs to connect to; see the DNS* constants.
+	Select string
 }
 
 func NewDialer(dialer net.Dialer) *Dialer {
@@ -42,17 +60,16 @@ func NewDialer(dialer net.Dialer) *Dialer {
 	}
 }
 
-func (d Dialer) DialContext(ctx context.Context, proto, addr string) (net.Conn, error) {
-	delimiter := strings.LastIndex(addr, ":")
-	ip, err := d.Resolver.FetchOne(addr[:delimiter])
+func (d *Dialer) DialContext(ctx context.Context, proto, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
 	if err != nil {
 		return nil, err
 	}
-	ipStr := ip.String()
-	if strings.ContainsRune(ipStr, ':') {
-		ipStr = "[" + ipStr + "]"
+	ip, err := d.lookup(host)
+	if err != nil {
+		return nil, err
 	}
-	conn, err := d.Dialer.DialContext(ctx, proto, ipStr+":"+addr[delimiter+1:])
+	conn, err := d.Dialer.DialContext(ctx, proto, net.JoinHostPort(ip.String(), port))
 	if err != nil {
 		return nil, err
 	}
@@ -63,6 +80,39 @@ func (d Dialer) DialContext(ctx context.Context, proto, addr string) (net.Conn,
 	return conn, err
 }
 
+func (d *Dialer) lookup(host string) (net.IP, error) {
+	if mapped, ok := d.Hosts[host]; ok {
+		host = mapped
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip, nil
+	}
+
+	var ips []net.IP
+	var err error
+	if d.Resolver != nil {
+		ips, err = d.Resolver.Fetch(host)
+	} else {
+		ips, err = net.LookupIP(host)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, errors.Errorf("no IPs found for host: %s", host)
+	}
+
+	switch d.Select {
+	case DNSRandom:
+		return ips[rand.Intn(len(ips))], nil
+	case DNSRoundRobin:
+		n := atomic.AddUint64(&d.next, 1) - 1
+		return ips[n%uint64(len(ips))], nil
+	default:
+		return ips[0], nil
+	}
+}
+
 type Conn struct {
 	net.Conn
 
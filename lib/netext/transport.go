@@ -0,0 +1,77 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"net"
+	"net/http"
+)
+
+// A HostRoute sends requests for matching hosts to a transport of their own.
+type HostRoute struct {
+	Match     func(host string) bool
+	Transport *http.Transport
+}
+
+// HostTransport is an http.RoundTripper that picks a transport by the request's host, for
+// settings (eg. TLS client certificates) that only apply to some hosts. Routes are tried in
+// order, with Default used if none match.
+type HostTransport struct {
+	Default *http.Transport
+	Routes  []HostRoute
+}
+
+// For returns the transport to use for a host, which may include a port.
+func (t *HostTransport) For(host string) *http.Transport {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	for _, route := range t.Routes {
+		if route.Match(host) {
+			return route.Transport
+		}
+	}
+	return t.Default
+}
+
+func (t *HostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.For(req.URL.Host).RoundTrip(req)
+}
+
+func (t *HostTransport) CloseIdleConnections() {
+	t.Default.CloseIdleConnections()
+	for _, route := range t.Routes {
+		route.Transport.CloseIdleConnections()
+	}
+}
+
+// TransportFor returns the transport a RoundTripper would use for a host, for protocols that
+// need to dial connections themselves, but want the same settings as HTTP requests.
+func TransportFor(rt http.RoundTripper, host string) (*http.Transport, bool) {
+	switch t := rt.(type) {
+	case *http.Transport:
+		return t, true
+	case *HostTransport:
+		return t.For(host), true
+	default:
+		return nil, false
+	}
+}
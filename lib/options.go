@@ -25,6 +25,7 @@ import (
 	"time"
 
 	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
 
 	"gopkg.in/guregu/null.v3"
 )
@@ -47,6 +48,69 @@ func (d *Duration) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// DNS settings for the connections VUs make.
+type DNSConfig struct {
+	// How long resolved names are cached: a duration, "0" to resolve on every connection, or
+	// "inf" (the default) to never re-resolve them.
+	TTL null.String `json:"ttl"`
+
+	// Which of a name's IPs to connect to: "first" (the default), "random" or "roundRobin".
+	Select null.String `json:"select"`
+}
+
+func (c *DNSConfig) UnmarshalJSON(data []byte) error {
+	type dnsConfig DNSConfig
+	var v dnsConfig
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if v.TTL.Valid {
+		if _, err := ParseDNSTTL(v.TTL.String); err != nil {
+			return err
+		}
+	}
+	if v.Select.Valid {
+		if err := ValidateDNSSelect(v.Select.String); err != nil {
+			return err
+		}
+	}
+	*c = DNSConfig(v)
+	return nil
+}
+
+// Parses a DNS TTL; "inf" or an empty string, which mean names are cached forever, return 0.
+// A TTL of "0" is returned as a negative duration, meaning names aren't cached at all.
+func ParseDNSTTL(s string) (time.Duration, error) {
+	switch s {
+	case "", "inf":
+		return 0, nil
+	case "0":
+		return -1, nil
+	}
+	ttl, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, errors.Errorf("invalid DNS TTL: %s", s)
+	}
+	if ttl <= 0 {
+		return -1, nil
+	}
+	return ttl, nil
+}
+
+func ValidateDNSSelect(s string) error {
+	switch s {
+	case "", "first", "random", "roundRobin":
+		return nil
+	default:
+		return errors.Errorf("invalid DNS select policy: %s", s)
+	}
+}
+
+// Tags k6 itself attaches to samples; the systemTags option picks which of them are kept.
+var SystemTagNames = []string{
+	"proto", "subproto", "status", "method", "url", "group", "check", "error", "scenario", "vu",
+}
+
 type Options struct {
 	Paused     null.Bool   `json:"paused"`
 	VUs        null.Int    `json:"vus"`
@@ -55,15 +119,52 @@ type Options struct {
 	Iterations null.Int    `json:"iterations"`
 	Stages     []Stage     `json:"stages"`
 
+	// How long iterations that are still running when the test ends, or their VU is stopped,
+	// get to finish before they're interrupted; by default, they're interrupted right away.
+	GracefulStop null.String `json:"gracefulStop"`
+
+	// Iterations per second; switches to arrival-rate execution, where VUs no longer loop,
+	// but pick up iterations as they're scheduled. Stage targets are then rates, not VUs.
+	Rate null.Int `json:"rate"`
+
+	// Named workloads that run concurrently, each on its own schedule. If any are given,
+	// the top-level vus, stages, duration and rate are ignored.
+	Scenarios map[string]Scenario `json:"scenarios"`
+
+	// Runs only this part of the test, eg. as one of several instances running it together.
+	ExecutionSegment *ExecutionSegment `json:"executionSegment"`
+
 	Linger        null.Bool `json:"linger"`
 	NoUsageReport null.Bool `json:"noUsageReport"`
 
 	MaxRedirects          null.Int  `json:"maxRedirects"`
 	InsecureSkipTLSVerify null.Bool `json:"insecureSkipTLSVerify"`
 	NoConnectionReuse     null.Bool `json:"noConnectionReuse"`
+	NoVUConnectionReuse   null.Bool `json:"noVUConnectionReuse"`
+
+	// Static host mappings, to an IP or another name, eg. to aim at specific replicas.
+	Hosts map[string]string `json:"hosts"`
+	DNS   DNSConfig         `json:"dns"`
+
+	// Limits on how many requests an http.batch() call makes in parallel, in total and to any
+	// one host; 0 means no limit.
+	Batch        null.Int `json:"batch"`
+	BatchPerHost null.Int `json:"batchPerHost"`
+
+	// TLS settings; client certificates are only used for the domains they're given for.
+	TLSAuth         []*TLSAuth      `json:"tlsAuth"`
+	TLSVersion      *TLSVersions    `json:"tlsVersion"`
+	TLSCipherSuites TLSCipherSuites `json:"tlsCipherSuites"`
 
 	Thresholds map[string]stats.Thresholds `json:"thresholds"`
 
+	// Added to every sample the test emits; tags set on the samples themselves take precedence.
+	Tags map[string]string `json:"tags"`
+
+	// The system tags that are kept on samples, to keep down cardinality in outputs; nil keeps
+	// all of them, an empty list none.
+	SystemTags []string `json:"systemTags"`
+
 	// These values are for third party collectors' benefit.
 	External map[string]interface{} `json:"ext"`
 }
@@ -87,6 +188,18 @@ func (o Options) Apply(opts Options) Options {
 	if opts.Stages != nil {
 		o.Stages = opts.Stages
 	}
+	if opts.GracefulStop.Valid {
+		o.GracefulStop = opts.GracefulStop
+	}
+	if opts.Rate.Valid {
+		o.Rate = opts.Rate
+	}
+	if opts.Scenarios != nil {
+		o.Scenarios = opts.Scenarios
+	}
+	if opts.ExecutionSegment != nil {
+		o.ExecutionSegment = opts.ExecutionSegment
+	}
 	if opts.Linger.Valid {
 		o.Linger = opts.Linger
 	}
@@ -102,9 +215,42 @@ func (o Options) Apply(opts Options) Options {
 	if opts.NoConnectionReuse.Valid {
 		o.NoConnectionReuse = opts.NoConnectionReuse
 	}
+	if opts.NoVUConnectionReuse.Valid {
+		o.NoVUConnectionReuse = opts.NoVUConnectionReuse
+	}
+	if opts.Hosts != nil {
+		o.Hosts = opts.Hosts
+	}
+	if opts.DNS.TTL.Valid {
+		o.DNS.TTL = opts.DNS.TTL
+	}
+	if opts.DNS.Select.Valid {
+		o.DNS.Select = opts.DNS.Select
+	}
+	if opts.Batch.Valid {
+		o.Batch = opts.Batch
+	}
+	if opts.BatchPerHost.Valid {
+		o.BatchPerHost = opts.BatchPerHost
+	}
+	if opts.TLSAuth != nil {
+		o.TLSAuth = opts.TLSAuth
+	}
+	if opts.TLSVersion != nil {
+		o.TLSVersion = opts.TLSVersion
+	}
+	if opts.TLSCipherSuites != nil {
+		o.TLSCipherSuites = opts.TLSCipherSuites
+	}
 	if opts.Thresholds != nil {
 		o.Thresholds = opts.Thresholds
 	}
+	if opts.Tags != nil {
+		o.Tags = opts.Tags
+	}
+	if opts.SystemTags != nil {
+		o.SystemTags = opts.SystemTags
+	}
 	if opts.External != nil {
 		o.External = opts.External
 	}
@@ -117,10 +263,15 @@ func (o Options) SetAllValid(valid bool) Options {
 	o.VUsMax.Valid = valid
 	o.Duration.Valid = valid
 	o.Iterations.Valid = valid
+	o.GracefulStop.Valid = valid
+	o.Rate.Valid = valid
 	o.Linger.Valid = valid
 	o.NoUsageReport.Valid = valid
 	o.MaxRedirects.Valid = valid
 	o.InsecureSkipTLSVerify.Valid = valid
 	o.NoConnectionReuse.Valid = valid
+	o.NoVUConnectionReuse.Valid = valid
+	o.Batch.Valid = valid
+	o.BatchPerHost.Valid = valid
 	return o
 }
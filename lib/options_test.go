@@ -21,6 +21,8 @@
 package lib
 
 import (
+	"crypto/tls"
+	"encoding/json"
 	"testing"
 	"time"
 
@@ -29,6 +31,26 @@ import (
 	"gopkg.in/guregu/null.v3"
 )
 
+func TestScenarioUnmarshalJSON(t *testing.T) {
+	var sc Scenario
+	assert.NoError(t, json.Unmarshal([]byte(`{
+		"vus": 10, "rate": 200, "startTime": "30s", "duration": "1m",
+		"exec": "api", "tags": {"a": "1"}
+	}`), &sc))
+	assert.Equal(t, Scenario{
+		VUs:       null.IntFrom(10),
+		Rate:      null.IntFrom(200),
+		StartTime: 30 * time.Second,
+		Duration:  1 * time.Minute,
+		Exec:      null.StringFrom("api"),
+		Tags:      map[string]string{"a": "1"},
+	}, sc)
+
+	t.Run("invalid duration", func(t *testing.T) {
+		assert.Error(t, json.Unmarshal([]byte(`{"duration": "forever"}`), &sc))
+	})
+}
+
 func TestOptionsApply(t *testing.T) {
 	t.Run("Paused", func(t *testing.T) {
 		opts := Options{}.Apply(Options{Paused: null.BoolFrom(true)})
@@ -61,6 +83,24 @@ func TestOptionsApply(t *testing.T) {
 		assert.Len(t, opts.Stages, 1)
 		assert.Equal(t, 1*time.Second, opts.Stages[0].Duration)
 	})
+	t.Run("Rate", func(t *testing.T) {
+		opts := Options{}.Apply(Options{Rate: null.IntFrom(100)})
+		assert.True(t, opts.Rate.Valid)
+		assert.Equal(t, int64(100), opts.Rate.Int64)
+	})
+	t.Run("Scenarios", func(t *testing.T) {
+		opts := Options{}.Apply(Options{Scenarios: map[string]Scenario{
+			"browse": {VUs: null.IntFrom(50), Duration: 1 * time.Minute},
+		}})
+		assert.NotNil(t, opts.Scenarios)
+		assert.Contains(t, opts.Scenarios, "browse")
+	})
+	t.Run("ExecutionSegment", func(t *testing.T) {
+		seg, err := ParseExecutionSegment("1/2:1")
+		assert.NoError(t, err)
+		opts := Options{}.Apply(Options{ExecutionSegment: seg})
+		assert.Equal(t, seg, opts.ExecutionSegment)
+	})
 	t.Run("Linger", func(t *testing.T) {
 		opts := Options{}.Apply(Options{Linger: null.BoolFrom(true)})
 		assert.True(t, opts.Linger.Valid)
@@ -81,6 +121,44 @@ func TestOptionsApply(t *testing.T) {
 		assert.True(t, opts.NoConnectionReuse.Valid)
 		assert.True(t, opts.NoConnectionReuse.Bool)
 	})
+	t.Run("NoVUConnectionReuse", func(t *testing.T) {
+		opts := Options{}.Apply(Options{NoVUConnectionReuse: null.BoolFrom(true)})
+		assert.True(t, opts.NoVUConnectionReuse.Valid)
+		assert.True(t, opts.NoVUConnectionReuse.Bool)
+	})
+	t.Run("Hosts", func(t *testing.T) {
+		opts := Options{}.Apply(Options{Hosts: map[string]string{"example.com": "127.0.0.1"}})
+		assert.Equal(t, map[string]string{"example.com": "127.0.0.1"}, opts.Hosts)
+	})
+	t.Run("DNS", func(t *testing.T) {
+		opts := Options{DNS: DNSConfig{TTL: null.StringFrom("1m")}}.Apply(Options{
+			DNS: DNSConfig{Select: null.StringFrom("random")},
+		})
+		assert.Equal(t, DNSConfig{TTL: null.StringFrom("1m"), Select: null.StringFrom("random")}, opts.DNS)
+	})
+	t.Run("Batch", func(t *testing.T) {
+		opts := Options{}.Apply(Options{Batch: null.IntFrom(10)})
+		assert.True(t, opts.Batch.Valid)
+		assert.Equal(t, int64(10), opts.Batch.Int64)
+	})
+	t.Run("BatchPerHost", func(t *testing.T) {
+		opts := Options{}.Apply(Options{BatchPerHost: null.IntFrom(6)})
+		assert.True(t, opts.BatchPerHost.Valid)
+		assert.Equal(t, int64(6), opts.BatchPerHost.Int64)
+	})
+	t.Run("TLSAuth", func(t *testing.T) {
+		auth := []*TLSAuth{{Domains: []string{"example.com"}}}
+		opts := Options{}.Apply(Options{TLSAuth: auth})
+		assert.Equal(t, auth, opts.TLSAuth)
+	})
+	t.Run("TLSVersion", func(t *testing.T) {
+		opts := Options{}.Apply(Options{TLSVersion: &TLSVersions{Min: tls.VersionTLS12}})
+		assert.Equal(t, &TLSVersions{Min: tls.VersionTLS12}, opts.TLSVersion)
+	})
+	t.Run("TLSCipherSuites", func(t *testing.T) {
+		opts := Options{}.Apply(Options{TLSCipherSuites: TLSCipherSuites{tls.TLS_RSA_WITH_AES_128_GCM_SHA256}})
+		assert.Equal(t, TLSCipherSuites{tls.TLS_RSA_WITH_AES_128_GCM_SHA256}, opts.TLSCipherSuites)
+	})
 	t.Run("Thresholds", func(t *testing.T) {
 		opts := Options{}.Apply(Options{Thresholds: map[string]stats.Thresholds{
 			"metric": {
@@ -90,6 +168,17 @@ func TestOptionsApply(t *testing.T) {
 		assert.NotNil(t, opts.Thresholds)
 		assert.NotEmpty(t, opts.Thresholds)
 	})
+	t.Run("Tags", func(t *testing.T) {
+		opts := Options{}.Apply(Options{Tags: map[string]string{"env": "staging"}})
+		assert.Equal(t, map[string]string{"env": "staging"}, opts.Tags)
+	})
+	t.Run("SystemTags", func(t *testing.T) {
+		opts := Options{}.Apply(Options{SystemTags: []string{"url"}})
+		assert.Equal(t, []string{"url"}, opts.SystemTags)
+
+		opts = opts.Apply(Options{SystemTags: []string{}})
+		assert.Equal(t, []string{}, opts.SystemTags)
+	})
 	t.Run("External", func(t *testing.T) {
 		opts := Options{}.Apply(Options{External: map[string]interface{}{"a": 1}})
 		assert.Equal(t, map[string]interface{}{"a": 1}, opts.External)
@@ -100,3 +189,27 @@ func TestOptionsApply(t *testing.T) {
 		assert.True(t, opts.NoUsageReport.Bool)
 	})
 }
+
+func TestDNSConfig(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		var c DNSConfig
+		assert.NoError(t, json.Unmarshal([]byte(`{"ttl":"5m","select":"roundRobin"}`), &c))
+		assert.Equal(t, DNSConfig{TTL: null.StringFrom("5m"), Select: null.StringFrom("roundRobin")}, c)
+	})
+	t.Run("InvalidTTL", func(t *testing.T) {
+		var c DNSConfig
+		assert.EqualError(t, json.Unmarshal([]byte(`{"ttl":"forever"}`), &c), "invalid DNS TTL: forever")
+	})
+	t.Run("InvalidSelect", func(t *testing.T) {
+		var c DNSConfig
+		assert.EqualError(t, json.Unmarshal([]byte(`{"select":"last"}`), &c), "invalid DNS select policy: last")
+	})
+	t.Run("ParseTTL", func(t *testing.T) {
+		testdata := map[string]time.Duration{"": 0, "inf": 0, "0": -1, "0s": -1, "30s": 30 * time.Second}
+		for s, ttl := range testdata {
+			v, err := ParseDNSTTL(s)
+			assert.NoError(t, err)
+			assert.Equal(t, ttl, v, s)
+		}
+	})
+}
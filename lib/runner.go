@@ -35,6 +35,12 @@ type Runner interface {
 	// of prepared VUs to be used to quickly scale up and down.
 	NewVU() (VU, error)
 
+	// Runs pre-test setup, if any. Called once per test, before any VUs are started.
+	Setup(ctx context.Context) ([]stats.Sample, error)
+
+	// Runs post-test teardown, if any. Called once per test, after all VUs have stopped.
+	Teardown(ctx context.Context) ([]stats.Sample, error)
+
 	// Returns the default (root) group.
 	GetDefaultGroup() *Group
 
@@ -45,6 +51,23 @@ type Runner interface {
 	ApplyOptions(opts Options)
 }
 
+// A SummaryHandler is a Runner that can turn the end-of-test summary into reports of its own.
+type SummaryHandler interface {
+	// Returns the contents of each report by where to write it: a file path, "stdout" or
+	// "stderr". Returns nil if there's nothing to write.
+	HandleSummary(ctx context.Context, summary *Summary) (map[string][]byte, error)
+}
+
+// A SetupDataHolder is a Runner that can hand its setup() result to another instance of itself,
+// so that setup() runs once, even if the test is spread over several processes.
+type SetupDataHolder interface {
+	// Returns the JSON-encoded return value of setup(), or nil if it didn't return anything.
+	GetSetupData() []byte
+
+	// Uses data as setup()'s return value, instead of running it.
+	SetSetupData(data []byte)
+}
+
 // A VU is a Virtual User.
 type VU interface {
 	// Runs the VU once. An iteration should be completely self-contained, and no state
@@ -67,6 +90,14 @@ func (fn RunnerFunc) NewVU() (VU, error) {
 	return fn.VU(), nil
 }
 
+func (fn RunnerFunc) Setup(ctx context.Context) ([]stats.Sample, error) {
+	return nil, nil
+}
+
+func (fn RunnerFunc) Teardown(ctx context.Context) ([]stats.Sample, error) {
+	return nil, nil
+}
+
 func (fn RunnerFunc) GetDefaultGroup() *Group {
 	return &Group{}
 }
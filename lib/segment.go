@@ -0,0 +1,136 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package lib
+
+import (
+	"encoding/json"
+	"math/big"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/guregu/null.v3"
+)
+
+// An ExecutionSegment is the part of a test one instance runs, when several share it between
+// them; eg. "1/3:2/3" is the middle third. VUs and rates are divided so that the segments of a
+// test add up to the whole of it, whatever their sizes.
+type ExecutionSegment struct {
+	From, To *big.Rat
+}
+
+// Parses a segment in the format from:to, where both ends are fractions ("1/3") or decimals
+// ("0.5") between 0 and 1.
+func ParseExecutionSegment(s string) (*ExecutionSegment, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return nil, errors.Errorf("invalid execution segment: %s", s)
+	}
+	from, ok := new(big.Rat).SetString(parts[0])
+	if !ok {
+		return nil, errors.Errorf("invalid execution segment: %s", s)
+	}
+	to, ok := new(big.Rat).SetString(parts[1])
+	if !ok {
+		return nil, errors.Errorf("invalid execution segment: %s", s)
+	}
+	if from.Sign() < 0 || to.Cmp(big.NewRat(1, 1)) > 0 || from.Cmp(to) >= 0 {
+		return nil, errors.Errorf("execution segment out of range: %s", s)
+	}
+	return &ExecutionSegment{From: from, To: to}, nil
+}
+
+// Splits a test into n equal segments.
+func SplitExecution(n int) []*ExecutionSegment {
+	segments := make([]*ExecutionSegment, n)
+	for i := range segments {
+		segments[i] = &ExecutionSegment{
+			From: big.NewRat(int64(i), int64(n)),
+			To:   big.NewRat(int64(i+1), int64(n)),
+		}
+	}
+	return segments
+}
+
+func (s *ExecutionSegment) String() string {
+	return s.From.RatString() + ":" + s.To.RatString()
+}
+
+// Returns this segment's share of n; floor(n*to) - floor(n*from), so that adjacent segments
+// never both round the same unit in, or both out.
+func (s *ExecutionSegment) Scale(n int64) int64 {
+	return floorMul(n, s.To) - floorMul(n, s.From)
+}
+
+func floorMul(n int64, r *big.Rat) int64 {
+	v := new(big.Int).Mul(big.NewInt(n), r.Num())
+	return v.Div(v, r.Denom()).Int64()
+}
+
+// Returns the options for this segment of a test without scenarios; VUs, rates and stage
+// targets are scaled. Scenarios are scaled by the engine, as it sets them up.
+func (s *ExecutionSegment) scaleOptions(o Options) Options {
+	// A rate scaled down to 0 would turn this into a looping test; run nothing at all instead.
+	idle := false
+	if o.Rate.Valid && o.Rate.Int64 > 0 {
+		o.Rate = null.IntFrom(s.Scale(o.Rate.Int64))
+		idle = o.Rate.Int64 == 0
+	}
+	scale := func(n int64) int64 {
+		if idle {
+			return 0
+		}
+		return s.Scale(n)
+	}
+
+	if o.VUs.Valid {
+		o.VUs = null.IntFrom(scale(o.VUs.Int64))
+	}
+	if o.VUsMax.Valid {
+		o.VUsMax = null.IntFrom(scale(o.VUsMax.Int64))
+	}
+	if o.Stages != nil {
+		stages := make([]Stage, len(o.Stages))
+		for i, stage := range o.Stages {
+			if stage.Target.Valid {
+				stage.Target = null.IntFrom(scale(stage.Target.Int64))
+			}
+			stages[i] = stage
+		}
+		o.Stages = stages
+	}
+	return o
+}
+
+func (s *ExecutionSegment) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+func (s *ExecutionSegment) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+	seg, err := ParseExecutionSegment(str)
+	if err != nil {
+		return err
+	}
+	*s = *seg
+	return nil
+}
@@ -0,0 +1,129 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package lib
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestParseExecutionSegment(t *testing.T) {
+	testdata := map[string]string{
+		"0:1":       "0:1",
+		"1/3:2/3":   "1/3:2/3",
+		"0.5:1":     "1/2:1",
+		"0:0.25":    "0:1/4",
+		"2/4:12/16": "1/2:3/4",
+	}
+	for s, str := range testdata {
+		t.Run(s, func(t *testing.T) {
+			seg, err := ParseExecutionSegment(s)
+			assert.NoError(t, err)
+			assert.Equal(t, str, seg.String())
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, s := range []string{"", "1/2", "a:1", "0:b", "0:1:2"} {
+			_, err := ParseExecutionSegment(s)
+			assert.EqualError(t, err, "invalid execution segment: "+s)
+		}
+	})
+	t.Run("Out of range", func(t *testing.T) {
+		for _, s := range []string{"-1/2:1", "0:3/2", "1/2:1/2", "1:0"} {
+			_, err := ParseExecutionSegment(s)
+			assert.EqualError(t, err, "execution segment out of range: "+s)
+		}
+	})
+}
+
+func TestExecutionSegmentJSON(t *testing.T) {
+	var opts Options
+	assert.NoError(t, json.Unmarshal([]byte(`{"executionSegment":"1/3:2/3"}`), &opts))
+	if assert.NotNil(t, opts.ExecutionSegment) {
+		assert.Equal(t, "1/3:2/3", opts.ExecutionSegment.String())
+	}
+
+	data, err := json.Marshal(opts.ExecutionSegment)
+	assert.NoError(t, err)
+	assert.Equal(t, `"1/3:2/3"`, string(data))
+
+	assert.EqualError(t, json.Unmarshal([]byte(`{"executionSegment":"1:0"}`), &opts), "execution segment out of range: 1:0")
+}
+
+func TestExecutionSegmentScale(t *testing.T) {
+	// However a test is split, the segments' shares add up to the whole.
+	for _, n := range []int{1, 2, 3, 7} {
+		for _, total := range []int64{0, 1, 2, 10, 99, 1000} {
+			var sum int64
+			for _, seg := range SplitExecution(n) {
+				sum += seg.Scale(total)
+			}
+			assert.Equal(t, total, sum, "%d split %d ways", total, n)
+		}
+	}
+
+	segs := SplitExecution(3)
+	assert.Equal(t, int64(0), segs[0].Scale(2))
+	assert.Equal(t, int64(1), segs[1].Scale(2))
+	assert.Equal(t, int64(1), segs[2].Scale(2))
+}
+
+func TestExecutionSegmentScaleOptions(t *testing.T) {
+	seg, err := ParseExecutionSegment("1/2:1")
+	assert.NoError(t, err)
+
+	t.Run("VUs", func(t *testing.T) {
+		opts := seg.scaleOptions(Options{
+			VUs:    null.IntFrom(5),
+			VUsMax: null.IntFrom(11),
+			Stages: []Stage{
+				{Duration: 10 * time.Second, Target: null.IntFrom(20)},
+				{Duration: 10 * time.Second},
+			},
+		})
+		assert.Equal(t, null.IntFrom(3), opts.VUs)
+		assert.Equal(t, null.IntFrom(6), opts.VUsMax)
+		assert.Equal(t, []Stage{
+			{Duration: 10 * time.Second, Target: null.IntFrom(10)},
+			{Duration: 10 * time.Second},
+		}, opts.Stages)
+	})
+	t.Run("Rate", func(t *testing.T) {
+		opts := seg.scaleOptions(Options{Rate: null.IntFrom(9), VUs: null.IntFrom(4)})
+		assert.Equal(t, null.IntFrom(5), opts.Rate)
+		assert.Equal(t, null.IntFrom(2), opts.VUs)
+	})
+	t.Run("Rate Rounded Down To 0", func(t *testing.T) {
+		first, _ := ParseExecutionSegment("0:1/2")
+		opts := first.scaleOptions(Options{
+			Rate:   null.IntFrom(1),
+			VUs:    null.IntFrom(4),
+			Stages: []Stage{{Duration: 10 * time.Second, Target: null.IntFrom(1)}},
+		})
+		assert.Equal(t, null.IntFrom(0), opts.Rate)
+		assert.Equal(t, null.IntFrom(0), opts.VUs)
+		assert.Equal(t, []Stage{{Duration: 10 * time.Second, Target: null.IntFrom(0)}}, opts.Stages)
+	})
+}
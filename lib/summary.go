@@ -0,0 +1,138 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"sort"
+	"sync/atomic"
+
+	"github.com/loadimpact/k6/stats"
+)
+
+// A Summary is a machine-readable version of the end-of-test summary.
+type Summary struct {
+	// How long the test ran for, in milliseconds, like all other durations.
+	Duration float64 `json:"duration"`
+
+	Metrics   map[string]SummaryMetric `json:"metrics"`
+	RootGroup SummaryGroup             `json:"root_group"`
+}
+
+type SummaryMetric struct {
+	Type     stats.MetricType   `json:"type"`
+	Contains stats.ValueType    `json:"contains"`
+	Values   map[string]float64 `json:"values"`
+
+	// Thresholds by source, and whether they passed the last time they were evaluated.
+	Thresholds map[string]bool `json:"thresholds,omitempty"`
+}
+
+type SummaryGroup struct {
+	ID     string         `json:"id"`
+	Path   string         `json:"path"`
+	Name   string         `json:"name"`
+	Groups []SummaryGroup `json:"groups"`
+	Checks []SummaryCheck `json:"checks"`
+}
+
+type SummaryCheck struct {
+	ID     string `json:"id"`
+	Path   string `json:"path"`
+	Name   string `json:"name"`
+	Passes int64  `json:"passes"`
+	Fails  int64  `json:"fails"`
+}
+
+// Summary produces a summary of the test so far; mostly useful once it's over.
+func (e *Engine) Summary() *Summary {
+	summary := &Summary{
+		Duration: stats.D(e.AtTime()),
+		Metrics:  make(map[string]SummaryMetric),
+	}
+	if e.Runner != nil {
+		summary.RootGroup = newSummaryGroup(e.Runner.GetDefaultGroup())
+	}
+
+	e.MetricsLock.Lock()
+	defer e.MetricsLock.Unlock()
+
+	for name, m := range e.Metrics {
+		sm := SummaryMetric{
+			Type:     m.Type,
+			Contains: m.Contains,
+			Values:   m.Sink.Format(),
+		}
+		if len(m.Thresholds.Thresholds) > 0 {
+			sm.Thresholds = make(map[string]bool, len(m.Thresholds.Thresholds))
+			for _, th := range m.Thresholds.Thresholds {
+				sm.Thresholds[th.Source] = !th.LastFailed()
+			}
+		}
+		summary.Metrics[name] = sm
+	}
+	return summary
+}
+
+func newSummaryGroup(g *Group) SummaryGroup {
+	sg := SummaryGroup{
+		ID:     g.ID,
+		Path:   g.Path,
+		Name:   g.Name,
+		Groups: []SummaryGroup{},
+		Checks: []SummaryCheck{},
+	}
+
+	// Groups and checks are kept in maps; sort them by name for a stable output.
+	g.groupMutex.Lock()
+	groupNames := make([]string, 0, len(g.Groups))
+	for name := range g.Groups {
+		groupNames = append(groupNames, name)
+	}
+	sort.Strings(groupNames)
+	groups := make([]*Group, len(groupNames))
+	for i, name := range groupNames {
+		groups[i] = g.Groups[name]
+	}
+	g.groupMutex.Unlock()
+
+	g.checkMutex.Lock()
+	checkNames := make([]string, 0, len(g.Checks))
+	for name := range g.Checks {
+		checkNames = append(checkNames, name)
+	}
+	sort.Strings(checkNames)
+	for _, name := range checkNames {
+		c := g.Checks[name]
+		sg.Checks = append(sg.Checks, SummaryCheck{
+			ID:     c.ID,
+			Path:   c.Path,
+			Name:   c.Name,
+			Passes: atomic.LoadInt64(&c.Passes),
+			Fails:  atomic.LoadInt64(&c.Fails),
+		})
+	}
+	g.checkMutex.Unlock()
+
+	for _, child := range groups {
+		sg.Groups = append(sg.Groups, newSummaryGroup(child))
+	}
+	return sg
+}
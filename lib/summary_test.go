@@ -0,0 +1,102 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+type summaryDummyRunner struct {
+	RunnerFunc
+	Group *Group
+}
+
+func (r summaryDummyRunner) GetDefaultGroup() *Group { return r.Group }
+
+func TestEngineSummary(t *testing.T) {
+	root, err := NewGroup("", nil)
+	assert.NoError(t, err)
+	g, err := root.Group("my group")
+	assert.NoError(t, err)
+	c, err := g.Check("my check")
+	assert.NoError(t, err)
+	c.Passes = 2
+	c.Fails = 1
+
+	ths, err := stats.NewThresholds([]string{"value>1", "value>2"})
+	assert.NoError(t, err)
+
+	e, err, _ := newTestEngine(summaryDummyRunner{Group: root}, Options{
+		Thresholds: map[string]stats.Thresholds{"my_metric": ths},
+	})
+	assert.NoError(t, err)
+
+	metric := stats.New("my_metric", stats.Gauge)
+	e.processSamples(stats.Sample{Metric: metric, Value: 1.5})
+	e.processThresholds()
+
+	summary := e.Summary()
+	assert.Equal(t, SummaryMetric{
+		Type:       stats.Gauge,
+		Contains:   stats.Default,
+		Values:     map[string]float64{"value": 1.5},
+		Thresholds: map[string]bool{"value>1": true, "value>2": false},
+	}, summary.Metrics["my_metric"])
+
+	assert.Equal(t, "", summary.RootGroup.Name)
+	assert.Len(t, summary.RootGroup.Checks, 0)
+	if assert.Len(t, summary.RootGroup.Groups, 1) {
+		sg := summary.RootGroup.Groups[0]
+		assert.Equal(t, g.ID, sg.ID)
+		assert.Equal(t, "my group", sg.Name)
+		assert.Equal(t, []SummaryCheck{{ID: c.ID, Path: c.Path, Name: "my check", Passes: 2, Fails: 1}}, sg.Checks)
+	}
+
+	t.Run("JSON", func(t *testing.T) {
+		data, err := json.Marshal(summary)
+		assert.NoError(t, err)
+
+		var v map[string]interface{}
+		assert.NoError(t, json.Unmarshal(data, &v))
+		assert.Contains(t, v, "duration")
+		assert.Contains(t, v, "metrics")
+		assert.Contains(t, v, "root_group")
+		assert.Equal(t, "gauge", v["metrics"].(map[string]interface{})["my_metric"].(map[string]interface{})["type"])
+	})
+
+	t.Run("no runner", func(t *testing.T) {
+		e, err, _ := newTestEngine(nil, Options{})
+		assert.NoError(t, err)
+		assert.NoError(t, e.Run(cancelledContext()))
+		assert.NotNil(t, e.Summary().Metrics)
+	})
+}
+
+func cancelledContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}
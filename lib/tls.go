@@ -0,0 +1,222 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// TLSVersionNames maps the names accepted in options to TLS versions.
+var TLSVersionNames = map[string]int{
+	"ssl3.0": tls.VersionSSL30,
+	"tls1.0": tls.VersionTLS10,
+	"tls1.1": tls.VersionTLS11,
+	"tls1.2": tls.VersionTLS12,
+}
+
+// TLSCipherSuiteNames maps the names accepted in options to cipher suites.
+var TLSCipherSuiteNames = map[string]uint16{
+	"TLS_RSA_WITH_RC4_128_SHA":                tls.TLS_RSA_WITH_RC4_128_SHA,
+	"TLS_RSA_WITH_3DES_EDE_CBC_SHA":           tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA,
+	"TLS_RSA_WITH_AES_128_CBC_SHA":            tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+	"TLS_RSA_WITH_AES_256_CBC_SHA":            tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+	"TLS_RSA_WITH_AES_128_CBC_SHA256":         tls.TLS_RSA_WITH_AES_128_CBC_SHA256,
+	"TLS_RSA_WITH_AES_128_GCM_SHA256":         tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+	"TLS_RSA_WITH_AES_256_GCM_SHA384":         tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_ECDSA_WITH_RC4_128_SHA":        tls.TLS_ECDHE_ECDSA_WITH_RC4_128_SHA,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA":    tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA":    tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_RC4_128_SHA":          tls.TLS_ECDHE_RSA_WITH_RC4_128_SHA,
+	"TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA":     tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA":      tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA":      tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256": tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256,
+	"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256":   tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256,
+	"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256":   tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256": tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384":   tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384": tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305":    tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+	"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305":  tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+}
+
+// TLSVersions is a range of allowed TLS versions; zero means no limit. It's given in options
+// either as a single version ("tls1.2") or as a range ({"min": "tls1.1", "max": "tls1.2"}).
+type TLSVersions struct {
+	Min int
+	Max int
+}
+
+func (v TLSVersions) MarshalJSON() ([]byte, error) {
+	var obj struct {
+		Min string `json:"min,omitempty"`
+		Max string `json:"max,omitempty"`
+	}
+	for name, ver := range TLSVersionNames {
+		if ver == v.Min {
+			obj.Min = name
+		}
+		if ver == v.Max {
+			obj.Max = name
+		}
+	}
+	return json.Marshal(obj)
+}
+
+func (v *TLSVersions) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		ver, ok := TLSVersionNames[str]
+		if !ok {
+			return errors.Errorf("unknown TLS version: %s", str)
+		}
+		v.Min, v.Max = ver, ver
+		return nil
+	}
+
+	var obj struct {
+		Min string `json:"min"`
+		Max string `json:"max"`
+	}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	*v = TLSVersions{}
+	if obj.Min != "" {
+		ver, ok := TLSVersionNames[obj.Min]
+		if !ok {
+			return errors.Errorf("unknown TLS version: %s", obj.Min)
+		}
+		v.Min = ver
+	}
+	if obj.Max != "" {
+		ver, ok := TLSVersionNames[obj.Max]
+		if !ok {
+			return errors.Errorf("unknown TLS version: %s", obj.Max)
+		}
+		v.Max = ver
+	}
+	if v.Min != 0 && v.Max != 0 && v.Min > v.Max {
+		return errors.Errorf("TLS version %s is higher than %s", obj.Min, obj.Max)
+	}
+	return nil
+}
+
+// TLSCipherSuites is a list of allowed cipher suites, given by name in options.
+type TLSCipherSuites []uint16
+
+func (s TLSCipherSuites) MarshalJSON() ([]byte, error) {
+	if s == nil {
+		return []byte("null"), nil
+	}
+	names := make([]string, len(s))
+	for i, suite := range s {
+		for name, v := range TLSCipherSuiteNames {
+			if v == suite {
+				names[i] = name
+				break
+			}
+		}
+	}
+	return json.Marshal(names)
+}
+
+func (s *TLSCipherSuites) UnmarshalJSON(data []byte) error {
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return err
+	}
+
+	suites := make(TLSCipherSuites, len(names))
+	for i, name := range names {
+		suite, ok := TLSCipherSuiteNames[name]
+		if !ok {
+			return errors.Errorf("unknown cipher suite: %s", name)
+		}
+		suites[i] = suite
+	}
+	*s = suites
+	return nil
+}
+
+// TLSAuth is a client certificate, used for connections to the given domains. Domains may be
+// given as "example.com", which only matches that host, or "*.example.com", which matches any
+// subdomain of it. The certificate and key are PEM-encoded, eg. from open().
+type TLSAuth struct {
+	Domains []string `json:"domains"`
+	Cert    string   `json:"cert"`
+	Key     string   `json:"key"`
+
+	certificate *tls.Certificate
+	certErr     error
+	certOnce    sync.Once
+}
+
+// Certificate parses the certificate and key; this is only done once.
+func (a *TLSAuth) Certificate() (*tls.Certificate, error) {
+	a.certOnce.Do(func() {
+		cert, err := tls.X509KeyPair([]byte(a.Cert), []byte(a.Key))
+		if err != nil {
+			a.certErr = errors.Wrapf(err, "tlsAuth for %s", strings.Join(a.Domains, ", "))
+			return
+		}
+		a.certificate = &cert
+	})
+	return a.certificate, a.certErr
+}
+
+// Matches returns whether the certificate should be used for a host.
+func (a *TLSAuth) Matches(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, domain := range a.Domains {
+		domain = strings.ToLower(domain)
+		if strings.HasPrefix(domain, "*.") {
+			if strings.HasSuffix(host, domain[1:]) {
+				return true
+			}
+			continue
+		}
+		if host == domain {
+			return true
+		}
+	}
+	return false
+}
+
+// TLSConfig builds a client TLS config from the options, without any client certificates.
+func (o Options) TLSConfig() *tls.Config {
+	config := &tls.Config{
+		InsecureSkipVerify: o.InsecureSkipTLSVerify.Bool,
+	}
+	if o.TLSVersion != nil {
+		config.MinVersion = uint16(o.TLSVersion.Min)
+		config.MaxVersion = uint16(o.TLSVersion.Max)
+	}
+	if o.TLSCipherSuites != nil {
+		config.CipherSuites = []uint16(o.TLSCipherSuites)
+	}
+	return config
+}
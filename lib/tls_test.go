@@ -0,0 +1,106 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestTLSVersionsUnmarshalJSON(t *testing.T) {
+	testdata := map[string]TLSVersions{
+		`"tls1.2"`:                           {Min: tls.VersionTLS12, Max: tls.VersionTLS12},
+		`{"min": "tls1.0", "max": "tls1.2"}`: {Min: tls.VersionTLS10, Max: tls.VersionTLS12},
+		`{"min": "tls1.1"}`:                  {Min: tls.VersionTLS11},
+		`{}`:                                 {},
+	}
+	for data, expected := range testdata {
+		t.Run(data, func(t *testing.T) {
+			var v TLSVersions
+			assert.NoError(t, json.Unmarshal([]byte(data), &v))
+			assert.Equal(t, expected, v)
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		var v TLSVersions
+		assert.EqualError(t, json.Unmarshal([]byte(`"tls9000"`), &v), "unknown TLS version: tls9000")
+		assert.EqualError(t, json.Unmarshal([]byte(`{"max": "ssl2"}`), &v), "unknown TLS version: ssl2")
+		assert.EqualError(t, json.Unmarshal([]byte(`{"min": "tls1.2", "max": "tls1.0"}`), &v), "TLS version tls1.2 is higher than tls1.0")
+	})
+}
+
+func TestTLSCipherSuitesUnmarshalJSON(t *testing.T) {
+	var s TLSCipherSuites
+	assert.NoError(t, json.Unmarshal([]byte(`["TLS_RSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"]`), &s))
+	assert.Equal(t, TLSCipherSuites{tls.TLS_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}, s)
+
+	t.Run("invalid", func(t *testing.T) {
+		assert.EqualError(t, json.Unmarshal([]byte(`["TLS_NOPE"]`), &s), "unknown cipher suite: TLS_NOPE")
+	})
+}
+
+func TestTLSAuthMatches(t *testing.T) {
+	auth := &TLSAuth{Domains: []string{"example.com", "*.example.org"}}
+	testdata := map[string]bool{
+		"example.com":      true,
+		"EXAMPLE.com.":     true,
+		"www.example.com":  false,
+		"example.org":      false,
+		"www.example.org":  true,
+		"a.b.example.org":  true,
+		"badexample.org":   false,
+		"example.com.evil": false,
+	}
+	for host, matches := range testdata {
+		t.Run(host, func(t *testing.T) {
+			assert.Equal(t, matches, auth.Matches(host))
+		})
+	}
+}
+
+func TestTLSAuthCertificate(t *testing.T) {
+	auth := &TLSAuth{Domains: []string{"example.com"}, Cert: "nope", Key: "nope"}
+	_, err := auth.Certificate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "tlsAuth for example.com")
+}
+
+func TestOptionsTLSConfig(t *testing.T) {
+	config := Options{}.TLSConfig()
+	assert.False(t, config.InsecureSkipVerify)
+	assert.Equal(t, uint16(0), config.MinVersion)
+	assert.Nil(t, config.CipherSuites)
+
+	config = Options{
+		InsecureSkipTLSVerify: null.BoolFrom(true),
+		TLSVersion:            &TLSVersions{Min: tls.VersionTLS11, Max: tls.VersionTLS12},
+		TLSCipherSuites:       TLSCipherSuites{tls.TLS_RSA_WITH_AES_128_GCM_SHA256},
+	}.TLSConfig()
+	assert.True(t, config.InsecureSkipVerify)
+	assert.Equal(t, uint16(tls.VersionTLS11), config.MinVersion)
+	assert.Equal(t, uint16(tls.VersionTLS12), config.MaxVersion)
+	assert.Equal(t, []uint16{tls.TLS_RSA_WITH_AES_128_GCM_SHA256}, config.CipherSuites)
+}
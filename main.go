@@ -44,6 +44,10 @@ func main() {
 	app.Commands = []cli.Command{
 		commandRun,
 		commandInspect,
+		commandArchive,
+		commandConvert,
+		commandCoordinator,
+		commandAgent,
 		commandStatus,
 		commandStats,
 		commandScale,
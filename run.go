@@ -21,7 +21,9 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	stdjson "encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -47,8 +49,12 @@ import (
 	"github.com/loadimpact/k6/loader"
 	"github.com/loadimpact/k6/simple"
 	"github.com/loadimpact/k6/stats"
+	"github.com/loadimpact/k6/stats/csv"
 	"github.com/loadimpact/k6/stats/influxdb"
 	"github.com/loadimpact/k6/stats/json"
+	"github.com/loadimpact/k6/stats/kafka"
+	"github.com/loadimpact/k6/stats/prometheus"
+	"github.com/loadimpact/k6/stats/statsd"
 	"github.com/loadimpact/k6/ui"
 	"github.com/spf13/afero"
 	"gopkg.in/guregu/null.v3"
@@ -56,84 +62,137 @@ import (
 )
 
 const (
-	TypeAuto = "auto"
-	TypeURL  = "url"
-	TypeJS   = "js"
+	TypeAuto    = "auto"
+	TypeURL     = "url"
+	TypeJS      = "js"
+	TypeArchive = "archive"
 )
 
 var urlRegex = regexp.MustCompile(`(?i)^https?://`)
 
+// Flags for options shared between commands that load a script.
+var optionFlags = []cli.Flag{
+	cli.Int64Flag{
+		Name:  "vus, u",
+		Usage: "virtual users to simulate",
+		Value: 1,
+	},
+	cli.Int64Flag{
+		Name:  "max, m",
+		Usage: "max number of virtual users, if more than --vus",
+	},
+	cli.DurationFlag{
+		Name:  "duration, d",
+		Usage: "test duration, 0 to run until cancelled",
+	},
+	cli.Int64Flag{
+		Name:  "iterations, i",
+		Usage: "run a set number of iterations, multiplied by VU count",
+	},
+	cli.DurationFlag{
+		Name:  "graceful-stop",
+		Usage: "let running iterations finish for this long when the test or a VU stops",
+	},
+	cli.Int64Flag{
+		Name:  "rate, r",
+		Usage: "start iterations at a fixed rate per second, instead of looping VUs",
+	},
+	cli.StringSliceFlag{
+		Name:  "stage, s",
+		Usage: "define a test stage, in the format time[:vus] (10s:100)",
+	},
+	cli.StringFlag{
+		Name:  "execution-segment",
+		Usage: "run only this part of the test, eg. 1/2:1 for the second half of its VUs",
+	},
+	cli.BoolFlag{
+		Name:  "paused, p",
+		Usage: "start test in a paused state",
+	},
+	cli.BoolFlag{
+		Name:  "linger, l",
+		Usage: "linger after test completion",
+	},
+	cli.Int64Flag{
+		Name:  "max-redirects",
+		Usage: "follow at most n redirects",
+		Value: 10,
+	},
+	cli.BoolFlag{
+		Name:  "insecure-skip-tls-verify",
+		Usage: "INSECURE: skip verification of TLS certificates",
+	},
+	cli.BoolFlag{
+		Name:  "no-connection-reuse",
+		Usage: "don't keep connections alive at all",
+	},
+	cli.BoolFlag{
+		Name:  "no-vu-connection-reuse",
+		Usage: "don't reuse connections between VU iterations",
+	},
+	cli.StringFlag{
+		Name:  "dns-ttl",
+		Usage: "cache DNS lookups for this long, 0 to disable caching, inf to cache forever",
+	},
+	cli.StringFlag{
+		Name:  "dns-select",
+		Usage: "which of a name's IPs to connect to: first, random or roundRobin",
+	},
+	cli.Int64Flag{
+		Name:  "batch",
+		Usage: "max parallel requests in an http.batch() call, 0 for no limit",
+	},
+	cli.Int64Flag{
+		Name:  "batch-per-host",
+		Usage: "max parallel requests to any one host in an http.batch() call, 0 for no limit",
+	},
+	cli.StringSliceFlag{
+		Name:  "env, e",
+		Usage: "add an environment variable for the script's __ENV, in the format KEY=VALUE",
+	},
+	cli.StringSliceFlag{
+		Name:  "tag",
+		Usage: "add a tag to every sample the test emits, in the format name=value",
+	},
+	cli.StringFlag{
+		Name:  "system-tags",
+		Usage: "comma-separated list of system tags to keep on samples, eg. \"status,method\"",
+	},
+	cli.StringSliceFlag{
+		Name:  "config, c",
+		Usage: "read additional config files",
+	},
+	cli.BoolFlag{
+		Name:   "no-usage-report",
+		Usage:  "don't send heartbeat to k6 project on test execution",
+		EnvVar: "K6_NO_USAGE_REPORT",
+	},
+}
+
 var commandRun = cli.Command{
 	Name:      "run",
 	Usage:     "Starts running a load test",
 	ArgsUsage: "url|filename",
-	Flags: []cli.Flag{
+	Flags: append([]cli.Flag{
 		cli.BoolFlag{
 			Name:  "quiet, q",
 			Usage: "hide the progress bar",
 		},
-		cli.Int64Flag{
-			Name:  "vus, u",
-			Usage: "virtual users to simulate",
-			Value: 1,
-		},
-		cli.Int64Flag{
-			Name:  "max, m",
-			Usage: "max number of virtual users, if more than --vus",
-		},
-		cli.DurationFlag{
-			Name:  "duration, d",
-			Usage: "test duration, 0 to run until cancelled",
-		},
-		cli.Int64Flag{
-			Name:  "iterations, i",
-			Usage: "run a set number of iterations, multiplied by VU count",
-		},
-		cli.StringSliceFlag{
-			Name:  "stage, s",
-			Usage: "define a test stage, in the format time[:vus] (10s:100)",
-		},
-		cli.BoolFlag{
-			Name:  "paused, p",
-			Usage: "start test in a paused state",
-		},
 		cli.StringFlag{
 			Name:  "type, t",
-			Usage: "input type, one of: auto, url, js",
+			Usage: "input type, one of: auto, url, js, archive",
 			Value: "auto",
 		},
-		cli.BoolFlag{
-			Name:  "linger, l",
-			Usage: "linger after test completion",
-		},
-		cli.Int64Flag{
-			Name:  "max-redirects",
-			Usage: "follow at most n redirects",
-			Value: 10,
-		},
-		cli.BoolFlag{
-			Name:  "insecure-skip-tls-verify",
-			Usage: "INSECURE: skip verification of TLS certificates",
-		},
-		cli.BoolFlag{
-			Name:  "no-connection-reuse",
-			Usage: "don't reuse connections between VU iterations",
-		},
 		cli.StringFlag{
 			Name:   "out, o",
 			Usage:  "output metrics to an external data store (format: type=uri)",
 			EnvVar: "K6_OUT",
 		},
-		cli.StringSliceFlag{
-			Name:  "config, c",
-			Usage: "read additional config files",
-		},
-		cli.BoolFlag{
-			Name:   "no-usage-report",
-			Usage:  "don't send heartbeat to k6 project on test execution",
-			EnvVar: "K6_NO_USAGE_REPORT",
+		cli.StringFlag{
+			Name:  "summary-export",
+			Usage: "write the end-of-test summary to a file, as JSON",
 		},
-	},
+	}, optionFlags...),
 	Action: actionRun,
 	Description: `Run starts a load test.
 
@@ -157,9 +216,13 @@ var commandInspect = cli.Command{
 	Flags: []cli.Flag{
 		cli.StringFlag{
 			Name:  "type, t",
-			Usage: "input type, one of: auto, url, js",
+			Usage: "input type, one of: auto, url, js, archive",
 			Value: "auto",
 		},
+		cli.StringSliceFlag{
+			Name:  "env, e",
+			Usage: "add an environment variable for the script's __ENV, in the format KEY=VALUE",
+		},
 		cli.StringSliceFlag{
 			Name:  "config, c",
 			Usage: "read additional config files",
@@ -172,6 +235,9 @@ func guessType(data []byte) string {
 	if urlRegex.Match(data) {
 		return TypeURL
 	}
+	if lib.IsArchive(data) {
+		return TypeArchive
+	}
 	return TypeJS
 }
 
@@ -199,10 +265,12 @@ func getSrcData(filename, pwd string, stdin io.Reader, fs afero.Fs) (*lib.Source
 	return loader.Load(fs, pwd, filename)
 }
 
-func makeRunner(runnerType string, src *lib.SourceData, fs afero.Fs) (lib.Runner, error) {
+// Makes a runner; scripts see the process' environment variables, overridden by the ones an
+// archive was made with, overridden in turn by env.
+func makeRunner(runnerType string, src *lib.SourceData, fs afero.Fs, env map[string]string) (lib.Runner, error) {
 	switch runnerType {
 	case TypeAuto:
-		return makeRunner(guessType(src.Data), src, fs)
+		return makeRunner(guessType(src.Data), src, fs, env)
 	case TypeURL:
 		u, err := url.Parse(strings.TrimSpace(string(src.Data)))
 		if err != nil || u.Scheme == "" {
@@ -214,7 +282,14 @@ func makeRunner(runnerType string, src *lib.SourceData, fs afero.Fs) (lib.Runner
 		}
 		return r, err
 	case TypeJS:
-		return js.New(src, fs)
+		return js.New(src, fs, mergeEnv(systemEnv(), env))
+	case TypeArchive:
+		arc, err := lib.ReadArchive(bytes.NewReader(src.Data))
+		if err != nil {
+			return nil, err
+		}
+		arc.Env = mergeEnv(systemEnv(), arc.Env, env)
+		return js.NewFromArchive(arc)
 	default:
 		return nil, errors.New("Invalid type specified, see --help")
 	}
@@ -231,10 +306,20 @@ func splitCollectorString(s string) (string, string) {
 func makeCollector(s string, src *lib.SourceData, opts lib.Options) (lib.Collector, error) {
 	t, p := splitCollectorString(s)
 	switch t {
+	case "csv":
+		return csv.New(p, afero.NewOsFs(), opts)
 	case "influxdb":
 		return influxdb.New(p, opts)
 	case "json":
 		return json.New(p, afero.NewOsFs(), opts)
+	case "kafka":
+		return kafka.New(p, opts)
+	case "prometheus":
+		return prometheus.New(p, opts)
+	case "statsd":
+		return statsd.New(p, opts)
+	case "datadog":
+		return statsd.NewDatadog(p, opts)
 	default:
 		return nil, errors.New("Unknown output type: " + t)
 	}
@@ -257,25 +342,10 @@ func actionRun(cc *cli.Context) error {
 	addr := cc.GlobalString("address")
 	out := cc.String("out")
 	quiet := cc.Bool("quiet")
-	cliOpts := lib.Options{
-		Paused:                cliBool(cc, "paused"),
-		VUs:                   cliInt64(cc, "vus"),
-		VUsMax:                cliInt64(cc, "max"),
-		Duration:              cliDuration(cc, "duration"),
-		Iterations:            cliInt64(cc, "iterations"),
-		Linger:                cliBool(cc, "linger"),
-		MaxRedirects:          cliInt64(cc, "max-redirects"),
-		InsecureSkipTLSVerify: cliBool(cc, "insecure-skip-tls-verify"),
-		NoConnectionReuse:     cliBool(cc, "no-connection-reuse"),
-		NoUsageReport:         cliBool(cc, "no-usage-report"),
-	}
-	for _, s := range cc.StringSlice("stage") {
-		stage, err := ParseStage(s)
-		if err != nil {
-			log.WithError(err).Error("Invalid stage specified")
-			return err
-		}
-		cliOpts.Stages = append(cliOpts.Stages, stage)
+	cliOpts, err := getOptions(cc)
+	if err != nil {
+		log.WithError(err).Error("Invalid option specified")
+		return err
 	}
 	opts := cliOpts
 
@@ -291,7 +361,12 @@ func actionRun(cc *cli.Context) error {
 	if runnerType == TypeAuto {
 		runnerType = guessType(src.Data)
 	}
-	runner, err := makeRunner(runnerType, src, fs)
+	env, err := getEnv(cc)
+	if err != nil {
+		log.WithError(err).Error("Invalid environment variable specified")
+		return err
+	}
+	runner, err := makeRunner(runnerType, src, fs, env)
 	if err != nil {
 		if errstr, ok := err.(fmt.Stringer); ok {
 			log.Error(errstr.String())
@@ -303,41 +378,17 @@ func actionRun(cc *cli.Context) error {
 	opts = opts.Apply(runner.GetOptions())
 
 	// Read config files.
-	for _, filename := range cc.StringSlice("config") {
-		data, err := afero.ReadFile(fs, filename)
-		if err != nil {
-			return cli.NewExitError(err.Error(), 1)
-		}
-
-		var configOpts lib.Options
-		if err := yaml.Unmarshal(data, &configOpts); err != nil {
-			return cli.NewExitError(err.Error(), 1)
-		}
-		opts = opts.Apply(configOpts)
+	configOpts, err := readConfigFiles(fs, cc.StringSlice("config"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
 	}
+	opts = opts.Apply(configOpts)
 
 	// CLI options override everything.
 	opts = opts.Apply(cliOpts)
 
-	// Default to 1 iteration if duration and stages are unspecified.
-	if !opts.Duration.Valid && !opts.Iterations.Valid && len(opts.Stages) == 0 {
-		opts.Iterations = null.IntFrom(1)
-	}
-
 	// Apply defaults.
-	opts = opts.SetAllValid(true)
-
-	// Make sure VUsMax defaults to VUs if not specified.
-	if opts.VUsMax.Int64 == 0 {
-		opts.VUsMax.Int64 = opts.VUs.Int64
-		if len(opts.Stages) > 0 {
-			for _, stage := range opts.Stages {
-				if stage.Target.Valid && stage.Target.Int64 > opts.VUsMax.Int64 {
-					opts.VUsMax = stage.Target
-				}
-			}
-		}
-	}
+	opts = applyDefaults(opts)
 
 	// Update the runner's options.
 	runner.ApplyOptions(opts)
@@ -375,6 +426,17 @@ func actionRun(cc *cli.Context) error {
 	fmt.Fprintf(color.Output, "\n")
 	fmt.Fprintf(color.Output, "   duration: %s, iterations: %s\n", color.CyanString(opts.Duration.String), color.CyanString("%d", opts.Iterations.Int64))
 	fmt.Fprintf(color.Output, "        vus: %s, max: %s\n", color.CyanString("%d", opts.VUs.Int64), color.CyanString("%d", opts.VUsMax.Int64))
+	if opts.Rate.Int64 > 0 {
+		fmt.Fprintf(color.Output, "       rate: %s\n", color.CyanString("%d iterations/s", opts.Rate.Int64))
+	}
+	if len(opts.Scenarios) > 0 {
+		names := make([]string, 0, len(opts.Scenarios))
+		for name := range opts.Scenarios {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(color.Output, "  scenarios: %s\n", color.CyanString(strings.Join(names, ", ")))
+	}
 	fmt.Fprintf(color.Output, "\n")
 	fmt.Fprintf(color.Output, "    web ui: %s\n", color.CyanString("http://%s/", addr))
 	fmt.Fprintf(color.Output, "\n")
@@ -483,9 +545,20 @@ loop:
 		}
 	}
 
-	// Shut down the API server and engine.
+	// Shut down the API server and engine. Running iterations may get a grace period to finish
+	// in, and teardown still has to run; a second signal gives up on waiting for them.
 	cancel()
+	stopped := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-signals:
+			log.WithField("signal", sig).Error("Signal received; aborting without waiting for iterations or teardown")
+			os.Exit(1)
+		case <-stopped:
+		}
+	}()
 	wg.Wait()
+	close(stopped)
 
 	// Test done, leave that status as the final progress bar!
 	atTime := engine.AtTime()
@@ -505,60 +578,83 @@ loop:
 	}
 	fmt.Fprintf(color.Output, "\n")
 
-	// Print groups.
-	var printGroup func(g *lib.Group, level int)
-	printGroup = func(g *lib.Group, level int) {
-		indent := strings.Repeat("  ", level)
+	printGroup(engine.Runner.GetDefaultGroup(), 1)
+	printMetrics(engine.Metrics, atTime)
+
+	if err := handleSummary(engine, cc.String("summary-export")); err != nil {
+		log.WithError(err).Error("Couldn't write the summary")
+	}
 
+	if opts.Linger.Bool {
+		<-signals
+	}
+
+	if engine.IsTainted() {
+		return cli.NewExitError("", 99)
+	}
+	return nil
+}
+
+// Prints a group's checks, then its subgroups', indented by level.
+func printGroup(g *lib.Group, level int) {
+	indent := strings.Repeat("  ", level)
+
+	if g.Name != "" && g.Parent != nil {
+		fmt.Fprintf(color.Output, "%s█ %s\n", indent, g.Name)
+	}
+
+	if len(g.Checks) > 0 {
 		if g.Name != "" && g.Parent != nil {
-			fmt.Fprintf(color.Output, "%s█ %s\n", indent, g.Name)
+			fmt.Fprintf(color.Output, "\n")
 		}
-
-		if len(g.Checks) > 0 {
-			if g.Name != "" && g.Parent != nil {
-				fmt.Fprintf(color.Output, "\n")
-			}
-			for _, check := range g.Checks {
-				icon := "✓"
-				statusColor := color.GreenString
-				if check.Fails > 0 {
-					icon = "✗"
-					statusColor = color.RedString
-				}
-				fmt.Fprint(color.Output, statusColor("%s  %s %2.2f%% - %s\n",
-					indent,
-					icon,
-					100*(float64(check.Passes)/float64(check.Passes+check.Fails)),
-					check.Name,
-				))
+		for _, check := range g.Checks {
+			icon := "✓"
+			statusColor := color.GreenString
+			if check.Fails > 0 {
+				icon = "✗"
+				statusColor = color.RedString
 			}
+			fmt.Fprint(color.Output, statusColor("%s  %s %2.2f%% - %s\n",
+				indent,
+				icon,
+				100*(float64(check.Passes)/float64(check.Passes+check.Fails)),
+				check.Name,
+			))
+		}
+		fmt.Fprintf(color.Output, "\n")
+	}
+	if len(g.Groups) > 0 {
+		if g.Name != "" && g.Parent != nil && len(g.Checks) > 0 {
 			fmt.Fprintf(color.Output, "\n")
 		}
-		if len(g.Groups) > 0 {
-			if g.Name != "" && g.Parent != nil && len(g.Checks) > 0 {
-				fmt.Fprintf(color.Output, "\n")
-			}
-			for _, g := range g.Groups {
-				printGroup(g, level+1)
-			}
+		for _, g := range g.Groups {
+			printGroup(g, level+1)
 		}
 	}
+}
 
-	printGroup(engine.Runner.GetDefaultGroup(), 1)
-
-	// Sort and print metrics.
-	metricNames := make([]string, 0, len(engine.Metrics))
+// Prints the end-of-test summary of each metric; submetrics go under their parents, eg. the one
+// for "http_req_duration{status:200}" is shown as "{ status:200 }" under "http_req_duration".
+func printMetrics(metrics map[string]*stats.Metric, atTime time.Duration) {
+	metricNames := make([]string, 0, len(metrics))
+	submetricNames := make(map[string][]string)
 	metricNameWidth := 0
-	for _, m := range engine.Metrics {
-		metricNames = append(metricNames, m.Name)
-		if l := len(m.Name); l > metricNameWidth {
+	for _, m := range metrics {
+		l := len(m.Name)
+		if i := strings.Index(m.Name, "{"); i != -1 {
+			parent := m.Name[:i]
+			submetricNames[parent] = append(submetricNames[parent], m.Name)
+			l = len(submetricDisplayName(m.Name))
+		} else {
+			metricNames = append(metricNames, m.Name)
+		}
+		if l > metricNameWidth {
 			metricNameWidth = l
 		}
 	}
 	sort.Strings(metricNames)
 
-	for _, name := range metricNames {
-		m := engine.Metrics[name]
+	printMetric := func(m *stats.Metric, displayName string) {
 		sample := m.Sink.Format()
 
 		keys := make([]string, 0, len(sample))
@@ -569,7 +665,7 @@ loop:
 		var val string
 		switch len(keys) {
 		case 0:
-			continue
+			return
 		case 1:
 			for _, k := range keys {
 				val = color.CyanString(m.HumanizeValue(sample[k]))
@@ -586,7 +682,7 @@ loop:
 			val = strings.Join(parts, " ")
 		}
 		if val == "0" {
-			continue
+			return
 		}
 
 		icon := " "
@@ -598,25 +694,75 @@ loop:
 			}
 		}
 
-		namePadding := strings.Repeat(".", metricNameWidth-len(name)+3)
+		namePadding := strings.Repeat(".", metricNameWidth-len(displayName)+3)
 		fmt.Fprintf(color.Output, "  %s %s%s %s\n",
 			icon,
-			name,
+			displayName,
 			color.New(color.Faint).Sprint(namePadding+":"),
 			val,
 		)
 	}
 
-	if opts.Linger.Bool {
-		<-signals
+	for _, name := range metricNames {
+		printMetric(metrics[name], name)
+
+		subnames := submetricNames[name]
+		sort.Strings(subnames)
+		for _, subname := range subnames {
+			printMetric(metrics[subname], submetricDisplayName(subname))
+		}
 	}
+}
 
-	if engine.IsTainted() {
-		return cli.NewExitError("", 99)
+// Writes the summary to exportPath, if given, and any reports the runner makes out of it.
+func handleSummary(engine *lib.Engine, exportPath string) error {
+	summary := engine.Summary()
+	if exportPath != "" {
+		data, err := stdjson.MarshalIndent(summary, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(exportPath, data, 0644); err != nil {
+			return err
+		}
+	}
+
+	handler, ok := engine.Runner.(lib.SummaryHandler)
+	if !ok {
+		return nil
+	}
+	reports, err := handler.HandleSummary(context.Background(), summary)
+	if err != nil {
+		return err
+	}
+	paths := make([]string, 0, len(reports))
+	for path := range reports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		var err error
+		switch path {
+		case "stdout":
+			_, err = os.Stdout.Write(reports[path])
+		case "stderr":
+			_, err = os.Stderr.Write(reports[path])
+		default:
+			err = ioutil.WriteFile(path, reports[path], 0644)
+		}
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// Returns the name a submetric is listed under, below its parent, in the end-of-test summary.
+func submetricDisplayName(name string) string {
+	i := strings.Index(name, "{")
+	return "  { " + strings.TrimSuffix(name[i+1:], "}") + " }"
+}
+
 func actionInspect(cc *cli.Context) error {
 	args := cc.Args()
 	if len(args) != 1 {
@@ -643,25 +789,139 @@ func actionInspect(cc *cli.Context) error {
 
 	switch runnerType {
 	case TypeJS:
-		r, err := js.NewBundle(src, fs)
+		env, err := getEnv(cc)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		r, err := js.NewBundle(src, fs, mergeEnv(systemEnv(), env))
 		if err != nil {
 			return cli.NewExitError(err.Error(), 1)
 		}
 		opts = opts.Apply(r.Options)
+	case TypeArchive:
+		arc, err := lib.ReadArchive(bytes.NewReader(src.Data))
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		opts = opts.Apply(arc.Options)
 	}
 
-	for _, filename := range cc.StringSlice("config") {
+	configOpts, err := readConfigFiles(fs, cc.StringSlice("config"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	opts = opts.Apply(configOpts)
+
+	return dumpYAML(opts)
+}
+
+// Returns the options given as flags; see optionFlags.
+func getOptions(cc *cli.Context) (lib.Options, error) {
+	opts := lib.Options{
+		Paused:                cliBool(cc, "paused"),
+		VUs:                   cliInt64(cc, "vus"),
+		VUsMax:                cliInt64(cc, "max"),
+		Duration:              cliDuration(cc, "duration"),
+		Iterations:            cliInt64(cc, "iterations"),
+		GracefulStop:          cliDuration(cc, "graceful-stop"),
+		Rate:                  cliInt64(cc, "rate"),
+		Linger:                cliBool(cc, "linger"),
+		MaxRedirects:          cliInt64(cc, "max-redirects"),
+		InsecureSkipTLSVerify: cliBool(cc, "insecure-skip-tls-verify"),
+		NoConnectionReuse:     cliBool(cc, "no-connection-reuse"),
+		NoVUConnectionReuse:   cliBool(cc, "no-vu-connection-reuse"),
+		Batch:                 cliInt64(cc, "batch"),
+		BatchPerHost:          cliInt64(cc, "batch-per-host"),
+		NoUsageReport:         cliBool(cc, "no-usage-report"),
+	}
+	if ttl := cc.String("dns-ttl"); ttl != "" {
+		if _, err := lib.ParseDNSTTL(ttl); err != nil {
+			return opts, err
+		}
+		opts.DNS.TTL = null.StringFrom(ttl)
+	}
+	if sel := cc.String("dns-select"); sel != "" {
+		if err := lib.ValidateDNSSelect(sel); err != nil {
+			return opts, err
+		}
+		opts.DNS.Select = null.StringFrom(sel)
+	}
+	if tags := cc.StringSlice("tag"); len(tags) > 0 {
+		kv, err := parseKeyValues(tags)
+		if err != nil {
+			return opts, err
+		}
+		opts.Tags = kv
+	}
+	if cc.IsSet("system-tags") {
+		opts.SystemTags = []string{}
+		for _, name := range strings.Split(cc.String("system-tags"), ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				opts.SystemTags = append(opts.SystemTags, name)
+			}
+		}
+	}
+	if s := cc.String("execution-segment"); s != "" {
+		seg, err := lib.ParseExecutionSegment(s)
+		if err != nil {
+			return opts, err
+		}
+		opts.ExecutionSegment = seg
+	}
+	for _, s := range cc.StringSlice("stage") {
+		stage, err := ParseStage(s)
+		if err != nil {
+			return opts, err
+		}
+		opts.Stages = append(opts.Stages, stage)
+	}
+	return opts, nil
+}
+
+// Fills in defaults for anything the options leave unset.
+func applyDefaults(opts lib.Options) lib.Options {
+	// Default to 1 iteration if duration and stages are unspecified.
+	if !opts.Duration.Valid && !opts.Iterations.Valid && len(opts.Stages) == 0 && len(opts.Scenarios) == 0 {
+		opts.Iterations = null.IntFrom(1)
+	}
+
+	opts = opts.SetAllValid(true)
+
+	// Make sure VUsMax defaults to VUs if not specified.
+	if opts.VUsMax.Int64 == 0 {
+		opts.VUsMax.Int64 = opts.VUs.Int64
+
+		// In arrival-rate mode, stage targets are rates rather than VU counts.
+		if len(opts.Stages) > 0 && opts.Rate.Int64 <= 0 {
+			for _, stage := range opts.Stages {
+				if stage.Target.Valid && stage.Target.Int64 > opts.VUsMax.Int64 {
+					opts.VUsMax = stage.Target
+				}
+			}
+		}
+	}
+	return opts
+}
+
+// Returns the environment variables given as flags.
+func getEnv(cc *cli.Context) (map[string]string, error) {
+	return parseKeyValues(cc.StringSlice("env"))
+}
+
+// Reads and merges config files, later ones taking precedence.
+func readConfigFiles(fs afero.Fs, filenames []string) (lib.Options, error) {
+	var opts lib.Options
+	for _, filename := range filenames {
 		data, err := afero.ReadFile(fs, filename)
 		if err != nil {
-			return cli.NewExitError(err.Error(), 1)
+			return opts, err
 		}
 
 		var configOpts lib.Options
 		if err := yaml.Unmarshal(data, &configOpts); err != nil {
-			return cli.NewExitError(err.Error(), 1)
+			return opts, err
 		}
 		opts = opts.Apply(configOpts)
 	}
-
-	return dumpYAML(opts)
+	return opts, nil
 }
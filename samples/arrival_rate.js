@@ -0,0 +1,33 @@
+import http from "k6/http";
+import { check } from "k6";
+
+/*
+ * Setting a rate switches to arrival-rate execution: iterations are started
+ * at a fixed rate per second, no matter how long each of them takes. VUs no
+ * longer loop on their own, they pick up iterations as they're scheduled.
+ *
+ * If every VU is busy when an iteration is due, it's dropped and counted in
+ * the dropped_iterations metric; allocate enough VUs to keep that at zero.
+ *
+ * In this mode, stage targets are rates rather than VU counts.
+ */
+
+export let options = {
+    vus: 50,
+    rate: 10,
+    stages: [
+        // Ramp up from 10 to 100 iterations/s over 30s
+        { duration: "30s", target: 100 },
+
+        // Hold at 100 iterations/s for a minute
+        { duration: "1m" }
+    ],
+    thresholds: {
+        "dropped_iterations": ["count==0"]
+    }
+};
+
+export default function() {
+    let res = http.get("http://httpbin.org/");
+    check(res, { "status is 200": (r) => r.status === 200 });
+}
@@ -0,0 +1,25 @@
+import http from "k6/http";
+import { check } from "k6";
+
+/*
+ * Every VU has a cookie jar of its own, which keeps any cookies servers set,
+ * through redirects and from one iteration to the next.
+ */
+
+export default function() {
+    // Cookies set by the server are kept in the jar, and sent from then on.
+    http.get("http://httpbin.org/cookies/set?session=abc123");
+
+    // You can set cookies for a URL yourself, or look at what would be sent.
+    let jar = http.cookieJar();
+    jar.set("http://httpbin.org/cookies", "theme", "dark");
+    let cookies = jar.cookiesForURL("http://httpbin.org/cookies");
+    check(cookies, { "has session": (c) => c.session[0] === "abc123" });
+
+    // Cookies given for a single request replace any of the same name in the jar.
+    let res = http.get("http://httpbin.org/cookies", { cookies: { theme: "light" } });
+    check(res, { "theme overridden": (r) => r.json().cookies.theme === "light" });
+
+    // Start over with a clean jar.
+    jar.clear("http://httpbin.org/");
+}
@@ -0,0 +1,25 @@
+import { check } from 'k6';
+import http from 'k6/http';
+
+export let options = {
+  // Point the test at one replica, without touching /etc/hosts.
+  hosts: {
+    "test.loadimpact.com": "127.0.0.1",
+  },
+
+  // Re-resolve other names every minute, spreading connections over all their IPs.
+  dns: {
+    ttl: "1m",
+    select: "roundRobin",
+  },
+
+  // Every iteration is a new client, with cold connections.
+  noVUConnectionReuse: true,
+};
+
+export default function() {
+  const res = http.get("http://test.loadimpact.com");
+  check(res, {
+    "status is 200": r => r.status === 200,
+  });
+}
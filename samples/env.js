@@ -0,0 +1,21 @@
+import http from "k6/http";
+import { check } from "k6";
+
+// Run with eg. `k6 run -e BASE_URL=http://staging.example.com -e VUS=10 samples/env.js`.
+const baseURL = __ENV.BASE_URL || "http://test.loadimpact.com";
+
+export let options = {
+    vus: parseInt(__ENV.VUS || "1"),
+    duration: "10s",
+
+    // Added to every sample, so runs against different environments can be told apart.
+    tags: { target: baseURL },
+};
+
+export default function() {
+    // Per-request tags are added to (and override) the global ones.
+    let res = http.get(baseURL + "/", { tags: { page: "home" } });
+    check(res, {
+        "status is 200": (r) => r.status === 200,
+    });
+}
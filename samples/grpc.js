@@ -0,0 +1,23 @@
+import grpc from "k6/grpc";
+import { check } from "k6";
+
+// Service definitions can be loaded from .proto files in the init context...
+let client = new grpc.Client();
+client.load(["definitions"], "hello.proto");
+
+export default function() {
+    // ...or fetched from servers that support reflection, with { reflect: true }.
+    client.connect("localhost:50051", { plaintext: true, timeout: "5s" });
+
+    let res = client.invoke("hello.HelloService/SayHello", { greeting: "Bert" }, {
+        metadata: { "x-my-header": "k6test" },
+        timeout: "2s",
+        tags: { my_tag: "I'm a tag" },
+    });
+    check(res, {
+        "status is OK": (r) => r && r.status === grpc.StatusOK,
+        "reply is set": (r) => r && r.message.reply !== "",
+    });
+
+    client.close();
+};
@@ -0,0 +1,19 @@
+import http from "k6/http";
+import { check } from "k6";
+
+export default function() {
+    // Fetch a page with a form on it
+    let res = http.get("http://httpbin.org/forms/post");
+
+    // Fill in some of the fields and submit it; the rest keep the values they have on the page
+    res = res.submitForm({
+        fields: { custname: "Test Name", custemail: "test@example.com", size: "medium" },
+    });
+
+    // Verify response
+    check(res, {
+        "status is 200": (r) => r.status === 200,
+        "has correct name": (r) => r.json().form.custname === "Test Name",
+        "has correct size": (r) => r.json().form.size === "medium",
+    });
+}
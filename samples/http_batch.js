@@ -1,10 +1,16 @@
 import { check } from 'k6';
 import http from 'k6/http';
 
+// Like a browser, make at most 6 requests at a time to any one host.
+export let options = {
+  batchPerHost: 6,
+};
+
 export default function() {
   const responses = http.batch([
     "http://test.loadimpact.com",
-    "http://test.loadimpact.com/pi.php"
+    "http://test.loadimpact.com/pi.php",
+    { method: "GET", url: "http://test.loadimpact.com/style.css", params: { tags: { type: "css" } } },
   ]);
 
   check(responses[0], {
@@ -15,4 +21,8 @@ export default function() {
     "pi page 200": res => res.status === 200,
     "pi page has right content": res => res.body === "3.14",
   });
+
+  check(responses[2], {
+    "stylesheet 200": res => res.status === 200,
+  });
 };
@@ -0,0 +1,23 @@
+import http from "k6/http";
+import { check } from "k6";
+
+/*
+ * open() can only be called in the init context; pass "b" to get the file's
+ * contents as an array of bytes, rather than a string.
+ */
+let binFile = open("/path/to/file.bin", "b");
+
+export default function() {
+    // Any file parts turn the body into multipart/form-data.
+    let data = {
+        field: "this is a standard form field",
+        file: http.file(binFile, "test.bin"),
+        text: http.file("some text", "test.txt", "text/plain"),
+    };
+    let res = http.post("https://httpbin.org/post", data);
+    check(res, { "is status 200": (r) => r.status === 200 });
+
+    // Or send the file as the whole body.
+    res = http.post("https://httpbin.org/post", binFile);
+    check(res, { "is status 200": (r) => r.status === 200 });
+}
@@ -0,0 +1,43 @@
+import http from "k6/http";
+import { check } from "k6";
+
+/*
+ * Scenarios let one script run several workloads side by side, each with its
+ * own VUs, schedule and function to run. Every metric a scenario emits is
+ * tagged with scenario:<name>, plus any tags you give it, so you can set
+ * thresholds on each of them separately.
+ *
+ * Scenarios with a rate start iterations at that many per second, using
+ * their VUs as a pool; the others just loop their VUs for their duration.
+ */
+
+export let options = {
+    scenarios: {
+        browse: {
+            vus: 50,
+            duration: "2m",
+            exec: "browse",
+        },
+        api: {
+            vus: 100,
+            rate: 200,
+            startTime: "30s",
+            duration: "1m",
+            exec: "api",
+            tags: { service: "api" },
+        },
+    },
+    thresholds: {
+        "http_req_duration{scenario:api}": ["p(95)<200"],
+    },
+};
+
+export function browse() {
+    let res = http.get("http://httpbin.org/html");
+    check(res, { "status is 200": (r) => r.status === 200 });
+}
+
+export function api() {
+    let res = http.get("http://httpbin.org/get");
+    check(res, { "status is 200": (r) => r.status === 200 });
+}
@@ -0,0 +1,25 @@
+import http from "k6/http";
+import { check } from "k6";
+
+/*
+ * setup() runs once before the test starts, and teardown() once after it
+ * ends; neither runs per VU. Whatever setup() returns is passed to every
+ * iteration of the default function, and to teardown().
+ *
+ * The data is copied as JSON, so it must be serializable, and changes an
+ * iteration makes to it aren't seen by anyone else.
+ */
+
+export function setup() {
+    let res = http.post("http://httpbin.org/post", { user: "admin" });
+    return { token: res.json().form.user };
+}
+
+export default function(data) {
+    let res = http.get("http://httpbin.org/headers", { headers: { "X-Token": data.token } });
+    check(res, { "status is 200": (r) => r.status === 200 });
+}
+
+export function teardown(data) {
+    http.post("http://httpbin.org/post", { logout: data.token });
+}
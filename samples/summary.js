@@ -0,0 +1,27 @@
+import http from "k6/http";
+import { check } from "k6";
+
+/*
+ * handleSummary() is called once at the end of the test with the same data
+ * --summary-export writes. Each key of the returned object is a file to
+ * write, or "stdout"/"stderr"; values must be strings or byte arrays.
+ */
+
+export let options = {
+    thresholds: {
+        http_req_duration: ["p(95)<500"],
+    },
+};
+
+export default function() {
+    let res = http.get("http://httpbin.org/");
+    check(res, { "status is 200": (r) => r.status === 200 });
+}
+
+export function handleSummary(data) {
+    let p95 = data.metrics.http_req_duration.values.p95;
+    return {
+        "stdout": "p(95) of http_req_duration: " + p95 + "ms\n",
+        "summary.json": JSON.stringify(data, null, 2),
+    };
+}
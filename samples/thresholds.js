@@ -10,6 +10,10 @@ import { check } from "k6";
  * key/value pairs where the name specifies the metric to watch (with optional 
  * tag filtering) and the values are JS expressions. Which could be a simple
  * number or involve a statistical aggregate like avg, max, percentiles etc.
+ *
+ * Thresholds are checked every couple of seconds while the test runs. One
+ * given as an object with abortOnFail stops the test as soon as it's crossed;
+ * delayAbortEval gives it a grace period at the start, to let results settle.
  */
 
 export let options = {
@@ -22,6 +26,11 @@ export let options = {
         // where the URL tag is equal to "http://httpbin.org/post",
         // the max should not cross 1000ms
         "http_req_duration{url:http://httpbin.org/post}": ["max<1000"],
+
+        // Abort the test if the median goes over 2s, but not in the first 10s
+        "http_req_duration{url:http://httpbin.org/}": [
+            { threshold: "med<2000", abortOnFail: true, delayAbortEval: "10s" },
+        ],
     }
 };
 
@@ -0,0 +1,28 @@
+import http from "k6/http";
+import { check } from "k6";
+
+/*
+ * Client certificates are only presented to the domains they're given for;
+ * "*.example.com" matches any subdomain of example.com. The certificate and
+ * key are PEM-encoded, and usually read from files with open().
+ */
+
+export let options = {
+    tlsAuth: [
+        {
+            domains: ["api.example.com", "*.gateway.example.com"],
+            cert: open("./client.crt"),
+            key: open("./client.key"),
+        },
+    ],
+    tlsVersion: { min: "tls1.1", max: "tls1.2" },
+    tlsCipherSuites: [
+        "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+        "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+    ],
+};
+
+export default function() {
+    let res = http.get("https://api.example.com/");
+    check(res, { "is status 200": (r) => r.status === 200 });
+}
@@ -0,0 +1,30 @@
+import ws from "k6/ws";
+import { check } from "k6";
+
+export default function() {
+    let res = ws.connect("ws://echo.websocket.org", function(socket) {
+        socket.on("open", function() {
+            socket.send("Hello, world!");
+
+            // Measure the round trip time every second.
+            socket.setInterval(function() { socket.ping(); }, 1000);
+        });
+        socket.on("message", function(data) {
+            console.log("Message received: ", data);
+        });
+        socket.on("pong", function() {
+            console.log("Pong!");
+        });
+        socket.on("error", function(e) {
+            console.log("An error occurred: ", e.error());
+        });
+        socket.on("close", function(code) {
+            console.log("Disconnected: ", code);
+        });
+
+        // Hang up after five seconds.
+        socket.setTimeout(function() { socket.close(); }, 5000);
+    });
+
+    check(res, { "status is 101": (r) => r.status === 101 });
+};
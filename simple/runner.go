@@ -78,6 +78,14 @@ func (r *Runner) NewVU() (lib.VU, error) {
 	}, nil
 }
 
+func (r *Runner) Setup(ctx context.Context) ([]stats.Sample, error) {
+	return nil, nil
+}
+
+func (r *Runner) Teardown(ctx context.Context) ([]stats.Sample, error) {
+	return nil, nil
+}
+
 func (r *Runner) GetDefaultGroup() *lib.Group {
 	return &lib.Group{}
 }
@@ -0,0 +1,228 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package csv
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats"
+	"github.com/spf13/afero"
+)
+
+type Collector struct {
+	Config Config
+
+	fs afero.Fs
+
+	// The current file, and the writers wrapping it; out is the file or stdout.
+	lock     sync.Mutex
+	filename string
+	out      io.Writer
+	written  *countingWriter
+	gz       *gzip.Writer
+	w        *csv.Writer
+	openedAt time.Time
+	rows     int64
+}
+
+// Counts the bytes written to a file, for size-based rotation.
+type countingWriter struct {
+	io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+func New(s string, fs afero.Fs, opts lib.Options) (*Collector, error) {
+	conf, err := parseConfig(s)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Collector{Config: conf, fs: fs}
+	if err := c.open(time.Now()); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Collector) Init() {
+}
+
+func (c *Collector) String() string {
+	return fmt.Sprintf("CSV (%s)", c.Config.Filename)
+}
+
+func (c *Collector) Run(ctx context.Context) {
+	log.WithField("filename", c.Config.Filename).Debug("CSV: Writing CSV metrics")
+	<-ctx.Done()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err := c.close(); err != nil {
+		log.WithError(err).WithField("filename", c.filename).Error("CSV: Couldn't close file")
+	}
+}
+
+func (c *Collector) Collect(samples []stats.Sample) {
+	if len(samples) == 0 {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, sample := range samples {
+		if c.shouldRotate(sample.Time) {
+			if err := c.rotate(sample.Time); err != nil {
+				log.WithError(err).WithField("filename", c.Config.Filename).Error("CSV: Couldn't rotate file")
+				return
+			}
+		}
+		if err := c.w.Write(c.row(sample)); err != nil {
+			log.WithError(err).WithField("filename", c.filename).Error("CSV: Error writing to file")
+			return
+		}
+		c.rows++
+	}
+	c.w.Flush()
+	if err := c.w.Error(); err != nil {
+		log.WithError(err).WithField("filename", c.filename).Error("CSV: Error writing to file")
+	}
+}
+
+func (c *Collector) header() []string {
+	header := []string{"metric_name", "timestamp", "metric_value"}
+	header = append(header, c.Config.TagColumns...)
+	return append(header, "extra_tags")
+}
+
+// Makes a row out of a sample; tags without a column of their own are encoded like a query
+// string in the last one.
+func (c *Collector) row(sample stats.Sample) []string {
+	row := make([]string, 0, len(c.Config.TagColumns)+4)
+	row = append(row,
+		sample.Metric.Name,
+		strconv.FormatFloat(float64(sample.Time.UnixNano())/float64(time.Second), 'f', 3, 64),
+		strconv.FormatFloat(sample.Value, 'f', -1, 64),
+	)
+
+	extra := make(url.Values)
+	for k, v := range sample.Tags {
+		extra.Set(k, v)
+	}
+	for _, tag := range c.Config.TagColumns {
+		row = append(row, sample.Tags[tag])
+		extra.Del(tag)
+	}
+	return append(row, extra.Encode())
+}
+
+// Files are rotated once they hit the size or age limit, but never before they have any rows.
+func (c *Collector) shouldRotate(t time.Time) bool {
+	if c.rows == 0 {
+		return false
+	}
+	if c.Config.RotateSize > 0 && c.written.n >= c.Config.RotateSize {
+		return true
+	}
+	return c.Config.RotateInterval > 0 && t.Sub(c.openedAt) >= c.Config.RotateInterval
+}
+
+func (c *Collector) rotate(t time.Time) error {
+	if err := c.close(); err != nil {
+		return err
+	}
+	return c.open(t)
+}
+
+// Opens a new file and writes the header to it; files are only named after their start time
+// if they're going to be rotated.
+func (c *Collector) open(t time.Time) error {
+	var out io.Writer = os.Stdout
+	filename := c.Config.Filename
+	if filename != "-" {
+		if c.Config.RotateSize > 0 || c.Config.RotateInterval > 0 {
+			filename = rotatedFilename(c.Config.Filename, t, 0)
+			for n := 1; ; n++ {
+				if _, err := c.fs.Stat(filename); os.IsNotExist(err) {
+					break
+				}
+				filename = rotatedFilename(c.Config.Filename, t, n)
+			}
+		}
+		f, err := c.fs.Create(filename)
+		if err != nil {
+			return err
+		}
+		out = f
+	}
+
+	c.filename = filename
+	c.out = out
+	c.written = &countingWriter{Writer: out}
+	c.openedAt = t
+	c.rows = 0
+
+	var w io.Writer = c.written
+	c.gz = nil
+	if c.Config.Gzip {
+		c.gz = gzip.NewWriter(c.written)
+		w = c.gz
+	}
+	c.w = csv.NewWriter(w)
+	if err := c.w.Write(c.header()); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *Collector) close() error {
+	c.w.Flush()
+	if err := c.w.Error(); err != nil {
+		return err
+	}
+	if c.gz != nil {
+		if err := c.gz.Close(); err != nil {
+			return err
+		}
+	}
+	if f, ok := c.out.(io.Closer); ok && c.filename != "-" {
+		return f.Close()
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package csv
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+var testMetric = stats.New("my_metric", stats.Trend)
+
+func readCSV(t *testing.T, fs afero.Fs, filename string, gz bool) [][]string {
+	f, err := fs.Open(filename)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	defer func() { _ = f.Close() }()
+
+	var r io.Reader = f
+	if gz {
+		gzr, err := gzip.NewReader(f)
+		if !assert.NoError(t, err) {
+			return nil
+		}
+		r = gzr
+	}
+	rows, err := csv.NewReader(r).ReadAll()
+	assert.NoError(t, err)
+	return rows
+}
+
+func TestNew(t *testing.T) {
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := New("results.csv&nope=1", afero.NewMemMapFs(), lib.Options{})
+		assert.EqualError(t, err, "csv output: unknown option: nope")
+	})
+	t.Run("Unwritable", func(t *testing.T) {
+		_, err := New("results.csv", afero.NewReadOnlyFs(afero.NewMemMapFs()), lib.Options{})
+		assert.Error(t, err)
+	})
+}
+
+func TestCollector(t *testing.T) {
+	at := time.Unix(1500000000, 123000000)
+	samples := []stats.Sample{
+		{Metric: testMetric, Time: at, Value: 1.5, Tags: map[string]string{"url": "http://example.com/", "status": "200"}},
+		{Metric: testMetric, Time: at, Value: 2, Tags: map[string]string{"url": "http://example.com/", "custom": "a,b"}},
+	}
+
+	for name, filename := range map[string]string{"Plain": "results.csv", "Gzip": "results.csv.gz"} {
+		t.Run(name, func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			c, err := New(filename+"&tags=url,status", fs, lib.Options{})
+			if !assert.NoError(t, err) {
+				return
+			}
+			c.Collect(samples)
+			assert.NoError(t, c.close())
+
+			assert.Equal(t, [][]string{
+				{"metric_name", "timestamp", "metric_value", "url", "status", "extra_tags"},
+				{"my_metric", "1500000000.123", "1.5", "http://example.com/", "200", ""},
+				{"my_metric", "1500000000.123", "2", "http://example.com/", "", "custom=a%2Cb"},
+			}, readCSV(t, fs, filename, c.Config.Gzip))
+		})
+	}
+
+	t.Run("RotateSize", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		c, err := New("out/results.csv&rotate_size=1B", fs, lib.Options{})
+		if !assert.NoError(t, err) {
+			return
+		}
+		c.Collect(samples)
+		assert.NoError(t, c.close())
+
+		// The header alone fills a file, so every sample gets one of its own.
+		files, err := afero.ReadDir(fs, "out")
+		assert.NoError(t, err)
+		if assert.Len(t, files, 2) {
+			for _, f := range files {
+				assert.Len(t, readCSV(t, fs, "out/"+f.Name(), false), 2)
+			}
+		}
+	})
+	t.Run("RotateInterval", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		c, err := New("results.csv&rotate_interval=1m", fs, lib.Options{})
+		if !assert.NoError(t, err) {
+			return
+		}
+		c.openedAt = at
+		c.Collect([]stats.Sample{
+			{Metric: testMetric, Time: at.Add(30 * time.Second), Value: 1},
+			{Metric: testMetric, Time: at.Add(90 * time.Second), Value: 2},
+		})
+		assert.NoError(t, c.close())
+
+		rows := readCSV(t, fs, rotatedFilename("results.csv", at.Add(90*time.Second), 0), false)
+		if assert.Len(t, rows, 2) {
+			assert.Equal(t, "2", rows[1][2])
+		}
+	})
+}
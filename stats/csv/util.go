@@ -0,0 +1,143 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package csv
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Tags that get columns of their own by default; any others go in the extra_tags column.
+var DefaultTagColumns = []string{
+	"proto", "subproto", "status", "method", "url", "group", "check", "error", "scenario",
+}
+
+// Config holds the settings for a CSV collector.
+type Config struct {
+	// File to write to, or "-" for stdout; with rotation, each file's start time is added to it.
+	Filename string
+	Gzip     bool
+
+	TagColumns []string
+
+	// Start a new file once the current one has this many bytes (on disk) or is this old;
+	// zero values disable either kind of rotation.
+	RotateSize     int64
+	RotateInterval time.Duration
+}
+
+// Parses a collector string; either just a filename, eg. "results.csv", or a filename followed
+// by options, eg. "results.csv.gz&rotate_size=100MB&rotate_interval=1h&tags=url,status".
+func parseConfig(s string) (Config, error) {
+	conf := Config{TagColumns: DefaultTagColumns}
+
+	parts := strings.Split(s, "&")
+	conf.Filename = parts[0]
+	if conf.Filename == "" {
+		conf.Filename = "-"
+	}
+	conf.Gzip = strings.HasSuffix(conf.Filename, ".gz")
+
+	for _, part := range parts[1:] {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return conf, errors.Errorf("csv output: invalid option: %s", part)
+		}
+		k, v := kv[0], kv[1]
+		switch k {
+		case "gzip":
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return conf, errors.Errorf("csv output: invalid gzip: %s", v)
+			}
+			conf.Gzip = b
+		case "tags":
+			conf.TagColumns = nil
+			for _, tag := range strings.Split(v, ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					conf.TagColumns = append(conf.TagColumns, tag)
+				}
+			}
+		case "rotate_size":
+			size, err := parseSize(v)
+			if err != nil {
+				return conf, err
+			}
+			conf.RotateSize = size
+		case "rotate_interval":
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return conf, errors.Errorf("csv output: invalid rotate_interval: %s", v)
+			}
+			conf.RotateInterval = d
+		default:
+			return conf, errors.Errorf("csv output: unknown option: %s", k)
+		}
+	}
+
+	if conf.Filename == "-" && (conf.RotateSize > 0 || conf.RotateInterval > 0) {
+		return conf, errors.New("csv output: can't rotate stdout")
+	}
+	return conf, nil
+}
+
+// Parses a size in bytes, optionally suffixed with KB, MB or GB (powers of 1024).
+func parseSize(s string) (int64, error) {
+	mult := int64(1)
+	num := strings.ToUpper(s)
+	for _, unit := range []struct {
+		suffix string
+		mult   int64
+	}{{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"B", 1}} {
+		if strings.HasSuffix(num, unit.suffix) {
+			num = strings.TrimSuffix(num, unit.suffix)
+			mult = unit.mult
+			break
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(num), 10, 64)
+	if err != nil || n < 0 {
+		return 0, errors.Errorf("csv output: invalid rotate_size: %s", s)
+	}
+	return n * mult, nil
+}
+
+// Returns the name of a rotated file, with its start time inserted before its extensions, eg.
+// "results.csv.gz" -> "results-20170102T150405Z.csv.gz"; n > 0 tells apart files that were
+// started within the same second.
+func rotatedFilename(filename string, t time.Time, n int) string {
+	stamp := t.UTC().Format("20060102T150405Z")
+	if n > 0 {
+		stamp += "-" + strconv.Itoa(n)
+	}
+
+	dir, base := "", filename
+	if i := strings.LastIndexAny(filename, `/\`); i >= 0 {
+		dir, base = filename[:i+1], filename[i+1:]
+	}
+	if i := strings.Index(base, "."); i > 0 {
+		return dir + base[:i] + "-" + stamp + base[i:]
+	}
+	return dir + base + "-" + stamp
+}
@@ -0,0 +1,94 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package csv
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConfig(t *testing.T) {
+	t.Run("Filename", func(t *testing.T) {
+		conf, err := parseConfig("results.csv")
+		assert.NoError(t, err)
+		assert.Equal(t, "results.csv", conf.Filename)
+		assert.False(t, conf.Gzip)
+		assert.Equal(t, DefaultTagColumns, conf.TagColumns)
+		assert.Equal(t, int64(0), conf.RotateSize)
+		assert.Equal(t, time.Duration(0), conf.RotateInterval)
+	})
+	t.Run("Stdout", func(t *testing.T) {
+		conf, err := parseConfig("")
+		assert.NoError(t, err)
+		assert.Equal(t, "-", conf.Filename)
+	})
+	t.Run("Gzip", func(t *testing.T) {
+		conf, err := parseConfig("results.csv.gz")
+		assert.NoError(t, err)
+		assert.True(t, conf.Gzip)
+
+		conf, err = parseConfig("results.csv&gzip=true")
+		assert.NoError(t, err)
+		assert.True(t, conf.Gzip)
+	})
+	t.Run("Options", func(t *testing.T) {
+		conf, err := parseConfig("results.csv&tags=url,status&rotate_size=100MB&rotate_interval=1h")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"url", "status"}, conf.TagColumns)
+		assert.Equal(t, int64(100<<20), conf.RotateSize)
+		assert.Equal(t, 1*time.Hour, conf.RotateInterval)
+	})
+	testdata := map[string]string{
+		"results.csv&gzip=maybe":          "csv output: invalid gzip: maybe",
+		"results.csv&rotate_size=lots":    "csv output: invalid rotate_size: lots",
+		"results.csv&rotate_interval=day": "csv output: invalid rotate_interval: day",
+		"results.csv&format=tsv":          "csv output: unknown option: format",
+		"results.csv&gzip":                "csv output: invalid option: gzip",
+		"-&rotate_size=1KB":               "csv output: can't rotate stdout",
+	}
+	for s, msg := range testdata {
+		t.Run("Invalid/"+s, func(t *testing.T) {
+			_, err := parseConfig(s)
+			assert.EqualError(t, err, msg)
+		})
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	testdata := map[string]int64{"0": 0, "512": 512, "512B": 512, "2KB": 2048, "3mb": 3 << 20, "1GB": 1 << 30}
+	for s, size := range testdata {
+		n, err := parseSize(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, size, n, s)
+	}
+	_, err := parseSize("-1")
+	assert.Error(t, err)
+}
+
+func TestRotatedFilename(t *testing.T) {
+	at := time.Date(2017, 1, 2, 15, 4, 5, 0, time.UTC)
+	assert.Equal(t, "results-20170102T150405Z.csv", rotatedFilename("results.csv", at, 0))
+	assert.Equal(t, "results-20170102T150405Z.csv.gz", rotatedFilename("results.csv.gz", at, 0))
+	assert.Equal(t, "out/results-20170102T150405Z-2.csv", rotatedFilename("out/results.csv", at, 2))
+	assert.Equal(t, "./results-20170102T150405Z", rotatedFilename("./results", at, 0))
+}
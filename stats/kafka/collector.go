@@ -0,0 +1,140 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	log "github.com/Sirupsen/logrus"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats"
+)
+
+type Collector struct {
+	Config   Config
+	Producer sarama.SyncProducer
+
+	buffer     []stats.Sample
+	bufferLock sync.Mutex
+}
+
+func New(s string, opts lib.Options) (*Collector, error) {
+	conf, err := parseConfig(s)
+	if err != nil {
+		return nil, err
+	}
+
+	producerConf := sarama.NewConfig()
+	producerConf.Producer.Return.Successes = true
+	producer, err := sarama.NewSyncProducer(conf.Brokers, producerConf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Collector{
+		Config:   conf,
+		Producer: producer,
+	}, nil
+}
+
+func (c *Collector) Init() {
+}
+
+func (c *Collector) String() string {
+	return fmt.Sprintf("kafka (%s, %s)", c.Config.Topic, strings.Join(c.Config.Brokers, ","))
+}
+
+func (c *Collector) Run(ctx context.Context) {
+	log.Debug("Kafka: Running!")
+	ticker := time.NewTicker(c.Config.PushInterval)
+	for {
+		select {
+		case <-ticker.C:
+			c.commit()
+		case <-ctx.Done():
+			c.commit()
+			if err := c.Producer.Close(); err != nil {
+				log.WithError(err).Error("Kafka: Couldn't close producer")
+			}
+			return
+		}
+	}
+}
+
+func (c *Collector) Collect(samples []stats.Sample) {
+	c.bufferLock.Lock()
+	c.buffer = append(c.buffer, samples...)
+	c.bufferLock.Unlock()
+}
+
+func (c *Collector) commit() {
+	c.bufferLock.Lock()
+	samples := c.buffer
+	c.buffer = nil
+	c.bufferLock.Unlock()
+
+	if len(samples) == 0 {
+		return
+	}
+
+	log.Debug("Kafka: Committing...")
+	msgs := make([]*sarama.ProducerMessage, 0, len(samples))
+	for i := range samples {
+		msg, err := c.makeMessage(&samples[i])
+		if err != nil {
+			log.WithError(err).Error("Kafka: Couldn't encode sample")
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+
+	log.WithField("messages", len(msgs)).Debug("Kafka: Writing...")
+	startTime := time.Now()
+	if err := c.Producer.SendMessages(msgs); err != nil {
+		log.WithError(err).Error("Kafka: Couldn't write stats")
+	}
+	t := time.Since(startTime)
+	log.WithField("t", t).Debug("Kafka: Batch written!")
+}
+
+func (c *Collector) makeMessage(sample *stats.Sample) (*sarama.ProducerMessage, error) {
+	msg := &sarama.ProducerMessage{Topic: c.Config.Topic}
+	if c.Config.PartitionKey != "" {
+		msg.Key = sarama.StringEncoder(sample.Tags[c.Config.PartitionKey])
+	}
+
+	switch c.Config.Format {
+	case FormatAvro:
+		msg.Value = sarama.ByteEncoder(encodeAvro(sample))
+	default:
+		data, err := encodeJSON(sample)
+		if err != nil {
+			return nil, err
+		}
+		msg.Value = sarama.ByteEncoder(data)
+	}
+	return msg, nil
+}
@@ -0,0 +1,75 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package kafka
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollector(t *testing.T) {
+	producerConf := sarama.NewConfig()
+	producerConf.Producer.Return.Successes = true
+	producer := mocks.NewSyncProducer(t, producerConf)
+
+	c := &Collector{
+		Config:   Config{Topic: "k6", Format: FormatJSON, PartitionKey: "url", PushInterval: defaultPushInterval},
+		Producer: producer,
+	}
+
+	m := stats.New("my_metric", stats.Counter)
+	samples := []stats.Sample{
+		{Metric: m, Value: 1, Tags: map[string]string{"url": "http://example.com/1"}},
+		{Metric: m, Value: 2, Tags: map[string]string{"url": "http://example.com/2"}},
+	}
+	for _, sample := range samples {
+		expected, err := encodeJSON(&sample)
+		if !assert.NoError(t, err) {
+			return
+		}
+		producer.ExpectSendMessageWithCheckerFunctionAndSucceed(func(val []byte) error {
+			assert.Equal(t, string(expected), string(val))
+			return nil
+		})
+	}
+
+	t.Run("makeMessage", func(t *testing.T) {
+		msg, err := c.makeMessage(&samples[0])
+		assert.NoError(t, err)
+		assert.Equal(t, "k6", msg.Topic)
+		assert.Equal(t, sarama.StringEncoder("http://example.com/1"), msg.Key)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
+	c.Collect(samples)
+	cancel()
+	<-done
+}
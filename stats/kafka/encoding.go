@@ -0,0 +1,82 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package kafka
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+
+	"github.com/loadimpact/k6/stats"
+	jsonc "github.com/loadimpact/k6/stats/json"
+)
+
+// AvroSchema is the schema of samples written in the "avro" format. Messages carry bare binary
+// datums, without a container or schema fingerprint; consumers need to use this schema to read
+// them. Times are in microseconds since the Unix epoch.
+const AvroSchema = `{
+  "type": "record",
+  "name": "Sample",
+  "namespace": "io.k6",
+  "fields": [
+    {"name": "metric", "type": "string"},
+    {"name": "time", "type": {"type": "long", "logicalType": "timestamp-micros"}},
+    {"name": "value", "type": "double"},
+    {"name": "tags", "type": {"type": "map", "values": "string"}}
+  ]
+}`
+
+// Encodes a sample in the same envelope format that the JSON output uses.
+func encodeJSON(sample *stats.Sample) ([]byte, error) {
+	return json.Marshal(jsonc.WrapSample(sample))
+}
+
+// Encodes a sample as a binary Avro datum, matching AvroSchema.
+func encodeAvro(sample *stats.Sample) []byte {
+	buf := make([]byte, 0, 64)
+	buf = appendAvroString(buf, sample.Metric.Name)
+	buf = appendAvroLong(buf, sample.Time.UnixNano()/1000)
+
+	var f [8]byte
+	binary.LittleEndian.PutUint64(f[:], math.Float64bits(sample.Value))
+	buf = append(buf, f[:]...)
+
+	// Maps are written as a single block, followed by an empty one to terminate it.
+	if len(sample.Tags) > 0 {
+		buf = appendAvroLong(buf, int64(len(sample.Tags)))
+		for k, v := range sample.Tags {
+			buf = appendAvroString(buf, k)
+			buf = appendAvroString(buf, v)
+		}
+	}
+	return appendAvroLong(buf, 0)
+}
+
+func appendAvroLong(buf []byte, v int64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(b[:], v) // Zig-zag encoded, same as Avro.
+	return append(buf, b[:n]...)
+}
+
+func appendAvroString(buf []byte, s string) []byte {
+	buf = appendAvroLong(buf, int64(len(s)))
+	return append(buf, s...)
+}
@@ -0,0 +1,71 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package kafka
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeJSON(t *testing.T) {
+	m := stats.New("my_metric", stats.Counter)
+	data, err := encodeJSON(&stats.Sample{
+		Metric: m,
+		Time:   time.Unix(10, 0).UTC(),
+		Tags:   map[string]string{"a": "1"},
+		Value:  2,
+	})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "Point",
+		"metric": "my_metric",
+		"data": {"time": "1970-01-01T00:00:10Z", "value": 2, "tags": {"a": "1"}}
+	}`, string(data))
+}
+
+func TestEncodeAvro(t *testing.T) {
+	var schema map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(AvroSchema), &schema), "invalid schema")
+
+	m := stats.New("m", stats.Counter)
+	t.Run("No Tags", func(t *testing.T) {
+		data := encodeAvro(&stats.Sample{Metric: m, Time: time.Unix(0, 1000), Value: 1})
+		assert.Equal(t, []byte{
+			0x02, 'm', // metric
+			0x02,                                           // time (1µs)
+			0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xf0, 0x3f, // value (1.0)
+			0x00, // tags (empty)
+		}, data)
+	})
+	t.Run("Tags", func(t *testing.T) {
+		data := encodeAvro(&stats.Sample{Metric: m, Time: time.Unix(0, 0), Tags: map[string]string{"a": "bc"}})
+		assert.Equal(t, []byte{
+			0x02, 'm', // metric
+			0x00,                                           // time
+			0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // value
+			0x02, 0x02, 'a', 0x04, 'b', 'c', 0x00, // tags
+		}, data)
+	})
+}
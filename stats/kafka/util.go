@@ -0,0 +1,98 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package kafka
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const defaultPushInterval = 1 * time.Second
+
+// Supported message formats.
+const (
+	FormatJSON = "json"
+	FormatAvro = "avro"
+)
+
+var (
+	ErrNoBrokers = errors.New("kafka output: no brokers specified")
+	ErrNoTopic   = errors.New("kafka output: no topic specified")
+)
+
+// Config holds the settings for a Kafka collector.
+type Config struct {
+	Brokers []string
+	Topic   string
+	Format  string
+
+	// Name of a tag whose value is used as the message key, and thereby the partition key.
+	PartitionKey string
+
+	PushInterval time.Duration
+}
+
+// Parses a collector string, eg. "brokers=host1:9092,host2:9092&topic=k6&format=json".
+func parseConfig(s string) (Config, error) {
+	conf := Config{
+		Format:       FormatJSON,
+		PushInterval: defaultPushInterval,
+	}
+
+	q, err := url.ParseQuery(s)
+	if err != nil {
+		return conf, err
+	}
+	for _, broker := range strings.Split(q.Get("brokers"), ",") {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			conf.Brokers = append(conf.Brokers, broker)
+		}
+	}
+	if len(conf.Brokers) == 0 {
+		return conf, ErrNoBrokers
+	}
+	conf.Topic = q.Get("topic")
+	if conf.Topic == "" {
+		return conf, ErrNoTopic
+	}
+	switch format := q.Get("format"); format {
+	case "":
+	case FormatJSON, FormatAvro:
+		conf.Format = format
+	default:
+		return conf, errors.Errorf("kafka output: unknown format: %s", format)
+	}
+	conf.PartitionKey = q.Get("partition_key")
+	if v := q.Get("push_interval"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return conf, err
+		}
+		if d <= 0 {
+			return conf, errors.Errorf("kafka output: push_interval must be positive: %s", v)
+		}
+		conf.PushInterval = d
+	}
+	return conf, nil
+}
@@ -0,0 +1,68 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package kafka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConfig(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		conf, err := parseConfig("brokers=1.2.3.4:9092,5.6.7.8:9092&topic=k6")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"1.2.3.4:9092", "5.6.7.8:9092"}, conf.Brokers)
+		assert.Equal(t, "k6", conf.Topic)
+		assert.Equal(t, FormatJSON, conf.Format)
+		assert.Equal(t, "", conf.PartitionKey)
+		assert.Equal(t, 1*time.Second, conf.PushInterval)
+	})
+	t.Run("Options", func(t *testing.T) {
+		conf, err := parseConfig("brokers=1.2.3.4:9092&topic=k6&format=avro&partition_key=url&push_interval=5s")
+		assert.NoError(t, err)
+		assert.Equal(t, FormatAvro, conf.Format)
+		assert.Equal(t, "url", conf.PartitionKey)
+		assert.Equal(t, 5*time.Second, conf.PushInterval)
+	})
+	t.Run("No Brokers", func(t *testing.T) {
+		_, err := parseConfig("topic=k6")
+		assert.Equal(t, ErrNoBrokers, err)
+	})
+	t.Run("No Topic", func(t *testing.T) {
+		_, err := parseConfig("brokers=1.2.3.4:9092")
+		assert.Equal(t, ErrNoTopic, err)
+	})
+	t.Run("Invalid Format", func(t *testing.T) {
+		_, err := parseConfig("brokers=1.2.3.4:9092&topic=k6&format=xml")
+		assert.EqualError(t, err, "kafka output: unknown format: xml")
+	})
+	t.Run("Invalid Push Interval", func(t *testing.T) {
+		_, err := parseConfig("brokers=1.2.3.4:9092&topic=k6&push_interval=a")
+		assert.Error(t, err)
+
+		for _, v := range []string{"0s", "-1s"} {
+			_, err := parseConfig("brokers=1.2.3.4:9092&topic=k6&push_interval=" + v)
+			assert.EqualError(t, err, "kafka output: push_interval must be positive: "+v)
+		}
+	})
+}
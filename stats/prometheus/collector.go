@@ -0,0 +1,247 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package prometheus
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats"
+)
+
+// A series is a single metric + label set combination.
+type series struct {
+	labels string
+
+	// Counters, gauges and rates.
+	value        float64
+	trues, total int64
+
+	// Histograms (trends).
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+type family struct {
+	metric *stats.Metric
+	series map[string]*series
+}
+
+// Collector exposes aggregated k6 metrics on an HTTP endpoint, for Prometheus to scrape.
+// Counters are exposed as counters, gauges and rates as gauges, and trends as histograms. Time
+// values are converted to seconds, as is the Prometheus convention.
+type Collector struct {
+	Config Config
+
+	listener net.Listener
+
+	buffer     []stats.Sample
+	bufferLock sync.Mutex
+
+	families     map[string]*family
+	familiesLock sync.Mutex
+}
+
+func New(s string, opts lib.Options) (*Collector, error) {
+	conf, err := parseConfig(s)
+	if err != nil {
+		return nil, err
+	}
+
+	// Listen right away, so a port conflict is reported before the test starts.
+	listener, err := net.Listen("tcp", conf.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Collector{
+		Config:   conf,
+		listener: listener,
+		families: make(map[string]*family),
+	}, nil
+}
+
+func (c *Collector) Init() {
+}
+
+func (c *Collector) String() string {
+	return fmt.Sprintf("prometheus (%s%s)", c.listener.Addr(), c.Config.Path)
+}
+
+func (c *Collector) Run(ctx context.Context) {
+	log.WithField("addr", c.listener.Addr()).Debug("Prometheus: Running!")
+
+	mux := http.NewServeMux()
+	mux.Handle(c.Config.Path, c)
+	go func() {
+		if err := http.Serve(c.listener, mux); err != nil {
+			log.WithError(err).Debug("Prometheus: Server stopped")
+		}
+	}()
+
+	ticker := time.NewTicker(c.Config.PushInterval)
+	for {
+		select {
+		case <-ticker.C:
+			c.commit()
+		case <-ctx.Done():
+			c.commit()
+			_ = c.listener.Close()
+			return
+		}
+	}
+}
+
+func (c *Collector) Collect(samples []stats.Sample) {
+	c.bufferLock.Lock()
+	c.buffer = append(c.buffer, samples...)
+	c.bufferLock.Unlock()
+}
+
+// Folds buffered samples into the exposed series.
+func (c *Collector) commit() {
+	c.bufferLock.Lock()
+	samples := c.buffer
+	c.buffer = nil
+	c.bufferLock.Unlock()
+
+	c.familiesLock.Lock()
+	defer c.familiesLock.Unlock()
+
+	for _, sample := range samples {
+		name := sanitizeName(c.Config.Namespace + sample.Metric.Name)
+		if sample.Metric.Type == stats.Trend && sample.Metric.Contains == stats.Time {
+			name += "_seconds"
+		}
+
+		fam, ok := c.families[name]
+		if !ok {
+			fam = &family{metric: sample.Metric, series: make(map[string]*series)}
+			c.families[name] = fam
+		}
+
+		labels := formatLabels(sample.Tags)
+		s, ok := fam.series[labels]
+		if !ok {
+			s = &series{labels: labels}
+			if sample.Metric.Type == stats.Trend {
+				s.buckets = make([]uint64, len(c.Config.Buckets))
+			}
+			fam.series[labels] = s
+		}
+
+		switch sample.Metric.Type {
+		case stats.Counter:
+			s.value += sample.Value
+		case stats.Gauge:
+			s.value = sample.Value
+		case stats.Rate:
+			s.total++
+			if sample.Value != 0 {
+				s.trues++
+			}
+			s.value = float64(s.trues) / float64(s.total)
+		case stats.Trend:
+			v := sample.Value
+			if sample.Metric.Contains == stats.Time {
+				v = stats.ToD(v).Seconds()
+			}
+			for i, le := range c.Config.Buckets {
+				if v <= le {
+					s.buckets[i]++
+				}
+			}
+			s.sum += v
+			s.count++
+		}
+	}
+}
+
+// ServeHTTP writes all series in the Prometheus text exposition format.
+func (c *Collector) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	c.commit()
+
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w := bufio.NewWriter(rw)
+	c.write(w)
+	if err := w.Flush(); err != nil {
+		log.WithError(err).Debug("Prometheus: Couldn't write response")
+	}
+}
+
+func (c *Collector) write(w *bufio.Writer) {
+	c.familiesLock.Lock()
+	defer c.familiesLock.Unlock()
+
+	names := make([]string, 0, len(c.families))
+	for name := range c.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fam := c.families[name]
+
+		typ := "gauge"
+		switch fam.metric.Type {
+		case stats.Counter:
+			typ = "counter"
+		case stats.Trend:
+			typ = "histogram"
+		}
+		fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+
+		keys := make([]string, 0, len(fam.series))
+		for k := range fam.series {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			s := fam.series[k]
+			if fam.metric.Type != stats.Trend {
+				fmt.Fprintf(w, "%s%s %s\n", name, s.labels, formatValue(s.value))
+				continue
+			}
+
+			for i, le := range c.Config.Buckets {
+				fmt.Fprintf(w, "%s_bucket%s %d\n", name, appendLabel(s.labels, "le", formatValue(le)), s.buckets[i])
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, appendLabel(s.labels, "le", "+Inf"), s.count)
+			fmt.Fprintf(w, "%s_sum%s %s\n", name, s.labels, formatValue(s.sum))
+			fmt.Fprintf(w, "%s_count%s %d\n", name, s.labels, s.count)
+		}
+	}
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,108 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package prometheus
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollector(t *testing.T) {
+	c, err := New("127.0.0.1:0?namespace=k6_&buckets=0.1,1", lib.Options{})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	counter := stats.New("my_counter", stats.Counter)
+	gauge := stats.New("my_gauge", stats.Gauge)
+	trend := stats.New("my_trend", stats.Trend, stats.Time)
+	rate := stats.New("my_rate", stats.Rate)
+	tags := map[string]string{"status": "200"}
+	c.Collect([]stats.Sample{
+		{Metric: counter, Value: 1, Tags: tags},
+		{Metric: counter, Value: 2, Tags: tags},
+		{Metric: counter, Value: 5, Tags: map[string]string{"status": "404"}},
+		{Metric: gauge, Value: 10},
+		{Metric: gauge, Value: 5},
+		{Metric: trend, Value: 50, Tags: tags},
+		{Metric: trend, Value: 500, Tags: tags},
+		{Metric: trend, Value: 5000, Tags: tags},
+		{Metric: rate, Value: 1},
+		{Metric: rate, Value: 0},
+		{Metric: rate, Value: 0},
+		{Metric: rate, Value: 1},
+	})
+
+	rw := httptest.NewRecorder()
+	c.ServeHTTP(rw, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, "text/plain; version=0.0.4", rw.Header().Get("Content-Type"))
+	assert.Equal(t, `# TYPE k6_my_counter counter
+k6_my_counter{status="200"} 3
+k6_my_counter{status="404"} 5
+# TYPE k6_my_gauge gauge
+k6_my_gauge 5
+# TYPE k6_my_rate gauge
+k6_my_rate 0.5
+# TYPE k6_my_trend_seconds histogram
+k6_my_trend_seconds_bucket{status="200",le="0.1"} 1
+k6_my_trend_seconds_bucket{status="200",le="1"} 2
+k6_my_trend_seconds_bucket{status="200",le="+Inf"} 3
+k6_my_trend_seconds_sum{status="200"} 5.55
+k6_my_trend_seconds_count{status="200"} 3
+`, rw.Body.String())
+
+	t.Run("Run", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			c.Run(ctx)
+			close(done)
+		}()
+		defer func() {
+			cancel()
+			<-done
+		}()
+
+		var res *http.Response
+		for i := 0; i < 10; i++ {
+			if res, err = http.Get("http://" + c.listener.Addr().String() + "/metrics"); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer func() { _ = res.Body.Close() }()
+		body, err := ioutil.ReadAll(res.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, res.StatusCode)
+		assert.Contains(t, string(body), "k6_my_gauge 5\n")
+	})
+}
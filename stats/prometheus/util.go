@@ -0,0 +1,148 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package prometheus
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultAddr         = "localhost:5656"
+	defaultPushInterval = 1 * time.Second
+)
+
+// Same as the Prometheus client libraries' defaults; tailored to response times in seconds.
+var defaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Config holds the settings for the scrape endpoint.
+type Config struct {
+	Addr      string
+	Path      string
+	Namespace string
+	Buckets   []float64
+
+	// How often buffered samples are folded into the exposed series.
+	PushInterval time.Duration
+}
+
+// Parses a collector string (host:port[/path], optionally with a query string) into a Config.
+func parseConfig(s string) (Config, error) {
+	conf := Config{
+		Addr:         defaultAddr,
+		Path:         "/metrics",
+		Buckets:      defaultBuckets,
+		PushInterval: defaultPushInterval,
+	}
+	if s == "" {
+		return conf, nil
+	}
+
+	// Allow plain "host:port" strings, which url.Parse() doesn't like on their own.
+	if !strings.Contains(s, "://") {
+		s = "http://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return conf, err
+	}
+	if u.Host != "" {
+		conf.Addr = u.Host
+	}
+	if u.Path != "" && u.Path != "/" {
+		conf.Path = u.Path
+	}
+
+	q := u.Query()
+	conf.Namespace = q.Get("namespace")
+	if v := q.Get("buckets"); v != "" {
+		var buckets []float64
+		for _, part := range strings.Split(v, ",") {
+			b, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+			if err != nil {
+				return conf, err
+			}
+			buckets = append(buckets, b)
+		}
+		sort.Float64s(buckets)
+		conf.Buckets = buckets
+	}
+	if v := q.Get("push_interval"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return conf, err
+		}
+		if d <= 0 {
+			return conf, errors.Errorf("prometheus output: push_interval must be positive: %s", v)
+		}
+		conf.PushInterval = d
+	}
+	return conf, nil
+}
+
+// Returns s with all characters not valid in a Prometheus metric or label name replaced.
+func sanitizeName(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Formats a set of tags as a Prometheus label set, eg. `{method="GET",status="200"}`.
+func formatLabels(tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = sanitizeName(k) + `="` + labelValueEscaper.Replace(tags[k]) + `"`
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// Appends a label to an already formatted label set.
+func appendLabel(labels, key, value string) string {
+	label := key + `="` + labelValueEscaper.Replace(value) + `"`
+	if labels == "" {
+		return "{" + label + "}"
+	}
+	return labels[:len(labels)-1] + "," + label + "}"
+}
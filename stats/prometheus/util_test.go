@@ -0,0 +1,94 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package prometheus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConfig(t *testing.T) {
+	t.Run("Empty", func(t *testing.T) {
+		conf, err := parseConfig("")
+		assert.NoError(t, err)
+		assert.Equal(t, "localhost:5656", conf.Addr)
+		assert.Equal(t, "/metrics", conf.Path)
+		assert.Equal(t, "", conf.Namespace)
+		assert.Equal(t, defaultBuckets, conf.Buckets)
+		assert.Equal(t, 1*time.Second, conf.PushInterval)
+	})
+	t.Run("Addr", func(t *testing.T) {
+		conf, err := parseConfig(":9090")
+		assert.NoError(t, err)
+		assert.Equal(t, ":9090", conf.Addr)
+		assert.Equal(t, "/metrics", conf.Path)
+	})
+	t.Run("Path", func(t *testing.T) {
+		conf, err := parseConfig("0.0.0.0:9090/k6")
+		assert.NoError(t, err)
+		assert.Equal(t, "0.0.0.0:9090", conf.Addr)
+		assert.Equal(t, "/k6", conf.Path)
+	})
+	t.Run("Query", func(t *testing.T) {
+		conf, err := parseConfig(":9090?namespace=k6_&buckets=1,0.1, 0.5&push_interval=5s")
+		assert.NoError(t, err)
+		assert.Equal(t, "k6_", conf.Namespace)
+		assert.Equal(t, []float64{0.1, 0.5, 1}, conf.Buckets)
+		assert.Equal(t, 5*time.Second, conf.PushInterval)
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := parseConfig(":9090?buckets=1,a")
+		assert.Error(t, err)
+		_, err = parseConfig(":9090?push_interval=a")
+		assert.Error(t, err)
+	})
+	t.Run("Non-Positive Push Interval", func(t *testing.T) {
+		for _, v := range []string{"0s", "-1s"} {
+			_, err := parseConfig(":9090?push_interval=" + v)
+			assert.EqualError(t, err, "prometheus output: push_interval must be positive: "+v)
+		}
+	})
+}
+
+func TestSanitizeName(t *testing.T) {
+	testdata := map[string]string{
+		"http_req_duration": "http_req_duration",
+		"my-metric.name":    "my_metric_name",
+		"1st":               "_st",
+		"a1":                "a1",
+	}
+	for in, out := range testdata {
+		t.Run(in, func(t *testing.T) {
+			assert.Equal(t, out, sanitizeName(in))
+		})
+	}
+}
+
+func TestFormatLabels(t *testing.T) {
+	assert.Equal(t, "", formatLabels(nil))
+	assert.Equal(t, `{method="GET",status="200"}`, formatLabels(map[string]string{"status": "200", "method": "GET"}))
+	assert.Equal(t, `{my_tag="a \"b\" \\c"}`, formatLabels(map[string]string{"my-tag": `a "b" \c`}))
+
+	assert.Equal(t, `{le="1"}`, appendLabel("", "le", "1"))
+	assert.Equal(t, `{status="200",le="1"}`, appendLabel(`{status="200"}`, "le", "1"))
+}
@@ -0,0 +1,212 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package statsd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats"
+)
+
+type Collector struct {
+	Config Config
+
+	// Whether to append DogStatsD-style tags to lines.
+	tagged bool
+
+	conn       net.Conn
+	buffer     []stats.Sample
+	bufferLock sync.Mutex
+}
+
+// New creates a collector for a plain StatsD agent; tags are dropped.
+func New(s string, opts lib.Options) (*Collector, error) {
+	return newCollector(s, false)
+}
+
+// NewDatadog creates a collector for a DogStatsD agent, which also receives (whitelisted) tags.
+func NewDatadog(s string, opts lib.Options) (*Collector, error) {
+	return newCollector(s, true)
+}
+
+func newCollector(s string, tagged bool) (*Collector, error) {
+	conf, err := parseConfig(s)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.Dial("udp", conf.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Collector{
+		Config: conf,
+		tagged: tagged,
+		conn:   conn,
+	}, nil
+}
+
+func (c *Collector) Init() {
+}
+
+func (c *Collector) String() string {
+	if c.tagged {
+		return fmt.Sprintf("datadog (%s)", c.Config.Addr)
+	}
+	return fmt.Sprintf("statsd (%s)", c.Config.Addr)
+}
+
+func (c *Collector) Run(ctx context.Context) {
+	log.Debug("StatsD: Running!")
+	ticker := time.NewTicker(c.Config.PushInterval)
+	for {
+		select {
+		case <-ticker.C:
+			c.commit()
+		case <-ctx.Done():
+			c.commit()
+			_ = c.conn.Close()
+			return
+		}
+	}
+}
+
+func (c *Collector) Collect(samples []stats.Sample) {
+	c.bufferLock.Lock()
+	c.buffer = append(c.buffer, samples...)
+	c.bufferLock.Unlock()
+}
+
+func (c *Collector) commit() {
+	c.bufferLock.Lock()
+	samples := c.buffer
+	c.buffer = nil
+	c.bufferLock.Unlock()
+
+	if len(samples) == 0 {
+		return
+	}
+
+	log.WithField("samples", len(samples)).Debug("StatsD: Committing...")
+	startTime := time.Now()
+
+	// Pack as many lines as we can into each datagram; a line that doesn't fit on its own is sent
+	// as-is, and will likely be truncated or dropped somewhere down the line.
+	var buf bytes.Buffer
+	for _, sample := range samples {
+		line := c.formatSample(sample)
+		if line == nil {
+			continue
+		}
+		if buf.Len() > 0 && buf.Len()+1+len(line) > c.Config.BufferSize {
+			c.send(buf.Bytes())
+			buf.Reset()
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.Write(line)
+	}
+	if buf.Len() > 0 {
+		c.send(buf.Bytes())
+	}
+
+	t := time.Since(startTime)
+	log.WithField("t", t).Debug("StatsD: Batch written!")
+}
+
+func (c *Collector) send(data []byte) {
+	if _, err := c.conn.Write(data); err != nil {
+		log.WithError(err).Error("StatsD: Couldn't write stats")
+	}
+}
+
+// Formats a sample as a single (Dog)StatsD line, eg. "k6.http_reqs:1|c|#status:200".
+func (c *Collector) formatSample(sample stats.Sample) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(nameSanitizer.Replace(c.Config.Namespace + sample.Metric.Name))
+	buf.WriteByte(':')
+
+	switch sample.Metric.Type {
+	case stats.Counter:
+		buf.WriteString(strconv.FormatFloat(sample.Value, 'f', -1, 64))
+		buf.WriteString("|c")
+	case stats.Gauge:
+		buf.WriteString(strconv.FormatFloat(sample.Value, 'f', -1, 64))
+		buf.WriteString("|g")
+	case stats.Trend:
+		// Time values are already in milliseconds, which is what StatsD timers expect.
+		buf.WriteString(strconv.FormatFloat(sample.Value, 'f', -1, 64))
+		buf.WriteString("|ms")
+	case stats.Rate:
+		// StatsD has no notion of a rate, so we count the non-zero values and leave it to the
+		// backend to relate that to eg. the iteration count. Zero values carry no information.
+		if sample.Value == 0 {
+			return nil
+		}
+		buf.WriteString("1|c")
+	}
+
+	if c.tagged {
+		if tags := c.formatTags(sample.Tags); len(tags) > 0 {
+			buf.WriteString("|#")
+			buf.WriteString(tags)
+		}
+	}
+	return buf.Bytes()
+}
+
+func (c *Collector) formatTags(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	if c.Config.TagWhitelist != nil {
+		for _, k := range c.Config.TagWhitelist {
+			if _, ok := tags[k]; ok {
+				keys = append(keys, k)
+			}
+		}
+	} else {
+		for k := range tags {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for i, k := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(nameSanitizer.Replace(k))
+		buf.WriteByte(':')
+		buf.WriteString(tagValueSanitizer.Replace(tags[k]))
+	}
+	return buf.String()
+}
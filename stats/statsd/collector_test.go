@@ -0,0 +1,146 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package statsd
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectorFormatSample(t *testing.T) {
+	counter := stats.New("my_counter", stats.Counter)
+	gauge := stats.New("my_gauge", stats.Gauge)
+	trend := stats.New("my_trend", stats.Trend, stats.Time)
+	rate := stats.New("my_rate", stats.Rate)
+	tags := map[string]string{"status": "200", "url": "http://example.com/?a=1,2"}
+
+	testdata := map[string]struct {
+		sample          stats.Sample
+		statsd, datadog string
+	}{
+		"Counter": {
+			stats.Sample{Metric: counter, Value: 2, Tags: tags},
+			"k6.my_counter:2|c",
+			"k6.my_counter:2|c|#status:200,url:http://example.com/?a=1_2",
+		},
+		"Gauge": {
+			stats.Sample{Metric: gauge, Value: 1.5},
+			"k6.my_gauge:1.5|g",
+			"k6.my_gauge:1.5|g",
+		},
+		"Trend": {
+			stats.Sample{Metric: trend, Value: 123.456, Tags: tags},
+			"k6.my_trend:123.456|ms",
+			"k6.my_trend:123.456|ms|#status:200,url:http://example.com/?a=1_2",
+		},
+		"Rate": {
+			stats.Sample{Metric: rate, Value: 1},
+			"k6.my_rate:1|c",
+			"k6.my_rate:1|c",
+		},
+		"Rate/Zero": {
+			stats.Sample{Metric: rate, Value: 0},
+			"",
+			"",
+		},
+	}
+	for name, data := range testdata {
+		t.Run(name, func(t *testing.T) {
+			c := &Collector{Config: Config{Namespace: "k6."}}
+			assert.Equal(t, data.statsd, string(c.formatSample(data.sample)))
+
+			c.tagged = true
+			assert.Equal(t, data.datadog, string(c.formatSample(data.sample)))
+		})
+	}
+
+	t.Run("TagKeys", func(t *testing.T) {
+		c := &Collector{tagged: true}
+		assert.Equal(t, "my_counter:1|c|#a_b:c:d",
+			string(c.formatSample(stats.Sample{Metric: counter, Value: 1, Tags: map[string]string{"a:b": "c:d"}})))
+	})
+	t.Run("TagWhitelist", func(t *testing.T) {
+		c := &Collector{Config: Config{TagWhitelist: []string{"status", "method"}}, tagged: true}
+		assert.Equal(t, "my_counter:1|c|#status:200",
+			string(c.formatSample(stats.Sample{Metric: counter, Value: 1, Tags: tags})))
+	})
+}
+
+func TestCollectorRun(t *testing.T) {
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	listener, err := net.ListenUDP("udp", addr)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() { _ = listener.Close() }()
+
+	// Two lines and the newline between them don't fit in a datagram, so each is sent on its own.
+	expected := []string{
+		"my_counter:1|c|#a:1",
+		"my_counter:2|c|#a:2",
+		"my_counter:3|c|#a:3",
+	}
+	bufferSize := strconv.Itoa(2 * len(expected[0]))
+	c, err := NewDatadog(listener.LocalAddr().String()+"?buffer_size="+bufferSize, lib.Options{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "datadog ("+listener.LocalAddr().String()+")", c.String())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
+
+	m := stats.New("my_counter", stats.Counter)
+	c.Collect([]stats.Sample{
+		{Metric: m, Value: 1, Tags: map[string]string{"a": "1"}},
+		{Metric: m, Value: 2, Tags: map[string]string{"a": "2"}},
+		{Metric: m, Value: 3, Tags: map[string]string{"a": "3"}},
+	})
+	cancel()
+	<-done
+
+	var lines []string
+	buf := make([]byte, 1024)
+	for len(lines) < 3 {
+		_ = listener.SetReadDeadline(time.Now().Add(1 * time.Second))
+		n, err := listener.Read(buf)
+		if !assert.NoError(t, err) {
+			return
+		}
+		lines = append(lines, strings.Split(string(buf[:n]), "\n")...)
+	}
+	assert.Equal(t, expected, lines)
+}
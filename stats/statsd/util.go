@@ -0,0 +1,109 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package statsd
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultAddr         = "localhost:8125"
+	defaultPushInterval = 1 * time.Second
+	defaultBufferSize   = 1432
+)
+
+// Config holds everything needed to talk to a StatsD (or DogStatsD) agent.
+type Config struct {
+	Addr         string
+	Namespace    string
+	PushInterval time.Duration
+	BufferSize   int
+
+	// Datadog-only; plain StatsD has no concept of tags.
+	TagWhitelist []string
+}
+
+// Parses a collector string (host:port, optionally with a query string) into a Config.
+func parseConfig(s string) (Config, error) {
+	conf := Config{
+		Addr:         defaultAddr,
+		PushInterval: defaultPushInterval,
+		BufferSize:   defaultBufferSize,
+	}
+	if s == "" {
+		return conf, nil
+	}
+
+	// Allow plain "host:port" strings, which url.Parse() doesn't like on their own.
+	if !strings.Contains(s, "://") {
+		s = "udp://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return conf, err
+	}
+	if u.Host != "" {
+		conf.Addr = u.Host
+	}
+
+	q := u.Query()
+	conf.Namespace = q.Get("namespace")
+	if v := q.Get("push_interval"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return conf, err
+		}
+		if d <= 0 {
+			return conf, errors.Errorf("statsd output: push_interval must be positive: %s", v)
+		}
+		conf.PushInterval = d
+	}
+	if v := q.Get("buffer_size"); v != "" {
+		size, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return conf, err
+		}
+		if size <= 0 {
+			return conf, errors.Errorf("statsd output: buffer_size must be positive: %s", v)
+		}
+		conf.BufferSize = int(size)
+	}
+	if v := q.Get("tag_whitelist"); v != "" {
+		for _, tag := range strings.Split(v, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				conf.TagWhitelist = append(conf.TagWhitelist, tag)
+			}
+		}
+	}
+	return conf, nil
+}
+
+// Characters that have special meaning in the (Dog)StatsD line protocol. Tags are split on the
+// first colon, so their values are allowed to contain more of them; names and tag keys are not.
+var (
+	nameSanitizer     = strings.NewReplacer(":", "_", "|", "_", "@", "_", "#", "_", ",", "_", "\n", "_")
+	tagValueSanitizer = strings.NewReplacer("|", "_", "@", "_", "#", "_", ",", "_", "\n", "_")
+)
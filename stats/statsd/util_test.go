@@ -0,0 +1,78 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package statsd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConfig(t *testing.T) {
+	t.Run("Empty", func(t *testing.T) {
+		conf, err := parseConfig("")
+		assert.NoError(t, err)
+		assert.Equal(t, "localhost:8125", conf.Addr)
+		assert.Equal(t, "", conf.Namespace)
+		assert.Equal(t, 1*time.Second, conf.PushInterval)
+		assert.Equal(t, 1432, conf.BufferSize)
+		assert.Nil(t, conf.TagWhitelist)
+	})
+	t.Run("Addr", func(t *testing.T) {
+		conf, err := parseConfig("1.2.3.4:12345")
+		assert.NoError(t, err)
+		assert.Equal(t, "1.2.3.4:12345", conf.Addr)
+	})
+	t.Run("Query", func(t *testing.T) {
+		conf, err := parseConfig("1.2.3.4:12345?namespace=k6.&push_interval=5s&buffer_size=512&tag_whitelist=status, method")
+		assert.NoError(t, err)
+		assert.Equal(t, "1.2.3.4:12345", conf.Addr)
+		assert.Equal(t, "k6.", conf.Namespace)
+		assert.Equal(t, 5*time.Second, conf.PushInterval)
+		assert.Equal(t, 512, conf.BufferSize)
+		assert.Equal(t, []string{"status", "method"}, conf.TagWhitelist)
+	})
+	t.Run("Scheme", func(t *testing.T) {
+		conf, err := parseConfig("udp://1.2.3.4:12345?namespace=k6.")
+		assert.NoError(t, err)
+		assert.Equal(t, "1.2.3.4:12345", conf.Addr)
+		assert.Equal(t, "k6.", conf.Namespace)
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := parseConfig("1.2.3.4:12345?push_interval=a")
+		assert.Error(t, err)
+		_, err = parseConfig("1.2.3.4:12345?buffer_size=a")
+		assert.Error(t, err)
+	})
+	t.Run("Non-Positive Push Interval", func(t *testing.T) {
+		for _, v := range []string{"0s", "-1s"} {
+			_, err := parseConfig("1.2.3.4:12345?push_interval=" + v)
+			assert.EqualError(t, err, "statsd output: push_interval must be positive: "+v)
+		}
+	})
+	t.Run("Non-Positive Buffer Size", func(t *testing.T) {
+		for _, v := range []string{"0", "-1"} {
+			_, err := parseConfig("1.2.3.4:12345?buffer_size=" + v)
+			assert.EqualError(t, err, "statsd output: buffer_size must be positive: "+v)
+		}
+	})
+}
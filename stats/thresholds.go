@@ -22,6 +22,7 @@ package stats
 
 import (
 	"encoding/json"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/robertkrimen/otto"
@@ -37,6 +38,14 @@ type Threshold struct {
 	Source string
 	Failed bool
 
+	// Abort the whole test if this fails, but not until the grace period's passed; results
+	// are often all over the place at the start of a test.
+	AbortOnFail      bool
+	AbortGracePeriod time.Duration
+
+	// Whether the last run failed; Failed, unlike this, sticks.
+	lastFailed bool
+
 	script *otto.Script
 	vm     *otto.Otto
 }
@@ -64,12 +73,18 @@ func (t Threshold) RunNoTaint() (bool, error) {
 
 func (t *Threshold) Run() (bool, error) {
 	b, err := t.RunNoTaint()
+	t.lastFailed = !b
 	if !b {
 		t.Failed = true
 	}
 	return b, err
 }
 
+// LastFailed returns whether the threshold failed the last time it was run.
+func (t Threshold) LastFailed() bool {
+	return t.lastFailed
+}
+
 type Thresholds struct {
 	VM         *otto.Otto
 	Thresholds []*Threshold
@@ -126,24 +141,76 @@ func (ts *Thresholds) Run(sink Sink) (bool, error) {
 	return ts.RunAll()
 }
 
+// ShouldAbort returns whether any threshold that aborts the test failed on its last run, once
+// its grace period has passed; elapsed is how long the test has been running.
+func (ts *Thresholds) ShouldAbort(elapsed time.Duration) bool {
+	for _, th := range ts.Thresholds {
+		if th.AbortOnFail && th.lastFailed && elapsed >= th.AbortGracePeriod {
+			return true
+		}
+	}
+	return false
+}
+
+// The object form of a threshold, for when there's more to it than the source.
+type thresholdConfig struct {
+	Threshold      string `json:"threshold"`
+	AbortOnFail    bool   `json:"abortOnFail"`
+	DelayAbortEval string `json:"delayAbortEval,omitempty"`
+}
+
 func (ts *Thresholds) UnmarshalJSON(data []byte) error {
-	var sources []string
-	if err := json.Unmarshal(data, &sources); err != nil {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
 		return err
 	}
 
+	// Thresholds are either plain sources, or objects (see thresholdConfig).
+	configs := make([]thresholdConfig, len(raw))
+	sources := make([]string, len(raw))
+	for i, data := range raw {
+		if err := json.Unmarshal(data, &sources[i]); err == nil {
+			configs[i].Threshold = sources[i]
+			continue
+		}
+		if err := json.Unmarshal(data, &configs[i]); err != nil {
+			return err
+		}
+		sources[i] = configs[i].Threshold
+	}
+
 	newts, err := NewThresholds(sources)
 	if err != nil {
 		return err
 	}
+	for i, conf := range configs {
+		th := newts.Thresholds[i]
+		th.AbortOnFail = conf.AbortOnFail
+		if conf.DelayAbortEval != "" {
+			d, err := time.ParseDuration(conf.DelayAbortEval)
+			if err != nil {
+				return errors.Wrapf(err, "%d: delayAbortEval", i)
+			}
+			th.AbortGracePeriod = d
+		}
+	}
 	*ts = newts
 	return nil
 }
 
 func (ts Thresholds) MarshalJSON() ([]byte, error) {
-	sources := make([]string, len(ts.Thresholds))
+	configs := make([]interface{}, len(ts.Thresholds))
 	for i, t := range ts.Thresholds {
-		sources[i] = t.Source
+		if !t.AbortOnFail && t.AbortGracePeriod == 0 {
+			configs[i] = t.Source
+			continue
+		}
+
+		conf := thresholdConfig{Threshold: t.Source, AbortOnFail: t.AbortOnFail}
+		if t.AbortGracePeriod != 0 {
+			conf.DelayAbortEval = t.AbortGracePeriod.String()
+		}
+		configs[i] = conf
 	}
-	return json.Marshal(sources)
+	return json.Marshal(configs)
 }
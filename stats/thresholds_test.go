@@ -23,6 +23,7 @@ package stats
 import (
 	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/robertkrimen/otto"
 	"github.com/stretchr/testify/assert"
@@ -194,3 +195,39 @@ func TestThresholdsJSON(t *testing.T) {
 		})
 	}
 }
+
+func TestThresholdsJSONAbort(t *testing.T) {
+	var ts Thresholds
+	assert.NoError(t, json.Unmarshal([]byte(`["1+1==2",{"threshold":"1+1==3","abortOnFail":true,"delayAbortEval":"10s"}]`), &ts))
+	assert.Len(t, ts.Thresholds, 2)
+	assert.Equal(t, "1+1==2", ts.Thresholds[0].Source)
+	assert.False(t, ts.Thresholds[0].AbortOnFail)
+	assert.Equal(t, "1+1==3", ts.Thresholds[1].Source)
+	assert.True(t, ts.Thresholds[1].AbortOnFail)
+	assert.Equal(t, 10*time.Second, ts.Thresholds[1].AbortGracePeriod)
+
+	t.Run("marshal", func(t *testing.T) {
+		data, err := json.Marshal(ts)
+		assert.NoError(t, err)
+		assert.Equal(t, `["1+1==2",{"threshold":"1+1==3","abortOnFail":true,"delayAbortEval":"10s"}]`, string(data))
+	})
+
+	t.Run("invalid delay", func(t *testing.T) {
+		var ts Thresholds
+		assert.Error(t, json.Unmarshal([]byte(`[{"threshold":"1+1==3","delayAbortEval":"soon"}]`), &ts))
+	})
+}
+
+func TestThresholdsShouldAbort(t *testing.T) {
+	ts, err := NewThresholds([]string{"1+1==3"})
+	assert.NoError(t, err)
+	ts.Thresholds[0].AbortGracePeriod = 10 * time.Second
+
+	_, err = ts.RunAll()
+	assert.NoError(t, err)
+	assert.False(t, ts.ShouldAbort(1*time.Minute), "aborted without abortOnFail")
+
+	ts.Thresholds[0].AbortOnFail = true
+	assert.False(t, ts.ShouldAbort(5*time.Second), "aborted within grace period")
+	assert.True(t, ts.ShouldAbort(10*time.Second), "didn't abort after grace period")
+}
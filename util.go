@@ -28,6 +28,7 @@ import (
 
 	"github.com/ghodss/yaml"
 	"github.com/loadimpact/k6/lib"
+	"github.com/pkg/errors"
 	"gopkg.in/guregu/null.v3"
 	"gopkg.in/urfave/cli.v1"
 )
@@ -82,3 +83,38 @@ func ParseStage(s string) (lib.Stage, error) {
 	}
 	return stage, nil
 }
+
+// Parses a list of KEY=VALUE pairs, as given by eg. --env; later ones override earlier ones.
+func parseKeyValues(pairs []string) (map[string]string, error) {
+	kv := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.Errorf("invalid key-value pair, expected KEY=VALUE: %s", pair)
+		}
+		kv[parts[0]] = parts[1]
+	}
+	return kv, nil
+}
+
+// Merges sets of environment variables; later ones take precedence.
+func mergeEnv(envs ...map[string]string) map[string]string {
+	env := make(map[string]string)
+	for _, e := range envs {
+		for k, v := range e {
+			env[k] = v
+		}
+	}
+	return env
+}
+
+// Returns the process' own environment variables.
+func systemEnv() map[string]string {
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		if parts := strings.SplitN(kv, "=", 2); len(parts) == 2 {
+			env[parts[0]] = parts[1]
+		}
+	}
+	return env
+}
@@ -46,3 +46,21 @@ func TestParseStage(t *testing.T) {
 		})
 	}
 }
+
+func TestParseKeyValues(t *testing.T) {
+	kv, err := parseKeyValues([]string{"A=1", "B=x=y", "C=", "A=2"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"A": "2", "B": "x=y", "C": ""}, kv)
+
+	for _, pair := range []string{"A", "=1"} {
+		_, err := parseKeyValues([]string{pair})
+		assert.EqualError(t, err, "invalid key-value pair, expected KEY=VALUE: "+pair)
+	}
+}
+
+func TestMergeEnv(t *testing.T) {
+	assert.Equal(t,
+		map[string]string{"A": "1", "B": "3", "C": "4"},
+		mergeEnv(map[string]string{"A": "1", "B": "2"}, nil, map[string]string{"B": "3", "C": "4"}),
+	)
+}